@@ -23,6 +23,8 @@ const (
 
 type ErrResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code"`
+	ID    string `json:"id"`
 }
 
 func CallCreateUserEndpoint(t *testing.T, u model.User) ([]byte, int) {
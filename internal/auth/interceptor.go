@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// TrustedMetadataSubjectInterceptor returns a gRPC unary interceptor that puts the subject from the request metadata
+// to the request context, the same way TrustedHeaderSubjectMiddleware does for the HTTP requests. The metadata key
+// is the header name, as the metadata is sent as HTTP/2 headers by the trusted authenticating proxy.
+func TrustedMetadataSubjectInterceptor(key string) grpc.UnaryServerInterceptor {
+	key = strings.ToLower(key)
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			ctx = ContextWithSubject(ctx, values[0])
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func Test_TrustedMetadataSubjectInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		md          metadata.MD
+		wantSubject string
+	}{
+		{
+			name:        "subject from metadata",
+			md:          metadata.Pairs("x-auth-subject", "api-key-1"),
+			wantSubject: "api-key-1",
+		},
+		{
+			name: "no metadata",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			var got string
+			handler := func(ctx context.Context, _ any) (any, error) {
+				got = SubjectFromContext(ctx)
+				return nil, nil
+			}
+
+			_, err := TrustedMetadataSubjectInterceptor("X-Auth-Subject")(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSubject, got)
+		})
+	}
+}
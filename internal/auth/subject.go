@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type subjectKey struct{}
+
+type adminKey struct{}
+
+// ContextWithSubject returns a copy of the context carrying the authenticated subject (e.g. API key ID or JWT subject).
+func ContextWithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the authenticated subject carried by the context or empty string if there is none.
+func SubjectFromContext(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
+
+// ContextWithAdmin returns a copy of the context marking the caller as the admin.
+func ContextWithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// IsAdmin returns true if the context marks the caller as the admin.
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
+
+// TrustedHeaderSubjectMiddleware returns a middleware that puts the subject from the request header to the request context.
+// The header has to be set by a trusted authenticating proxy in front of the service, that also strips it from client requests.
+// The gin engine needs ContextWithFallback enabled for the subject to be visible through the gin context.
+func TrustedHeaderSubjectMiddleware(header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subject := c.GetHeader(header); subject != "" {
+			c.Request = c.Request.WithContext(ContextWithSubject(c.Request.Context(), subject))
+		}
+		c.Next()
+	}
+}
+
+// APIKeyMiddleware returns a middleware that rejects the requests without the API key in the request header
+// with 401 Unauthorized.
+func APIKeyMiddleware(header, apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(header)), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminAPIKeyMiddleware returns a middleware that marks the requests with the API key in the request header as the admin
+// ones, the other requests are passed unmarked. The gin engine needs ContextWithFallback enabled for the mark to be visible
+// through the gin context.
+func AdminAPIKeyMiddleware(header, apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(header)), []byte(apiKey)) == 1 {
+			c.Request = c.Request.WithContext(ContextWithAdmin(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_TrustedHeaderSubjectMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantSubject string
+	}{
+		{
+			name:        "subject from header",
+			header:      "api-key-1",
+			wantSubject: "api-key-1",
+		},
+		{
+			name: "no header",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.ContextWithFallback = true
+			router.Use(TrustedHeaderSubjectMiddleware("X-Auth-Subject"))
+			var got string
+			router.GET("/", func(c *gin.Context) {
+				got = SubjectFromContext(c)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Auth-Subject", tt.header)
+			}
+
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.wantSubject, got)
+		})
+	}
+}
+
+func Test_SubjectFromContext(t *testing.T) {
+	assert.Equal(t, "", SubjectFromContext(context.Background()))
+	assert.Equal(t, "admin", SubjectFromContext(ContextWithSubject(context.Background(), "admin")))
+}
+
+func Test_APIKeyMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "valid key",
+			header:     "secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid key",
+			header:     "secrets",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no key",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(APIKeyMiddleware("X-Admin-Api-Key", "secret"))
+			router.GET("/", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Admin-Api-Key", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func Test_AdminAPIKeyMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantAdmin bool
+	}{
+		{
+			name:      "valid key",
+			header:    "secret",
+			wantAdmin: true,
+		},
+		{
+			name:   "invalid key",
+			header: "other",
+		},
+		{
+			name: "no key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.ContextWithFallback = true
+			router.Use(AdminAPIKeyMiddleware("X-Api-Key", "secret"))
+			var got bool
+			router.GET("/", func(c *gin.Context) {
+				got = IsAdmin(c)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Api-Key", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantAdmin, got)
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package configuration
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_LoadFromEnvOrDefault_MongoTimeouts(t *testing.T) {
+	tests := []struct {
+		name                       string
+		env                        map[string]string
+		wantConnectTimeout         time.Duration
+		wantServerSelectionTimeout time.Duration
+		wantOperationTimeout       time.Duration
+		wantErr                    bool
+	}{
+		{
+			name:                       "defaults",
+			wantConnectTimeout:         5 * time.Second,
+			wantServerSelectionTimeout: 5 * time.Second,
+			wantOperationTimeout:       3 * time.Second,
+		},
+		{
+			name: "from env",
+			env: map[string]string{
+				"MONGO_CONNECT_TIMEOUT":          "2s",
+				"MONGO_SERVER_SELECTION_TIMEOUT": "1500ms",
+				"MONGO_OPERATION_TIMEOUT":        "1s",
+			},
+			wantConnectTimeout:         2 * time.Second,
+			wantServerSelectionTimeout: 1500 * time.Millisecond,
+			wantOperationTimeout:       time.Second,
+		},
+		{
+			name: "non-positive operation timeout falls back to default",
+			env: map[string]string{
+				"MONGO_OPERATION_TIMEOUT": "0s",
+			},
+			wantConnectTimeout:         5 * time.Second,
+			wantServerSelectionTimeout: 5 * time.Second,
+			wantOperationTimeout:       3 * time.Second,
+		},
+		{
+			name: "invalid duration",
+			env: map[string]string{
+				"MONGO_CONNECT_TIMEOUT": "fast",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			got, err := LoadFromEnvOrDefault()
+
+			require.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.wantConnectTimeout, got.MongoConnectTimeout)
+				assert.Equal(t, tt.wantServerSelectionTimeout, got.MongoServerSelectionTimeout)
+				assert.Equal(t, tt.wantOperationTimeout, got.MongoOperationTimeout)
+			}
+		})
+	}
+}
+
+func Test_MongoClientOptions(t *testing.T) {
+	cfg := &ServiceConfig{
+		ServiceName:                 "user-service",
+		MongoURL:                    "mongodb://user:password@db:27017/",
+		MongoConnectTimeout:         2 * time.Second,
+		MongoServerSelectionTimeout: 3 * time.Second,
+	}
+
+	got := cfg.MongoClientOptions()
+
+	require.NoError(t, got.Validate())
+	assert.Equal(t, []string{"db:27017"}, got.Hosts)
+	assert.Equal(t, "user-service", *got.AppName)
+	assert.Equal(t, 2*time.Second, *got.ConnectTimeout)
+	assert.Equal(t, 3*time.Second, *got.ServerSelectionTimeout)
+}
+
+func Test_LoadFromEnvOrDefault_SoftValidationFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:  "list with spaces",
+			value: "nickname, country",
+			want:  []string{"nickname", "country"},
+		},
+		{
+			name:    "unknown field",
+			value:   "nickname,age",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SOFT_VALIDATION_FIELDS", tt.value)
+
+			got, err := LoadFromEnvOrDefault()
+
+			require.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got.SoftValidationFields)
+			}
+		})
+	}
+}
+
+func Test_LoadFromEnvOrDefault_DefaultPageSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: 20,
+		},
+		{
+			name: "from env",
+			env:  map[string]string{"DEFAULT_PAGE_SIZE": "50"},
+			want: 50,
+		},
+		{
+			name:    "not positive",
+			env:     map[string]string{"DEFAULT_PAGE_SIZE": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "bigger than max page size",
+			env:     map[string]string{"DEFAULT_PAGE_SIZE": "50", "MAX_PAGE_SIZE": "30"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			got, err := LoadFromEnvOrDefault()
+
+			require.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got.DefaultPageSize)
+			}
+		})
+	}
+}
+
+func Test_LoadFromEnvOrDefault_SortableAndFilterableFields(t *testing.T) {
+	tests := []struct {
+		name           string
+		env            map[string]string
+		wantSortable   []string
+		wantFilterable []string
+		wantErr        bool
+	}{
+		{
+			name: "not set - all allowed",
+		},
+		{
+			name: "restricted",
+			env: map[string]string{
+				"SORTABLE_FIELDS":   "last_name, created_at",
+				"FILTERABLE_FIELDS": "country,email_domain",
+			},
+			wantSortable:   []string{"last_name", "created_at"},
+			wantFilterable: []string{"country", "email_domain"},
+		},
+		{
+			name:    "unknown sortable field",
+			env:     map[string]string{"SORTABLE_FIELDS": "age"},
+			wantErr: true,
+		},
+		{
+			name:    "filter only field not sortable",
+			env:     map[string]string{"SORTABLE_FIELDS": "email_domain"},
+			wantErr: true,
+		},
+		{
+			name:    "password not filterable",
+			env:     map[string]string{"FILTERABLE_FIELDS": "password"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			got, err := LoadFromEnvOrDefault()
+
+			require.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.wantSortable, got.SortableFields)
+				assert.Equal(t, tt.wantFilterable, got.FilterableFields)
+			}
+		})
+	}
+}
+
+func Test_KafkaClientID(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		suffix     string
+		wantPrefix string
+		wantID     string
+		wantErr    bool
+	}{
+		{
+			name:   "hostname by default",
+			wantID: "user-service-" + hostname,
+		},
+		{
+			name:   "hostname",
+			suffix: "hostname",
+			wantID: "user-service-" + hostname,
+		},
+		{
+			name:       "random",
+			suffix:     "random",
+			wantPrefix: "user-service-",
+		},
+		{
+			name:   "none",
+			suffix: "none",
+			wantID: "user-service",
+		},
+		{
+			name:    "unknown",
+			suffix:  "pod",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.suffix != "" {
+				t.Setenv("KAFKA_CLIENT_ID_SUFFIX", tt.suffix)
+			}
+
+			got, err := LoadFromEnvOrDefault()
+
+			require.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			if tt.wantPrefix != "" {
+				assert.True(t, strings.HasPrefix(got.KafkaClientID(), tt.wantPrefix))
+				assert.Len(t, got.KafkaClientID(), len(tt.wantPrefix)+8)
+				return
+			}
+			assert.Equal(t, tt.wantID, got.KafkaClientID())
+		})
+	}
+}
+
+func Test_CaseInsensitiveIndexFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    string
+		filterable string
+		want       []string
+	}{
+		{
+			name: "disabled by default",
+		},
+		{
+			name:    "all filterable fields",
+			enabled: "true",
+			want:    []string{"country", "created_by", "email", "first_name", "last_name", "nickname", "phone"},
+		},
+		{
+			name:       "configured filterable fields",
+			enabled:    "true",
+			filterable: "nickname,email_domain",
+			want:       []string{"nickname"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.enabled != "" {
+				t.Setenv("MONGO_CASE_INSENSITIVE_INDEXES", tt.enabled)
+			}
+			if tt.filterable != "" {
+				t.Setenv("FILTERABLE_FIELDS", tt.filterable)
+			}
+
+			got, err := LoadFromEnvOrDefault()
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.CaseInsensitiveIndexFields())
+		})
+	}
+}
+
+func Test_LoadFromEnvOrDefault_FieldMaxLengths(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name: "not set",
+			want: map[string]int{},
+		},
+		{
+			name:  "known fields",
+			value: "first_name=64, nickname = 32",
+			want:  map[string]int{"first_name": 64, "nickname": 32},
+		},
+		{
+			name:    "unknown field",
+			value:   "age=3",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			value:   "first_name=long",
+			wantErr: true,
+		},
+		{
+			name:    "non-positive length",
+			value:   "first_name=0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FIELD_MAX_LENGTHS", tt.value)
+
+			got, err := LoadFromEnvOrDefault()
+
+			require.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got.FieldMaxLengths)
+			}
+		})
+	}
+}
+
+func Test_LoadFromEnvOrDefault_EventsProduceRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "retries with async production",
+			env:  map[string]string{"EVENTS_PRODUCE_MAX_ATTEMPTS": "3", "EVENTS_ASYNC_PRODUCE": "true"},
+		},
+		{
+			name:    "retries in request path",
+			env:     map[string]string{"EVENTS_PRODUCE_MAX_ATTEMPTS": "3"},
+			wantErr: true,
+		},
+		{
+			name:    "negative initial backoff",
+			env:     map[string]string{"EVENTS_PRODUCE_INITIAL_BACKOFF": "-1s"},
+			wantErr: true,
+		},
+		{
+			name:    "zero max backoff",
+			env:     map[string]string{"EVENTS_PRODUCE_MAX_BACKOFF": "0s"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := LoadFromEnvOrDefault()
+
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"user-service/internal/model"
+)
+
+// bulkUpdateFields are the user fields that can be changed by the bulk update.
+var bulkUpdateFields = map[string]struct{}{
+	"first_name": {},
+	"last_name":  {},
+	"nickname":   {},
+	"country":    {},
+}
+
+type AdminService interface {
+	BulkUpdateUsers(ctx context.Context, update model.BulkUpdate) (int64, error)
+}
+
+// Indexer (re)builds the users DB indexes.
+type Indexer interface {
+	EnsureIndexes(ctx context.Context) error
+	Indexes(ctx context.Context) ([]model.Index, error)
+}
+
+// EventsFlusher produces the pending buffered events.
+type EventsFlusher interface {
+	Flush(ctx context.Context) (int, error)
+}
+
+// CreateAdminHandlers registers admin endpoint paths with handlers to given router.
+// The router has to be protected by an authenticating middleware.
+func CreateAdminHandlers(router *gin.RouterGroup, svc AdminService, opts ...Opt) {
+	cfg := newHandlersConfig(opts...)
+
+	router.POST("bulk-update", rejectWritesIfReadOnly(cfg), limitJSONDepth(cfg.maxJSONDepth), bulkUpdateUsers(svc, cfg))
+	if cfg.readOnlyMode != nil {
+		router.POST("readonly", setReadOnly(cfg.readOnlyMode, cfg))
+	}
+	if cfg.indexer != nil {
+		router.POST("reindex", reindex(cfg.indexer, cfg))
+	}
+	if cfg.eventsFlusher != nil {
+		router.POST("events/flush", flushEvents(cfg.eventsFlusher, cfg))
+	}
+}
+
+// reindex returns a handler that creates the missing users DB indexes and responds with all the existing ones.
+// Already existing indexes are left untouched, so it is safe to be called repeatedly.
+func reindex(indexer Indexer, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := indexer.EnsureIndexes(c); err != nil {
+			logrus.WithError(err).Error("failed to ensure indexes")
+			respondError(c, http.StatusInternalServerError, apiError{Error: "indexes not created", Code: codeInternalError}, cfg)
+			return
+		}
+
+		indexes, err := indexer.Indexes(c)
+		if err != nil {
+			logrus.WithError(err).Error("failed to list indexes")
+			respondError(c, http.StatusInternalServerError, apiError{Error: "indexes not listed", Code: codeInternalError}, cfg)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"indexes": indexes})
+	}
+}
+
+// flushEvents returns a handler that waits until the pending buffered events are produced, at most the configured timeout,
+// and responds with their number e.g. before scaling the service down.
+func flushEvents(flusher EventsFlusher, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.eventsFlushTimeout)
+		defer cancel()
+
+		pending, err := flusher.Flush(ctx)
+		if err != nil {
+			logrus.WithError(err).
+				WithField("pending", pending).
+				Error("failed to flush events")
+			respondError(c, http.StatusGatewayTimeout, apiError{
+				Error:   "pending events not produced in time",
+				Code:    codeTimeout,
+				Pending: &pending,
+			}, cfg)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"pending": pending})
+	}
+}
+
+// bulkUpdateUsers returns a handler that sets the fields of all the users matching the filter.
+func bulkUpdateUsers(svc AdminService, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		update, err := parseBulkUpdate(c, cfg)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
+			return
+		}
+
+		modified, err := svc.BulkUpdateUsers(c, update)
+		if err != nil {
+			respondServiceError(c, err, cfg)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"modified_count": modified})
+	}
+}
+
+func parseBulkUpdate(c *gin.Context, cfg handlersConfig) (model.BulkUpdate, error) {
+	var update model.BulkUpdate
+	body, err := c.GetRawData()
+	if err != nil {
+		return update, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// unknown filter fields would silently widen the filter
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		return update, err
+	}
+
+	if update.Filter.IsEmpty() {
+		return update, fmt.Errorf("filter is required")
+	}
+	if len(update.Set) == 0 {
+		return update, fmt.Errorf("set is required")
+	}
+	for field, value := range update.Set {
+		if _, ok := bulkUpdateFields[field]; !ok {
+			return update, fmt.Errorf("field %s cannot be bulk updated", field)
+		}
+		if value == "" {
+			return update, fmt.Errorf("%s cannot be empty", field)
+		}
+	}
+	return update, validateBulkUpdateSet(update.Set, cfg)
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func Test_BulkUpdateUsersHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		opts           []Opt
+		wantUpdate     *model.BulkUpdate
+		modified       int64
+		serviceError   error
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "users updated",
+			body: `{"filter":{"country":"UK"},"set":{"country":"GB"}}`,
+			wantUpdate: &model.BulkUpdate{
+				Filter: model.FilterFields{Country: model.Ptr("UK")},
+				Set:    map[string]string{"country": "GB"},
+			},
+			modified:       3,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"modified_count":3}`,
+		},
+		{
+			name:           "empty filter",
+			body:           `{"filter":{},"set":{"country":"GB"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"filter is required"}`,
+		},
+		{
+			name:           "missing filter",
+			body:           `{"set":{"country":"GB"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"filter is required"}`,
+		},
+		{
+			name:           "unknown filter field",
+			body:           `{"filter":{"countries":"UK"},"set":{"country":"GB"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"json: unknown field \"countries\""}`,
+		},
+		{
+			name:           "missing set",
+			body:           `{"filter":{"country":"UK"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"set is required"}`,
+		},
+		{
+			name:           "field not allowed",
+			body:           `{"filter":{"country":"UK"},"set":{"email":"a@b.com"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"field email cannot be bulk updated"}`,
+		},
+		{
+			name:           "empty value",
+			body:           `{"filter":{"country":"UK"},"set":{"country":""}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"country cannot be empty"}`,
+		},
+		{
+			name:           "too long value",
+			body:           `{"filter":{"country":"UK"},"set":{"nickname":"abcdef"}}`,
+			opts:           []Opt{WithMaxFieldLengths(map[string]int{"nickname": 5})},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"nickname is too long, maximum is 5 characters"}`,
+		},
+		{
+			name: "too long soft validated value",
+			body: `{"filter":{"country":"UK"},"set":{"nickname":"abcdef"}}`,
+			opts: []Opt{WithMaxFieldLengths(map[string]int{"nickname": 5}), WithSoftValidation("nickname")},
+			wantUpdate: &model.BulkUpdate{
+				Filter: model.FilterFields{Country: model.Ptr("UK")},
+				Set:    map[string]string{"nickname": "abcdef"},
+			},
+			modified:       1,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"modified_count":1}`,
+		},
+		{
+			name: "service failure",
+			body: `{"filter":{"country":"UK"},"set":{"country":"GB"}}`,
+			wantUpdate: &model.BulkUpdate{
+				Filter: model.FilterFields{Country: model.Ptr("UK")},
+				Set:    map[string]string{"country": "GB"},
+			},
+			serviceError:   errors.New("db down"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `{"error":"internal server error","code":"internal_error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/admin/bulk-update", strings.NewReader(tt.body))
+			if tt.wantUpdate != nil {
+				serviceMock.On("BulkUpdateUsers", ctx, *tt.wantUpdate).Return(tt.modified, tt.serviceError)
+			}
+
+			// call the handler
+			bulkUpdateUsers(serviceMock, newHandlersConfig(tt.opts...))(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+type indexerStub struct {
+	ensureErr error
+	ensured   int
+	indexes   []model.Index
+}
+
+func (i *indexerStub) EnsureIndexes(context.Context) error {
+	i.ensured++
+	return i.ensureErr
+}
+
+func (i *indexerStub) Indexes(context.Context) ([]model.Index, error) {
+	return i.indexes, nil
+}
+
+func Test_ReindexHandler(t *testing.T) {
+	indexes := []model.Index{
+		{Name: "_id_", Keys: []string{"_id"}},
+		{Name: "unique_nickname_per_country", Keys: []string{"country", "nickname"}, Unique: true},
+	}
+
+	tests := []struct {
+		name           string
+		ensureErr      error
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "indexes ensured",
+			wantStatusCode: http.StatusOK,
+			wantBody: `{"indexes":[{"name":"_id_","keys":["_id"],"unique":false},` +
+				`{"name":"unique_nickname_per_country","keys":["country","nickname"],"unique":true}]}`,
+		},
+		{
+			name:           "ensure failure",
+			ensureErr:      errors.New("db down"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `{"error":"indexes not created","code":"internal_error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := &indexerStub{ensureErr: tt.ensureErr, indexes: indexes}
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/admin/reindex", nil)
+
+			reindex(indexer, newHandlersConfig())(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, 1, indexer.ensured)
+		})
+	}
+}
+
+type eventsFlusherStub struct {
+	pending int
+	err     error
+	flushed int
+}
+
+func (f *eventsFlusherStub) Flush(ctx context.Context) (int, error) {
+	f.flushed++
+	if _, ok := ctx.Deadline(); !ok {
+		return 0, errors.New("flush has to be bounded by the timeout")
+	}
+	return f.pending, f.err
+}
+
+func Test_FlushEventsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		flusher        *eventsFlusherStub
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "pending events flushed",
+			flusher:        &eventsFlusherStub{pending: 3},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"pending":3}`,
+		},
+		{
+			name:           "flush timed out",
+			flusher:        &eventsFlusherStub{pending: 3, err: context.DeadlineExceeded},
+			wantStatusCode: http.StatusGatewayTimeout,
+			wantBody:       `{"error":"pending events not produced in time","code":"timeout","pending":3}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/admin/events/flush", nil)
+
+			flushEvents(tt.flusher, newHandlersConfig(WithEventsFlusher(tt.flusher, time.Second)))(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, 1, tt.flusher.flushed)
+		})
+	}
+}
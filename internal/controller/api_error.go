@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"strings"
+	storage_err "user-service/internal/errors"
+)
+
+const (
+	codeInvalidParameter     = "invalid_parameter"
+	codeParameterOutOfRange  = "parameter_out_of_range"
+	codeUnsupportedParameter = "unsupported_parameter_value"
+	codeDuplicateParameter   = "duplicate_parameter"
+	codeBatchTooLarge        = "batch_too_large"
+	codeUserNotFound         = "user_not_found"
+	codeUnauthenticated      = "unauthenticated"
+	codeForbidden            = "forbidden"
+	codeConflict             = "conflict"
+	codePreconditionFailed   = "precondition_failed"
+	codeValidationFailed     = "validation_failed"
+	codeUnavailable          = "unavailable"
+	codeTimeout              = "timeout"
+	codeInternalError        = "internal_error"
+)
+
+// apiError is the structured error response body.
+type apiError struct {
+	Error string `json:"error"`
+	// Code is a stable machine-readable identifier of the error.
+	Code string `json:"code,omitempty"`
+	// ID is the requested ID of the user that was not found.
+	ID string `json:"id,omitempty"`
+	// Parameter is the name of the request parameter that caused the error.
+	Parameter string `json:"parameter,omitempty"`
+	// Details is the DB explanation of the validation failure.
+	Details map[string]any `json:"details,omitempty"`
+	// Index is the position of the failed user in the batch payload.
+	Index *int `json:"index,omitempty"`
+	// Pending is the number of the events that were pending when the events flush timed out.
+	Pending *int `json:"pending,omitempty"`
+}
+
+const (
+	problemJSONContentType = "application/problem+json"
+	// problemTypePrefix prefixes the error code in the problem type, problems without the code are about:blank
+	problemTypePrefix = "urn:user-service:problem:"
+)
+
+// problemDetails is the RFC 7807 representation of the apiError. The code, ID, parameter and details are its extension members.
+type problemDetails struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	Code      string         `json:"code,omitempty"`
+	ID        string         `json:"id,omitempty"`
+	Parameter string         `json:"parameter,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+	Index     *int           `json:"index,omitempty"`
+	Pending   *int           `json:"pending,omitempty"`
+}
+
+func newProblemDetails(status int, err apiError, instance string) problemDetails {
+	problemType := "about:blank"
+	if err.Code != "" {
+		problemType = problemTypePrefix + err.Code
+	}
+	return problemDetails{
+		Type:      problemType,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Error,
+		Instance:  instance,
+		Code:      err.Code,
+		ID:        err.ID,
+		Parameter: err.Parameter,
+		Details:   err.Details,
+		Index:     err.Index,
+		Pending:   err.Pending,
+	}
+}
+
+// respondError writes the error response and aborts the request. The error is written as application/problem+json
+// if configured or accepted by the client, otherwise as the apiError JSON.
+func respondError(c *gin.Context, status int, err apiError, cfg handlersConfig) {
+	if cfg.problemDetails || acceptsProblemJSON(c.Request) {
+		var instance string
+		if c.Request != nil && c.Request.URL != nil {
+			instance = c.Request.URL.Path
+		}
+		c.Render(status, problemJSON{problem: newProblemDetails(status, err, instance)})
+		c.Abort()
+		return
+	}
+	c.JSON(status, err)
+	c.Abort()
+}
+
+// acceptsProblemJSON returns true if the client explicitly accepts application/problem+json.
+func acceptsProblemJSON(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == problemJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// problemJSON renders the problem details as JSON with the application/problem+json content type.
+type problemJSON struct {
+	problem problemDetails
+}
+
+func (p problemJSON) Render(w http.ResponseWriter) error {
+	p.WriteContentType(w)
+	return json.NewEncoder(w).Encode(p.problem)
+}
+
+func (p problemJSON) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", problemJSONContentType)
+}
+
+// paramError is a failure to parse a request parameter.
+type paramError struct {
+	parameter string
+	code      string
+	msg       string
+}
+
+// newInvalidParamError creates the paramError of the parameter rejected by the shared validation, so it's reported
+// the same whether it was rejected by the controller or by the storage.
+func newInvalidParamError(err *storage_err.InvalidParameterError) *paramError {
+	code := codeInvalidParameter
+	if err.OutOfRange {
+		code = codeParameterOutOfRange
+	}
+	return &paramError{parameter: err.Parameter, code: code, msg: err.Error()}
+}
+
+func (e *paramError) Error() string {
+	return e.msg
+}
+
+func (e *paramError) apiError() apiError {
+	return apiError{
+		Error:     e.msg,
+		Code:      e.code,
+		Parameter: e.parameter,
+	}
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	storage_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+func Test_ProblemDetails(t *testing.T) {
+	missing := uuid.New()
+	serviceMock := new(ServiceMock)
+	serviceMock.On("GetUserByID", mock.Anything, missing).Return((*model.User)(nil), storage_err.NotFoundError)
+
+	tests := []struct {
+		name            string
+		opts            []Opt
+		path            string
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "default error format",
+			path:            "/v1/users/" + missing.String(),
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        `{"error":"user not found","code":"user_not_found","id":"` + missing.String() + `"}`,
+		},
+		{
+			name:            "accepted by the client",
+			path:            "/v1/users/" + missing.String(),
+			accept:          "application/json, application/problem+json;q=0.9",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/problem+json",
+			wantBody: `{"type":"urn:user-service:problem:user_not_found","title":"Not Found","status":404,"detail":"user not found",
+				"instance":"/v1/users/` + missing.String() + `","code":"user_not_found","id":"` + missing.String() + `"}`,
+		},
+		{
+			name:            "configured for all the clients",
+			opts:            []Opt{WithProblemDetails(true)},
+			path:            "/v1/users?pageSize=abc",
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/problem+json",
+			wantBody: `{"type":"urn:user-service:problem:invalid_parameter","title":"Bad Request","status":400,
+				"detail":"pageSize query parameter has to be a number","instance":"/v1/users","code":"invalid_parameter","parameter":"pageSize"}`,
+		},
+		{
+			name:            "error without code",
+			opts:            []Opt{WithProblemDetails(true)},
+			path:            "/v1/users/abc",
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/problem+json",
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,
+				"detail":"incorrect user ID format: invalid UUID length: 3","instance":"/v1/users/abc"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), serviceMock, tt.opts...)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantContentType, w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
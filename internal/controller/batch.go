@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+	storage_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+const orderedQueryParam = "ordered"
+
+// batchCreateResponse tells which users of the batch were created and why the others were not.
+type batchCreateResponse struct {
+	// Created are the created users in the batch order.
+	Created []userResponse     `json:"created"`
+	Failed  []batchItemFailure `json:"failed,omitempty"`
+}
+
+type batchItemFailure struct {
+	// Index is the position of the failed user in the request batch.
+	Index   int            `json:"index"`
+	Error   string         `json:"error"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// createUsers returns a handler that creates the users of the JSON array payload in a single DB batch.
+// The whole batch is rejected if any user is invalid. The users failing the DB insertion are reported by their index,
+// ordered insertion (default) stops at the first failure, unordered one inserts all the users it can.
+func createUsers(svc Service, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ordered := true
+		if got, ok := c.GetQuery(orderedQueryParam); ok {
+			parsed, err := strconv.ParseBool(got)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, apiError{
+					Error:     "ordered query parameter has to be a boolean",
+					Code:      codeInvalidParameter,
+					Parameter: orderedQueryParam,
+				}, cfg)
+				return
+			}
+			ordered = parsed
+		}
+		if cfg.batchChunkSize > 0 {
+			streamCreateUsers(c, svc, ordered, cfg)
+			return
+		}
+
+		var reqs []createUserRequest
+		if err := c.BindJSON(&reqs); err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
+			return
+		}
+		if len(reqs) == 0 {
+			respondError(c, http.StatusBadRequest, apiError{Error: "at least one user is required"}, cfg)
+			return
+		}
+		if cfg.batchMaxItems > 0 && len(reqs) > cfg.batchMaxItems {
+			respondError(c, http.StatusBadRequest, batchTooLargeError(cfg.batchMaxItems), cfg)
+			return
+		}
+
+		users := make([]model.User, len(reqs))
+		for i, req := range reqs {
+			user, err := validateBatchUser(c, req, cfg)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, apiError{Error: fmt.Sprintf("user %d: %s", i, err.Error()), Index: &i}, cfg)
+				return
+			}
+			users[i] = user
+		}
+
+		created, failures, err := svc.CreateUsers(c, users, ordered)
+		if err != nil {
+			respondServiceError(c, err, cfg)
+			return
+		}
+
+		if len(failures) == 0 {
+			c.JSON(http.StatusCreated, batchCreateResponse{Created: newUsersResponse(created, cfg)})
+			return
+		}
+		c.JSON(http.StatusMultiStatus, newBatchCreateResponse(created, failures, cfg))
+	}
+}
+
+// limitConcurrentBatches returns a middleware that rejects the batch with 503 Service Unavailable if the configured number
+// of batches is already being processed, so the concurrent large batches don't overwhelm the DB.
+func limitConcurrentBatches(cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.batchSlots == nil {
+			c.Next()
+			return
+		}
+
+		select {
+		case cfg.batchSlots <- struct{}{}:
+			defer func() { <-cfg.batchSlots }()
+			c.Next()
+		default:
+			c.Header("Retry-After", "1")
+			respondError(c, http.StatusServiceUnavailable, apiError{Error: "too many concurrent batch operations", Code: codeUnavailable}, cfg)
+		}
+	}
+}
+
+func batchTooLargeError(maxItems int) apiError {
+	return apiError{Error: fmt.Sprintf("batch cannot have more than %d users", maxItems), Code: codeBatchTooLarge}
+}
+
+// validateBatchUser validates and normalizes the user the same way as the single user creation. Returns the user to create.
+func validateBatchUser(ctx context.Context, req createUserRequest, cfg handlersConfig) (model.User, error) {
+	user := req.User
+	if err := validateUser(ctx, user, cfg); err != nil {
+		return model.User{}, err
+	}
+	normalizeUser(&user)
+
+	if !cfg.clientTimestamps {
+		return user, nil
+	}
+	if err := validateTimestamps(req, time.Now()); err != nil {
+		return model.User{}, err
+	}
+	return req.withTimestamps(user), nil
+}
+
+func newBatchCreateResponse(users []model.User, failures []storage_err.BatchItemError, cfg handlersConfig) batchCreateResponse {
+	failed := make(map[int]struct{}, len(failures))
+	resp := batchCreateResponse{Failed: make([]batchItemFailure, 0, len(failures))}
+	for _, f := range failures {
+		failed[f.Index] = struct{}{}
+		failure := batchItemFailure{Index: f.Index, Error: f.Err.Error()}
+		var validationErr *storage_err.ValidationError
+		if cfg.validationErrorDetails && errors.As(f.Err, &validationErr) {
+			failure.Details = validationErr.Details()
+		}
+		resp.Failed = append(resp.Failed, failure)
+	}
+
+	created := make([]model.User, 0, len(users)-len(failed))
+	for i, u := range users {
+		if _, ok := failed[i]; !ok {
+			created = append(created, u)
+		}
+	}
+	resp.Created = newUsersResponse(created, cfg)
+	return resp
+}
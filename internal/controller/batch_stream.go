@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"user-service/internal/model"
+)
+
+// batchStream creates the users of the batch in chunks as they are decoded from the request body.
+type batchStream struct {
+	svc     Service
+	cfg     handlersConfig
+	ordered bool
+	chunk   []model.User
+	// offset is the index of the first chunk user in the request array
+	offset int
+	resp   batchCreateResponse
+}
+
+// streamCreateUsers creates the users of the JSON array payload while it is decoded, in chunks of the configured size,
+// so only a single chunk of the request is held in memory regardless of the batch size. The already created chunks
+// can't be rejected, so an invalid user rejects only its chunk and stops the batch, the following users are not read.
+// Ordered insertion stops the batch also after a chunk with a failed user.
+func streamCreateUsers(c *gin.Context, svc Service, ordered bool, cfg handlersConfig) {
+	body := c.Request.Body
+	if cfg.batchMaxBodyBytes > 0 {
+		body = http.MaxBytesReader(c.Writer, body, cfg.batchMaxBodyBytes)
+	}
+	decoder := json.NewDecoder(body)
+	b := &batchStream{
+		svc:     svc,
+		cfg:     cfg,
+		ordered: ordered,
+		chunk:   make([]model.User, 0, cfg.batchChunkSize),
+		resp:    batchCreateResponse{Created: []userResponse{}},
+	}
+
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+		if err == nil {
+			err = errors.New("payload has to be a JSON array of users")
+		}
+		b.stop(c, 0, err)
+		return
+	}
+	for decoder.More() {
+		index := b.offset + len(b.chunk)
+		if cfg.batchMaxItems > 0 && index >= cfg.batchMaxItems {
+			b.stopTooLarge(c)
+			return
+		}
+		var req createUserRequest
+		if err := decoder.Decode(&req); err != nil {
+			b.stop(c, index, err)
+			return
+		}
+		user, err := validateBatchUser(c, req, cfg)
+		if err != nil {
+			b.stop(c, index, fmt.Errorf("user %d: %w", index, err))
+			return
+		}
+
+		b.chunk = append(b.chunk, user)
+		if len(b.chunk) < cfg.batchChunkSize {
+			continue
+		}
+		if proceed := b.flush(c); !proceed {
+			return
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		b.stop(c, b.offset+len(b.chunk), err)
+		return
+	}
+	if b.offset == 0 && len(b.chunk) == 0 {
+		respondError(c, http.StatusBadRequest, apiError{Error: "at least one user is required"}, cfg)
+		return
+	}
+	if proceed := b.flush(c); !proceed {
+		return
+	}
+
+	if len(b.resp.Failed) == 0 {
+		c.JSON(http.StatusCreated, b.resp)
+		return
+	}
+	c.JSON(http.StatusMultiStatus, b.resp)
+}
+
+// flush creates the users of the chunk. Returns false if the batch stopped and the response is already written.
+func (b *batchStream) flush(c *gin.Context) bool {
+	if len(b.chunk) == 0 {
+		return true
+	}
+
+	created, failures, err := b.svc.CreateUsers(c, b.chunk, b.ordered)
+	if err != nil {
+		if b.offset == 0 {
+			respondServiceError(c, err, b.cfg)
+			return false
+		}
+		// the previous chunks are created, so the failure is reported only for the chunk users
+		for i := range b.chunk {
+			b.resp.Failed = append(b.resp.Failed, batchItemFailure{Index: b.offset + i, Error: "not written due to a server failure"})
+		}
+		c.JSON(http.StatusMultiStatus, b.resp)
+		return false
+	}
+
+	chunkResp := newBatchCreateResponse(created, failures, b.cfg)
+	b.resp.Created = append(b.resp.Created, chunkResp.Created...)
+	for _, f := range chunkResp.Failed {
+		f.Index += b.offset
+		b.resp.Failed = append(b.resp.Failed, f)
+	}
+	b.offset += len(b.chunk)
+	b.chunk = make([]model.User, 0, b.cfg.batchChunkSize)
+
+	if b.ordered && len(failures) > 0 {
+		c.JSON(http.StatusMultiStatus, b.resp)
+		return false
+	}
+	return true
+}
+
+// stopTooLarge rejects the batch with more than the maximum number of users. The request is rejected as a whole
+// if no chunk was created yet, otherwise the created chunks are reported and the excess users are not read.
+func (b *batchStream) stopTooLarge(c *gin.Context) {
+	apiErr := batchTooLargeError(b.cfg.batchMaxItems)
+	if b.offset == 0 {
+		respondError(c, http.StatusBadRequest, apiErr, b.cfg)
+		return
+	}
+	b.resp.Failed = append(b.resp.Failed, batchItemFailure{Index: b.cfg.batchMaxItems, Error: apiErr.Error})
+	c.JSON(http.StatusMultiStatus, b.resp)
+}
+
+// stop rejects the chunk with the user at the index that failed to be decoded or validated. The request is rejected
+// as a whole if no chunk was created yet, otherwise the created chunks are reported with the failed user.
+func (b *batchStream) stop(c *gin.Context, index int, err error) {
+	status := http.StatusBadRequest
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		status = http.StatusRequestEntityTooLarge
+		err = fmt.Errorf("payload is larger than %d bytes", maxBytesErr.Limit)
+	}
+
+	if b.offset == 0 {
+		respondError(c, status, apiError{Error: err.Error(), Index: &index}, b.cfg)
+		return
+	}
+	b.resp.Failed = append(b.resp.Failed, batchItemFailure{Index: index, Error: err.Error()})
+	c.JSON(http.StatusMultiStatus, b.resp)
+}
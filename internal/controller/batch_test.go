@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	storage_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+func Test_CreateUsersHandler(t *testing.T) {
+	anna := `{"first_name":"Anna","last_name":"Alakava","nickname":"anna","password":"pwd","email":"ann@gmail.com","country":"UK"}`
+	bob := `{"first_name":"Bob","last_name":"Bobek","nickname":"bob","password":"pwd","email":"bob@gmail.com","country":"UK"}`
+	annaID := uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")
+	bobID := uuid.MustParse("b79d4ce5-40f9-11ef-a3eb-0242ac170004")
+	created := []model.User{
+		{ID: annaID, FirstName: "Anna", LastName: "Alakava", Nickname: "anna", Email: "ann@gmail.com", Country: "UK"},
+		{ID: bobID, FirstName: "Bob", LastName: "Bobek", Nickname: "bob", Email: "bob@gmail.com", Country: "UK"},
+	}
+	annaJSON := `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"Anna","last_name":"Alakava","nickname":"anna",` +
+		`"email":"ann@gmail.com","country":"UK","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`
+	bobJSON := `{"id":"b79d4ce5-40f9-11ef-a3eb-0242ac170004","first_name":"Bob","last_name":"Bobek","nickname":"bob",` +
+		`"email":"bob@gmail.com","country":"UK","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		name           string
+		query          string
+		body           string
+		wantOrdered    bool
+		failures       []storage_err.BatchItemError
+		serviceError   error
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "all created",
+			body:           "[" + anna + "," + bob + "]",
+			wantOrdered:    true,
+			wantStatusCode: http.StatusCreated,
+			wantBody:       `{"created":[` + annaJSON + `,` + bobJSON + `]}`,
+		},
+		{
+			name:        "partially created",
+			query:       "ordered=false",
+			body:        "[" + anna + "," + bob + "]",
+			wantOrdered: false,
+			failures: []storage_err.BatchItemError{
+				{Index: 0, Err: storage_err.NewConflictError("user already exists")},
+			},
+			wantStatusCode: http.StatusMultiStatus,
+			wantBody:       `{"created":[` + bobJSON + `],"failed":[{"index":0,"error":"user already exists"}]}`,
+		},
+		{
+			name:           "invalid user rejects the batch",
+			body:           "[" + anna + `,{"first_name":"Bob"}]`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"user 1: last name is required","index":1}`,
+		},
+		{
+			name:           "empty batch",
+			body:           "[]",
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"at least one user is required"}`,
+		},
+		{
+			name:           "invalid ordered",
+			query:          "ordered=maybe",
+			body:           "[" + anna + "]",
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"ordered query parameter has to be a boolean","code":"invalid_parameter","parameter":"ordered"}`,
+		},
+		{
+			name:           "service failure",
+			body:           "[" + anna + "," + bob + "]",
+			wantOrdered:    true,
+			serviceError:   errors.New("db down"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `{"error":"internal server error","code":"internal_error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			if tt.wantStatusCode != http.StatusBadRequest {
+				serviceMock.On("CreateUsers", mock.Anything, mock.Anything, tt.wantOrdered).Return(created, tt.failures, tt.serviceError)
+			}
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/users/batch?"+tt.query, strings.NewReader(tt.body))
+
+			createUsers(serviceMock, newHandlersConfig())(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+// chunkRecordingService creates all the users it gets, recording the sizes of the created chunks.
+type chunkRecordingService struct {
+	*ServiceMock
+	chunks []int
+}
+
+func (s *chunkRecordingService) CreateUsers(_ context.Context, users []model.User, _ bool) ([]model.User, []storage_err.BatchItemError, error) {
+	s.chunks = append(s.chunks, len(users))
+	created := make([]model.User, 0, len(users))
+	for _, u := range users {
+		u.ID = uuid.New()
+		created = append(created, u)
+	}
+	return created, nil, nil
+}
+
+func Test_CreateUsersHandler_Streaming(t *testing.T) {
+	user := func(i int) string {
+		return fmt.Sprintf(`{"first_name":"Anna","last_name":"Alakava","nickname":"anna%d","password":"pwd","email":"ann%d@gmail.com","country":"UK"}`, i, i)
+	}
+	batch := func(n int, extra ...string) string {
+		users := make([]string, 0, n+len(extra))
+		for i := 0; i < n; i++ {
+			users = append(users, user(i))
+		}
+		return "[" + strings.Join(append(users, extra...), ",") + "]"
+	}
+	createBatch := func(body string, maxBodyBytes int64) (*httptest.ResponseRecorder, *chunkRecordingService) {
+		svc := &chunkRecordingService{ServiceMock: new(ServiceMock)}
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/users/batch", strings.NewReader(body))
+		createUsers(svc, newHandlersConfig(WithBatchStreaming(10, maxBodyBytes)))(ctx)
+		return w, svc
+	}
+
+	t.Run("large batch is created in chunks", func(t *testing.T) {
+		w, svc := createBatch(batch(1000), 0)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var resp struct {
+			Created []map[string]any `json:"created"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.Created, 1000)
+		assert.Equal(t, "anna999", resp.Created[999]["nickname"])
+		assert.Len(t, svc.chunks, 100)
+		for _, size := range svc.chunks {
+			assert.Equal(t, 10, size)
+		}
+	})
+
+	t.Run("last chunk is partial", func(t *testing.T) {
+		w, svc := createBatch(batch(25), 0)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []int{10, 10, 5}, svc.chunks)
+	})
+
+	t.Run("invalid user in first chunk rejects the batch", func(t *testing.T) {
+		w, svc := createBatch(batch(3, `{"first_name":"Bob"}`), 0)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, `{"error":"user 3: last name is required","index":3}`, w.Body.String())
+		assert.Empty(t, svc.chunks)
+	})
+
+	t.Run("invalid user stops the batch after created chunks", func(t *testing.T) {
+		w, svc := createBatch(batch(12, `{"first_name":"Bob"}`, user(13)), 0)
+
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		var resp struct {
+			Created []map[string]any   `json:"created"`
+			Failed  []batchItemFailure `json:"failed"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.Created, 10)
+		assert.Equal(t, []batchItemFailure{{Index: 12, Error: "user 12: last name is required"}}, resp.Failed)
+		assert.Equal(t, []int{10}, svc.chunks)
+	})
+
+	t.Run("body size limit", func(t *testing.T) {
+		w, svc := createBatch(batch(5), 100)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, `{"error":"payload is larger than 100 bytes","index":0}`, w.Body.String())
+		assert.Empty(t, svc.chunks)
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		w, _ := createBatch("[]", 0)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, `{"error":"at least one user is required"}`, w.Body.String())
+	})
+}
+
+func Test_CreateUsersHandler_MaxItems(t *testing.T) {
+	batch := func(n int) string {
+		users := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			users = append(users, fmt.Sprintf(`{"first_name":"Anna","last_name":"Alakava","nickname":"anna%d","password":"pwd","email":"ann%d@gmail.com","country":"UK"}`, i, i))
+		}
+		return "[" + strings.Join(users, ",") + "]"
+	}
+	createBatch := func(body string, opts ...Opt) (*httptest.ResponseRecorder, *chunkRecordingService) {
+		svc := &chunkRecordingService{ServiceMock: new(ServiceMock)}
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/users/batch", strings.NewReader(body))
+		createUsers(svc, newHandlersConfig(opts...))(ctx)
+		return w, svc
+	}
+	tooLarge := `{"error":"batch cannot have more than 5 users","code":"batch_too_large"}`
+
+	t.Run("at the limit", func(t *testing.T) {
+		w, svc := createBatch(batch(5), WithBatchLimits(5, 0))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []int{5}, svc.chunks)
+	})
+
+	t.Run("over the limit", func(t *testing.T) {
+		w, svc := createBatch(batch(6), WithBatchLimits(5, 0))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tooLarge, w.Body.String())
+		assert.Empty(t, svc.chunks)
+	})
+
+	t.Run("streamed at the limit", func(t *testing.T) {
+		w, svc := createBatch(batch(5), WithBatchLimits(5, 0), WithBatchStreaming(10, 0))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, []int{5}, svc.chunks)
+	})
+
+	t.Run("streamed over the limit", func(t *testing.T) {
+		w, svc := createBatch(batch(6), WithBatchLimits(5, 0), WithBatchStreaming(10, 0))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tooLarge, w.Body.String())
+		assert.Empty(t, svc.chunks)
+	})
+
+	t.Run("streamed over the limit after created chunk", func(t *testing.T) {
+		w, svc := createBatch(batch(6), WithBatchLimits(5, 0), WithBatchStreaming(2, 0))
+
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		var resp struct {
+			Created []map[string]any   `json:"created"`
+			Failed  []batchItemFailure `json:"failed"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.Created, 4)
+		assert.Equal(t, []batchItemFailure{{Index: 5, Error: "batch cannot have more than 5 users"}}, resp.Failed)
+		assert.Equal(t, []int{2, 2}, svc.chunks)
+	})
+}
+
+// blockingService blocks the batch creation until released.
+type blockingService struct {
+	*ServiceMock
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingService) CreateUsers(_ context.Context, users []model.User, _ bool) ([]model.User, []storage_err.BatchItemError, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return users, nil, nil
+}
+
+func Test_CreateUsersHandler_MaxConcurrency(t *testing.T) {
+	svc := &blockingService{ServiceMock: new(ServiceMock), started: make(chan struct{}), release: make(chan struct{})}
+	router := gin.New()
+	CreateUsersHandlers(router.Group("v1"), svc, WithBatchLimits(0, 1))
+	body := `[{"first_name":"Anna","last_name":"Alakava","nickname":"anna","password":"pwd","email":"ann@gmail.com","country":"UK"}]`
+	createBatch := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/users/batch", strings.NewReader(body)))
+		return w
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- createBatch() }()
+	<-svc.started
+
+	// the concurrent batch is rejected while the first one is processed
+	w := createBatch()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, `{"error":"too many concurrent batch operations","code":"unavailable"}`, w.Body.String())
+
+	svc.release <- struct{}{}
+	assert.Equal(t, http.StatusCreated, (<-first).Code)
+
+	// the slot is released after the batch
+	go func() { <-svc.started; svc.release <- struct{}{} }()
+	assert.Equal(t, http.StatusCreated, createBatch().Code)
+}
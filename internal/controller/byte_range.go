@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errRangeSatisfied stops the writing once the whole requested range is written.
+var errRangeSatisfied = errors.New("requested range is written")
+
+// byteRange is an inclusive range of the response bytes, end is -1 for the open-ended ranges.
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// parseByteRange parses a single byte range of the Range header e.g. bytes=100- or bytes=100-199.
+// Other ranges (suffix, multiple, other units) are not supported and false is returned, so the whole response is sent.
+func parseByteRange(header string) (byteRange, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return byteRange{}, false
+	}
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok || startStr == "" {
+		return byteRange{}, false
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false
+	}
+	if endStr == "" {
+		return byteRange{start: start, end: -1}, true
+	}
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil || end < start {
+		return byteRange{}, false
+	}
+	return byteRange{start: start, end: end}, true
+}
+
+// rangeWriter buffers only the bytes in the range and counts all the bytes written to it. The range is clamped to
+// the given maximum of the buffered bytes, so the open-ended ranges don't buffer the rest of the response.
+type rangeWriter struct {
+	buf       bytes.Buffer
+	r         byteRange
+	written   int64
+	satisfied bool
+}
+
+func newRangeWriter(r byteRange, maxBytes int64) *rangeWriter {
+	if r.end < 0 || r.end-r.start+1 > maxBytes {
+		r.end = r.start + maxBytes - 1
+	}
+	return &rangeWriter{r: r}
+}
+
+func (rw *rangeWriter) Write(p []byte) (int, error) {
+	if rw.written > rw.r.end {
+		rw.satisfied = true
+		return 0, errRangeSatisfied
+	}
+
+	from := rw.r.start - rw.written
+	to := int64(len(p))
+	if rw.r.end+1-rw.written < to {
+		to = rw.r.end + 1 - rw.written
+	}
+	rw.written += int64(len(p))
+	if from >= to {
+		return len(p), nil
+	}
+	if from < 0 {
+		from = 0
+	}
+	rw.buf.Write(p[from:to])
+	return len(p), nil
+}
+
+// contentRange returns the Content-Range of the buffered bytes. The complete length is known only when
+// the whole response was written before the range end.
+func (rw *rangeWriter) contentRange() string {
+	complete := "*"
+	if !rw.satisfied {
+		complete = strconv.FormatInt(rw.written, 10)
+	}
+	return fmt.Sprintf("bytes %d-%d/%s", rw.r.start, rw.r.start+int64(rw.buf.Len())-1, complete)
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseByteRange(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantRange byteRange
+		wantOk    bool
+	}{
+		{header: "bytes=100-", wantRange: byteRange{start: 100, end: -1}, wantOk: true},
+		{header: "bytes=100-199", wantRange: byteRange{start: 100, end: 199}, wantOk: true},
+		{header: "bytes=0-0", wantRange: byteRange{start: 0, end: 0}, wantOk: true},
+		{header: ""},
+		{header: "bytes=-100"},
+		{header: "bytes=0-10,20-30"},
+		{header: "bytes=20-10"},
+		{header: "bytes=a-"},
+		{header: "items=0-10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := parseByteRange(tt.header)
+
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantRange, got)
+		})
+	}
+}
+
+func Test_rangeWriter(t *testing.T) {
+	tests := []struct {
+		name             string
+		r                byteRange
+		maxBytes         int64
+		want             string
+		wantErr          bool
+		wantContentRange string
+	}{
+		{name: "open-ended", r: byteRange{start: 3, end: -1}, maxBytes: 100, want: "defghijkl", wantContentRange: "bytes 3-11/12"},
+		{name: "bounded across writes", r: byteRange{start: 2, end: 7}, maxBytes: 100, want: "cdefgh", wantErr: true, wantContentRange: "bytes 2-7/*"},
+		{name: "bounded past the data", r: byteRange{start: 8, end: 20}, maxBytes: 100, want: "ijkl", wantContentRange: "bytes 8-11/12"},
+		{name: "clamped to the max bytes", r: byteRange{start: 1, end: -1}, maxBytes: 5, want: "bcdef", wantErr: true, wantContentRange: "bytes 1-5/*"},
+		{name: "start beyond the data", r: byteRange{start: 20, end: -1}, maxBytes: 100, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := newRangeWriter(tt.r, tt.maxBytes)
+
+			var err error
+			for _, chunk := range []string{"abc", "def", "ghi", "jkl"} {
+				if _, err = rw.Write([]byte(chunk)); err != nil {
+					break
+				}
+			}
+
+			assert.Equal(t, tt.want, rw.buf.String())
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errRangeSatisfied)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.want != "" {
+				assert.Equal(t, tt.wantContentRange, rw.contentRange())
+			}
+		})
+	}
+}
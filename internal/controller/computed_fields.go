@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"user-service/internal/model"
+)
+
+const computeQueryParam = "compute"
+
+const (
+	// computeAge adds account_age_days, the number of the whole days since the user was created.
+	computeAge = "age"
+	// computeWeek adds created_week, the ISO week the user was created in e.g. 2024-W28.
+	computeWeek = "week"
+)
+
+// computedFields are the fields derived from the stored user fields that are added to the read responses
+// on request by the compute query parameter. They are never persisted.
+type computedFields struct {
+	age  bool
+	week bool
+	// now is the time the account age is computed at, the same for all the users of the response
+	now time.Time
+}
+
+// parseComputedFields parses the comma separated list of the fields to compute. Nil is returned if none is requested.
+func parseComputedFields(query string, ok bool) (*computedFields, *paramError) {
+	if !ok {
+		return nil, nil
+	}
+
+	fields := &computedFields{now: time.Now().UTC()}
+	for _, name := range strings.Split(query, ",") {
+		switch strings.TrimSpace(name) {
+		case computeAge:
+			fields.age = true
+		case computeWeek:
+			fields.week = true
+		default:
+			return nil, &paramError{
+				parameter: computeQueryParam,
+				code:      codeInvalidParameter,
+				msg:       fmt.Sprintf("compute query parameter supports only %s and %s fields", computeAge, computeWeek),
+			}
+		}
+	}
+	return fields, nil
+}
+
+// accountAgeDays returns the account age of the user, nil if not requested.
+func (f *computedFields) accountAgeDays(user model.User) *int {
+	if f == nil || !f.age {
+		return nil
+	}
+	days := int(f.now.Sub(user.CreatedAt) / (24 * time.Hour))
+	return &days
+}
+
+// createdWeek returns the ISO week of the user creation, nil if not requested.
+func (f *computedFields) createdWeek(user model.User) *string {
+	if f == nil || !f.week {
+		return nil
+	}
+	year, week := user.CreatedAt.UTC().ISOWeek()
+	formatted := fmt.Sprintf("%04d-W%02d", year, week)
+	return &formatted
+}
+
+// withComputedFields adds the computed fields to the user responses.
+func withComputedFields(resp []userResponse, fields *computedFields) []userResponse {
+	for i := range resp {
+		resp[i].computed = fields
+	}
+	return resp
+}
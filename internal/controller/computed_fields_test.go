@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func Test_GetUserHandler_ComputedFields(t *testing.T) {
+	// the ISO week of the last December days belongs to the next year
+	user := model.User{ID: uuid.New(), FirstName: "anna", CreatedAt: time.Date(2024, 12, 30, 10, 0, 0, 0, time.UTC)}
+	wantAge := float64(int(time.Since(user.CreatedAt).Hours() / 24))
+	serviceMock := new(ServiceMock)
+	serviceMock.On("GetUserByID", mock.Anything, user.ID).Return(&user, nil)
+
+	router := gin.New()
+	CreateUsersHandlers(router.Group("v1"), serviceMock)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantAge   any
+		wantWeek  any
+		wantError string
+	}{
+		{
+			name:     "not requested",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "age",
+			query:    "?compute=age",
+			wantCode: http.StatusOK,
+			wantAge:  wantAge,
+		},
+		{
+			name:     "age and week",
+			query:    "?compute=age,week",
+			wantCode: http.StatusOK,
+			wantAge:  wantAge,
+			wantWeek: "2025-W01",
+		},
+		{
+			name:      "unsupported field",
+			query:     "?compute=zodiac",
+			wantCode:  http.StatusBadRequest,
+			wantError: "compute query parameter supports only age and week fields",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/"+user.ID.String()+tt.query, nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			var body map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			if tt.wantError != "" {
+				assert.Equal(t, tt.wantError, body["error"])
+				return
+			}
+			assert.Equal(t, tt.wantAge, body["account_age_days"])
+			assert.Equal(t, tt.wantWeek, body["created_week"])
+		})
+	}
+}
+
+func Test_computedFields(t *testing.T) {
+	fields, err := parseComputedFields("age, week", true)
+	require.Nil(t, err)
+	fields.now = time.Date(2024, 7, 13, 9, 0, 0, 0, time.UTC)
+	user := model.User{CreatedAt: time.Date(2024, 7, 3, 10, 0, 0, 0, time.UTC)}
+
+	// not a whole day yet since the creation time on the tenth day
+	assert.Equal(t, 9, *fields.accountAgeDays(user))
+	assert.Equal(t, "2024-W27", *fields.createdWeek(user))
+
+	var none *computedFields
+	assert.Nil(t, none.accountAgeDays(user))
+	assert.Nil(t, none.createdWeek(user))
+}
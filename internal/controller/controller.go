@@ -2,220 +2,385 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"net/http"
-	"net/mail"
+	"strconv"
 	"time"
+	"user-service/internal/auth"
 	storage_err "user-service/internal/errors"
 	"user-service/internal/model"
 )
 
 type Service interface {
 	CreateUser(ctx context.Context, user model.User) (*model.User, error)
+	CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]model.User, []storage_err.BatchItemError, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error)
-	UpdateUser(ctx context.Context, user model.User) error
+	StreamUsers(ctx context.Context, params model.GetUsersParams, stream func(model.User) error) error
+	ExportUsers(ctx context.Context, maxUsers int, includeHidden bool, export func(model.User) error) (bool, error)
+	UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
+	TouchUser(ctx context.Context, id uuid.UUID) error
 }
 
 // CreateUsersHandlers registers users endpoint paths with handlers to given router.
-func CreateUsersHandlers(router *gin.RouterGroup, svc Service) {
+func CreateUsersHandlers(router *gin.RouterGroup, svc Service, opts ...Opt) {
+	cfg := newHandlersConfig(opts...)
+
 	usersGroup := router.Group("users")
-	usersGroup.POST("", createUser(svc))
-	usersGroup.PUT(fmt.Sprintf(":%s", userIDPathParam), updateUser(svc))
-	usersGroup.GET(fmt.Sprintf(":%s", userIDPathParam), getUser(svc))
-	usersGroup.DELETE(fmt.Sprintf(":%s", userIDPathParam), deleteUser(svc))
-	usersGroup.GET("", getUsers(svc))
+	if cfg.prettyJSON {
+		usersGroup.Use(prettyJSON(cfg))
+	}
+	usersGroup.Use(limitJSONDepth(cfg.maxJSONDepth))
+	createFields := createPayloadFields
+	if cfg.clientTimestamps {
+		createFields = importPayloadFields
+	}
+	readOnly := rejectWritesIfReadOnly(cfg)
+	usersGroup.POST("", readOnly, allowedPayloadFields(cfg, createFields, "create"), createUser(svc, cfg))
+	usersGroup.POST("batch", readOnly, limitConcurrentBatches(cfg), createUsers(svc, cfg))
+	usersGroup.PUT(fmt.Sprintf(":%s", userIDPathParam), readOnly, allowedPayloadFields(cfg, updatePayloadFields, "update"), updateUser(svc, cfg))
+	usersGroup.GET(fmt.Sprintf(":%s", userIDPathParam), varyOnAccept(), getUser(svc, cfg))
+	usersGroup.GET(fmt.Sprintf(":%s/profile", userIDPathParam), requireAuthenticatedCaller(cfg), getUserProfile(svc, cfg))
+	usersGroup.DELETE(fmt.Sprintf(":%s", userIDPathParam), readOnly, deleteUser(svc, cfg))
+	usersGroup.POST(fmt.Sprintf(":%s/touch", userIDPathParam), readOnly, touchUser(svc, cfg))
+	usersGroup.GET("", varyOnAccept(), getUsers(svc, cfg))
+	usersGroup.OPTIONS("", describeUsersList(cfg))
+	usersGroup.GET("export", requireAdminCaller(cfg), exportUsers(svc, cfg))
+	if cfg.eventsSubscriber != nil {
+		// the events can't be told apart for the hidden users, so only the admins see the stream
+		usersGroup.GET("stream", requireAdminCaller(cfg), streamUserEvents(cfg.eventsSubscriber, cfg))
+	}
+}
+
+// createUserRequest is the user creation payload.
+type createUserRequest struct {
+	model.User
+	// CreatedAt and UpdatedAt shadow the user timestamps, so the provided zero timestamps can be told apart from the absent ones.
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// withTimestamps returns the user with the provided timestamps, the absent ones are left zero to be set by the server.
+func (r createUserRequest) withTimestamps(user model.User) model.User {
+	if r.CreatedAt != nil {
+		user.CreatedAt = *r.CreatedAt
+	}
+	if r.UpdatedAt != nil {
+		user.UpdatedAt = *r.UpdatedAt
+	}
+	return user
 }
 
 // createUser returns a handler that handles user creation.
-func createUser(svc Service) gin.HandlerFunc {
+func createUser(svc Service, cfg handlersConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user model.User
-		if err := c.BindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			c.Abort()
+		var req createUserRequest
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
 			return
 		}
+		// the timestamps are set by the server unless the client ones are allowed
+		user := req.User
 
-		if err := validateRequiredRequestFields(user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			c.Abort()
+		if err := validateUser(c, user, cfg); err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
 			return
 		}
+		normalizeUser(&user)
+
+		if cfg.clientTimestamps {
+			if err := validateTimestamps(req, time.Now()); err != nil {
+				respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
+				return
+			}
+			user = req.withTimestamps(user)
+		}
 
+		dryRun, paramErr := startDryRun(c)
+		if paramErr != nil {
+			respondError(c, http.StatusBadRequest, paramErr.apiError(), cfg)
+			return
+		}
+		// the dry run captures the events itself, the echo would hide them from it
+		capture := dryRun
+		if capture == nil {
+			capture = captureEvents(c, cfg)
+		}
 		createdUser, err := svc.CreateUser(c, user)
 		if err != nil {
-			logrus.WithError(err).
-				WithField("user_id", user.ID).
-				Error("failed to create user")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "user not created"})
-			c.Abort()
+			respondServiceError(c, err, cfg)
 			return
 		}
 
-		c.JSON(http.StatusCreated, createdUser)
+		resp := newUserResponse(*createdUser, cfg)
+		if dryRun != nil {
+			c.JSON(http.StatusOK, newDryRunResponse(dryRun, &resp, cfg))
+			return
+		}
+		if capture != nil {
+			c.JSON(http.StatusCreated, newEventEchoResponse(capture, &resp, cfg))
+			return
+		}
+		c.JSON(http.StatusCreated, resp)
 	}
 }
 
 // getUser returns a handler that handles user retrieval by ID.
-func getUser(svc Service) gin.HandlerFunc {
+func getUser(svc Service, cfg handlersConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, err := uuid.Parse(c.Param(userIDPathParam))
+		userID, err := parseUserID(c, cfg)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("incorrect user ID format: %v", err.Error())})
-			c.Abort()
+			respondError(c, http.StatusBadRequest, apiError{Error: fmt.Sprintf("incorrect user ID format: %v", err.Error())}, cfg)
+			return
+		}
+
+		computed, paramErr := parseComputedFields(c.GetQuery(computeQueryParam))
+		if paramErr != nil {
+			respondError(c, http.StatusBadRequest, paramErr.apiError(), cfg)
 			return
 		}
 
 		user, err := svc.GetUserByID(c, userID)
 		if err != nil {
-			if errors.Is(err, storage_err.NotFoundError) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				c.Abort()
-				return
-			}
-			logrus.WithError(err).
-				WithField("user_id", userID).
-				Error("failed to get user")
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
+			respondServiceError(c, err, cfg)
 			return
 		}
 
-		c.JSON(http.StatusOK, *user)
+		resp := newUserResponse(*user, cfg)
+		resp.computed = computed
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
 // getUsers returns a handler that handles the users retrieval from the DB based on url params.
-func getUsers(svc Service) gin.HandlerFunc {
+func getUsers(svc Service, cfg handlersConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		params, err := parseGetUsersParams(c)
+		params, err := parseGetUsersParams(c, cfg)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			c.Abort()
+			var paramErr *paramError
+			if errors.As(err, &paramErr) {
+				respondError(c, http.StatusBadRequest, paramErr.apiError(), cfg)
+				return
+			}
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
+			return
+		}
+		computed, paramErr := parseComputedFields(c.GetQuery(computeQueryParam))
+		if paramErr != nil {
+			respondError(c, http.StatusBadRequest, paramErr.apiError(), cfg)
+			return
+		}
+		// the hidden users e.g. the service accounts are listed only to the admins
+		if params.IncludeHidden && !auth.IsAdmin(c.Request.Context()) {
+			respondError(c, http.StatusForbidden, apiError{
+				Error:     "including the hidden users requires an admin caller",
+				Code:      codeForbidden,
+				Parameter: includeHiddenQueryParam,
+			}, cfg)
+			return
+		}
+
+		if cfg.listStreaming {
+			streamUsersList(c, svc, *params, computed, cfg)
 			return
 		}
 
+		params.PeekNext = cfg.resultTruncated
 		users, err := svc.GetUsers(c, *params)
 		if err != nil {
-			logrus.WithError(err).Error("failed to get users")
-			c.Status(http.StatusInternalServerError)
-			c.Abort()
+			respondServiceError(c, err, cfg)
 			return
 		}
 
-		if len(users) == 0 {
-			c.JSON(http.StatusOK, []model.User{})
+		if len(users) == 0 && cfg.emptyListNoContent {
+			c.Status(http.StatusNoContent)
 			return
 		}
 
-		c.JSON(http.StatusOK, users)
+		if cfg.resultTruncated {
+			// the peeked user tells there are more users than returned
+			truncated := len(users) > params.PageSize
+			if truncated {
+				users = users[:params.PageSize]
+			}
+			c.Header(resultTruncatedHeader, strconv.FormatBool(truncated))
+			c.JSON(http.StatusOK, usersListResponse{Users: withComputedFields(newUsersResponse(users, cfg), computed), Truncated: truncated})
+			return
+		}
+
+		c.JSON(http.StatusOK, withComputedFields(newUsersResponse(users, cfg), computed))
+	}
+}
+
+// streamUsersList writes the users list as a JSON array while the users are read from the DB cursor,
+// the list is never buffered.
+func streamUsersList(c *gin.Context, svc Service, params model.GetUsersParams, computed *computedFields, cfg handlersConfig) {
+	// the headers are sent with the first written byte, so they can still be changed when no user is streamed
+	c.Header("Content-Type", jsonContentType)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	streamed := 0
+	err := svc.StreamUsers(c, params, func(user model.User) error {
+		if err := writeArrayDelimiter(c.Writer, streamed); err != nil {
+			return err
+		}
+		streamed++
+		resp := newUserResponse(user, cfg)
+		resp.computed = computed
+		return encoder.Encode(resp)
+	})
+	if err == nil && streamed == 0 && cfg.emptyListNoContent {
+		c.Writer.Header().Del("Content-Type")
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if err == nil {
+		err = writeArrayEnd(c.Writer, streamed)
+	}
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			respondServiceError(c, err, cfg)
+			return
+		}
+		// the status is already sent, missing closing bracket of the array tells the client the list is incomplete
+		logrus.WithError(err).Error("users list streaming failed mid-stream")
+		c.Abort()
 	}
 }
 
+// updateUserRequest is the user update payload.
+type updateUserRequest struct {
+	model.User
+	// ID shadows the user ID, so the body accepts the ID as encoded by the configured ID codec in the responses.
+	ID string `json:"id"`
+	// If are the expected current field values, the user is updated only if all of them match (compare-and-set).
+	If model.ExpectedFields `json:"if"`
+}
+
 // updateUser returns a handler that handles user update.
-func updateUser(svc Service) gin.HandlerFunc {
+func updateUser(svc Service, cfg handlersConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user model.User
-
-		if err := c.BindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			c.Abort()
+		var req updateUserRequest
+		if err := c.BindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
+			return
+		}
+		user := req.User
+		if err := req.If.Validate(); err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
 			return
 		}
 
-		if err := validateRequiredRequestFields(user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			c.Abort()
+		if err := validateUpdatedUser(c, user, cfg); err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
 			return
 		}
+		normalizeUser(&user)
 
-		userID, err := uuid.Parse(c.Param(userIDPathParam))
+		userID, err := parseUserID(c, cfg)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("incorrect user ID format: %v", err.Error())})
-			c.Abort()
+			respondError(c, http.StatusBadRequest, apiError{Error: fmt.Sprintf("incorrect user ID format: %v", err.Error())}, cfg)
 			return
 		}
 
+		if cfg.rejectMismatchedBodyID && req.ID != "" {
+			bodyID, err := cfg.idCodec.Decode(req.ID)
+			if err != nil || bodyID != userID {
+				respondError(c, http.StatusBadRequest, apiError{Error: "id in body does not match path"}, cfg)
+				return
+			}
+		}
+		// the update time is stamped by the service
 		user.ID = userID
-		// db precision is in millis - doesn't support nanos
-		user.UpdatedAt = time.Now().Truncate(time.Millisecond)
 
-		err = svc.UpdateUser(c, user)
+		dryRun, paramErr := startDryRun(c)
+		if paramErr != nil {
+			respondError(c, http.StatusBadRequest, paramErr.apiError(), cfg)
+			return
+		}
+		capture := dryRun
+		if capture == nil {
+			capture = captureEvents(c, cfg)
+		}
+		err = svc.UpdateUser(c, user, req.If)
 		if err != nil {
-			if errors.Is(err, storage_err.NotFoundError) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				c.Abort()
-				return
-			} else {
-				logrus.WithError(err).
-					WithField("user_id", userID).
-					Error("failed to update user")
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "user not updated"})
-				c.Abort()
-				return
-			}
+			respondServiceError(c, err, cfg)
+			return
+		}
+
+		if dryRun != nil {
+			c.JSON(http.StatusOK, newDryRunResponse(dryRun, nil, cfg))
+			return
 		}
 
+		if capture != nil {
+			c.JSON(http.StatusOK, newEventEchoResponse(capture, nil, cfg))
+			return
+		}
 		c.Status(http.StatusNoContent)
 	}
 }
 
 // deleteUser returns a handler that handles user removal.
-func deleteUser(svc Service) gin.HandlerFunc {
+func deleteUser(svc Service, cfg handlersConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, err := uuid.Parse(c.Param(userIDPathParam))
+		userID, err := parseUserID(c, cfg)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("incorrect user ID format: %v", err.Error())})
-			c.Abort()
+			respondError(c, http.StatusBadRequest, apiError{Error: fmt.Sprintf("incorrect user ID format: %v", err.Error())}, cfg)
 			return
 		}
 
+		dryRun, paramErr := startDryRun(c)
+		if paramErr != nil {
+			respondError(c, http.StatusBadRequest, paramErr.apiError(), cfg)
+			return
+		}
+		capture := dryRun
+		if capture == nil {
+			capture = captureEvents(c, cfg)
+		}
 		err = svc.DeleteUser(c, userID)
 		if err != nil {
-			if errors.Is(err, storage_err.NotFoundError) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				c.Abort()
-				return
-			}
-			logrus.WithError(err).
-				WithField("user_id", userID).
-				Error("failed to delete user")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "user not deleted"})
-			c.Abort()
+			respondServiceError(c, err, cfg)
+			return
+		}
+
+		if dryRun != nil {
+			c.JSON(http.StatusOK, newDryRunResponse(dryRun, nil, cfg))
 			return
 		}
 
+		if capture != nil {
+			c.JSON(http.StatusOK, newEventEchoResponse(capture, nil, cfg))
+			return
+		}
 		c.Status(http.StatusNoContent)
 	}
 }
 
-func validateRequiredRequestFields(u model.User) error {
-	if u.FirstName == "" {
-		return errors.New("first name is required")
-	}
-	if u.LastName == "" {
-		return errors.New("last name is required")
-	}
-	if u.Nickname == "" {
-		return errors.New("nickname is required")
-	}
-	if u.Password == "" {
-		return errors.New("password is required")
-	}
-	if u.Email == "" {
-		return errors.New("email is required")
-	}
-	if _, err := mail.ParseAddress(u.Email); err != nil {
-		return errors.New("email is invalid")
-	}
-	if u.Country == "" {
-		return errors.New("country is required")
+// touchUser returns a handler that bumps the user update time without changing its data, producing user updated event.
+func touchUser(svc Service, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := parseUserID(c, cfg)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: fmt.Sprintf("incorrect user ID format: %v", err.Error())}, cfg)
+			return
+		}
+
+		if err := svc.TouchUser(c, userID); err != nil {
+			respondServiceError(c, err, cfg)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
 	}
-	return nil
 }
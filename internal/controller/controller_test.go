@@ -2,16 +2,26 @@ package controller
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+	"user-service/internal/auth"
+	storage_err "user-service/internal/errors"
 	"user-service/internal/model"
+	"user-service/internal/service"
 )
 
 // Unit tests that cover the User Creation handler logic. In a real project I would cover
@@ -53,6 +63,19 @@ func Test_CreateUserHandler(t *testing.T) {
 			wantStatusCode:  http.StatusBadRequest,
 			wantFailureBody: "{\"error\":\"first name is required\"}",
 		},
+		{
+			name: "invalid payload - nickname too long",
+			payload: model.User{
+				FirstName: "valid",
+				LastName:  "valid",
+				Nickname:  strings.Repeat("n", 257),
+				Password:  "valid",
+				Country:   "valid",
+				Email:     "valid@gmail.com",
+			},
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: "{\"error\":\"nickname is too long, maximum is 256 characters\"}",
+		},
 		{
 			name: "Service call fails",
 			payload: model.User{
@@ -65,7 +88,22 @@ func Test_CreateUserHandler(t *testing.T) {
 			},
 			serviceError:      errors.New("DB error"),
 			wantStatusCode:    http.StatusInternalServerError,
-			wantFailureBody:   "{\"error\":\"user not created\"}",
+			wantFailureBody:   `{"error":"internal server error","code":"internal_error"}`,
+			wantServiceCalled: true,
+		},
+		{
+			name: "nickname conflict",
+			payload: model.User{
+				FirstName: "valid",
+				LastName:  "valid",
+				Nickname:  "valid",
+				Password:  "valid",
+				Country:   "valid",
+				Email:     "valid@gmail.com",
+			},
+			serviceError:      storage_err.NewConflictError("nickname is already taken in the country"),
+			wantStatusCode:    http.StatusConflict,
+			wantFailureBody:   `{"error":"nickname is already taken in the country","code":"conflict"}`,
 			wantServiceCalled: true,
 		},
 		{
@@ -80,7 +118,7 @@ func Test_CreateUserHandler(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			serviceMock := new(ServiceMock)
 
-			createUserHandler := createUser(serviceMock)
+			createUserHandler := createUser(serviceMock, newHandlersConfig())
 			w := httptest.NewRecorder()
 			ctx, _ := gin.CreateTestContext(w)
 
@@ -94,7 +132,7 @@ func Test_CreateUserHandler(t *testing.T) {
 				reqPayload = bytes.NewReader(requestPayload)
 			}
 
-			ctx.Request = &http.Request{Body: io.NopCloser(reqPayload)}
+			ctx.Request = &http.Request{URL: &url.URL{}, Body: io.NopCloser(reqPayload)}
 
 			if tt.wantServiceCalled {
 				serviceMock.On("CreateUser", ctx, tt.payload).Return(&tt.payload, tt.serviceError)
@@ -118,120 +156,752 @@ func Test_CreateUserHandler(t *testing.T) {
 	}
 }
 
-func Test_validateRequiredRequestFields(t *testing.T) {
+func Test_GetUsersHandler_MaxPageSize(t *testing.T) {
 	tests := []struct {
-		name          string
-		user          model.User
-		wantErr       bool
-		wantErrString string
+		name              string
+		query             string
+		wantStatusCode    int
+		wantFailureBody   string
+		wantServiceCalled bool
 	}{
 		{
-			name: "valid user",
-			user: model.User{
-				FirstName: "valid",
-				LastName:  "valid",
-				Nickname:  "valid",
-				Password:  "valid",
-				Email:     "valid@gmail.com",
-				Country:   "valid",
-			},
-			wantErr: false,
+			name:              "page size within max",
+			query:             "pageSize=5",
+			wantStatusCode:    http.StatusOK,
+			wantServiceCalled: true,
 		},
 		{
-			name: "firstname missing user",
-			user: model.User{
-				FirstName: "",
-				LastName:  "valid",
-				Nickname:  "valid",
-				Password:  "valid",
-				Email:     "valid@gmail.com",
-				Country:   "valid",
-			},
-			wantErr:       true,
-			wantErrString: "first name is required",
+			name:            "page size over max",
+			query:           "pageSize=6",
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"pageSize query parameter cannot be bigger than 5","code":"parameter_out_of_range","parameter":"pageSize"}`,
 		},
 		{
-			name: "last name missing",
-			user: model.User{
-				FirstName: "valid",
-				Nickname:  "valid",
-				Password:  "valid",
-				Email:     "valid@gmail.com",
-				Country:   "valid",
-			},
-			wantErr:       true,
-			wantErrString: "last name is required",
+			name:            "page not a number",
+			query:           "page=first",
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"page query parameter has to be a number","code":"invalid_parameter","parameter":"page"}`,
 		},
 		{
-			name: "nickname missing",
-			user: model.User{
-				FirstName: "valid",
-				LastName:  "valid",
-				Password:  "valid",
-				Email:     "valid@gmail.com",
-				Country:   "valid",
-			},
-			wantErr:       true,
-			wantErrString: "nickname is required",
+			name:            "unsupported sort field",
+			query:           "sortBy=age.asc",
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"unsupported sorting field","code":"unsupported_parameter_value","parameter":"sortBy"}`,
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+
+			getUsersHandler := getUsers(serviceMock, newHandlersConfig(WithMaxPageSize(5)))
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = &http.Request{URL: &url.URL{RawQuery: tt.query}}
+
+			if tt.wantServiceCalled {
+				serviceMock.On("GetUsers", ctx, mock.Anything).Return([]model.User{}, nil)
+			}
+
+			// call the handler
+			getUsersHandler(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantFailureBody != "" {
+				assert.Equal(t, tt.wantFailureBody, w.Body.String())
+			}
+
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_GetUsersHandler_EmptyResult(t *testing.T) {
+	tests := []struct {
+		name           string
+		noContent      bool
+		users          []model.User
+		wantStatusCode int
+		wantBody       string
+	}{
 		{
-			name: "password missing",
-			user: model.User{
-				FirstName: "valid",
-				LastName:  "valid",
-				Nickname:  "valid",
-				Email:     "valid@gmail.com",
-				Country:   "valid",
-			},
-			wantErr:       true,
-			wantErrString: "password is required",
+			name:           "empty array by default",
+			users:          []model.User{},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "[]",
 		},
 		{
-			name: "email missing",
-			user: model.User{
-				FirstName: "valid",
-				LastName:  "valid",
-				Nickname:  "valid",
-				Password:  "valid",
-				Country:   "valid",
-			},
-			wantErr:       true,
-			wantErrString: "email is required",
+			name:           "no content mode",
+			noContent:      true,
+			users:          []model.User{},
+			wantStatusCode: http.StatusNoContent,
 		},
 		{
-			name: "email invalid",
-			user: model.User{
-				FirstName: "valid",
-				LastName:  "valid",
-				Nickname:  "valid",
-				Password:  "valid",
-				Email:     "invalid",
-				Country:   "valid",
-			},
-			wantErr:       true,
-			wantErrString: "email is invalid",
+			name:           "no content mode with users",
+			noContent:      true,
+			users:          []model.User{{FirstName: "John"}},
+			wantStatusCode: http.StatusOK,
+			wantBody: `[{"id":"00000000-0000-0000-0000-000000000000","first_name":"John","last_name":"","nickname":"",` +
+				`"email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+
+			getUsersHandler := getUsers(serviceMock, newHandlersConfig(WithEmptyListNoContent(tt.noContent)))
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = &http.Request{URL: &url.URL{}}
+
+			serviceMock.On("GetUsers", ctx, mock.Anything).Return(tt.users, nil)
+
+			// call the handler, the engine writes the header of bodiless responses after it
+			getUsersHandler(ctx)
+			ctx.Writer.WriteHeaderNow()
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_Handlers_CircuitOpen(t *testing.T) {
+	userID := uuid.New()
+	serviceMock := new(ServiceMock)
+	serviceMock.On("GetUserByID", mock.Anything, userID).Return((*model.User)(nil), storage_err.CircuitOpenError)
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Params = gin.Params{{Key: userIDPathParam, Value: userID.String()}}
+
+	getUser(serviceMock, newHandlersConfig())(ctx)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"error":"service temporarily unavailable","code":"unavailable"}`, w.Body.String())
+	serviceMock.AssertExpectations(t)
+}
+
+func Test_Handlers_IDCodec(t *testing.T) {
+	userID := uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")
+	encodedID := Base62Codec{}.Encode(userID)
+	serviceMock := new(ServiceMock)
+	serviceMock.On("GetUserByID", mock.Anything, userID).Return(&model.User{ID: userID, FirstName: "John"}, nil)
+
+	router := gin.New()
+	CreateUsersHandlers(router.Group("v1"), serviceMock, WithIDCodec(Base62Codec{}))
+
+	// encoded ID is decoded from the path and encoded in the response
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/"+encodedID, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"id":"`+encodedID+`","first_name":"John","last_name":"","nickname":"","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`, w.Body.String())
+
+	// UUID is not accepted by the non-default codec
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/"+userID.String(), nil))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	serviceMock.AssertExpectations(t)
+}
+
+func Test_UpdateUserHandler_ExpectedFields(t *testing.T) {
+	userID := uuid.New()
+	body := `{"first_name":"John","last_name":"Wick","nickname":"johnny","password":"pwd","email":"john@gmail.com","country":"GB"%s}`
+
+	tests := []struct {
+		name           string
+		ifBlock        string
+		wantExpected   model.ExpectedFields
+		serviceError   error
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "no expectation",
+			wantStatusCode: http.StatusNoContent,
 		},
 		{
-			name: "country missing",
-			user: model.User{
-				FirstName: "valid",
-				LastName:  "valid",
-				Nickname:  "valid",
-				Password:  "valid",
-				Email:     "valid@gmail.com",
-			},
-			wantErr:       true,
-			wantErrString: "country is required",
+			name:           "matching expectation",
+			ifBlock:        `,"if":{"country":"UK"}`,
+			wantExpected:   model.ExpectedFields{"country": "UK"},
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "non-matching expectation",
+			ifBlock:        `,"if":{"country":"DE"}`,
+			wantExpected:   model.ExpectedFields{"country": "DE"},
+			serviceError:   storage_err.PreconditionFailedError,
+			wantStatusCode: http.StatusPreconditionFailed,
+			wantBody:       `{"error":"user doesn't match the expected field values","code":"precondition_failed"}`,
+		},
+		{
+			name:           "field cannot be expected",
+			ifBlock:        `,"if":{"password":"secret"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"field password cannot be expected"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			if tt.wantStatusCode != http.StatusBadRequest {
+				serviceMock.On("UpdateUser", mock.Anything, mock.Anything, tt.wantExpected).Return(tt.serviceError)
+			}
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Params = gin.Params{{Key: userIDPathParam, Value: userID.String()}}
+			ctx.Request = httptest.NewRequest(http.MethodPut, "/v1/users/"+userID.String(), strings.NewReader(fmt.Sprintf(body, tt.ifBlock)))
+
+			updateUser(serviceMock, newHandlersConfig())(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, ctx.Writer.Status())
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+// storedUserStub is the storage of a single stored user, the storage methods not needed by the update are not implemented.
+type storedUserStub struct {
+	service.UsersStorage
+	stored  model.User
+	updated []model.User
+}
+
+func (s *storedUserStub) GetUserByID(_ context.Context, _ uuid.UUID) (*model.User, error) {
+	return &s.stored, nil
+}
+
+func (s *storedUserStub) UpdateUser(_ context.Context, user model.User, _ model.ExpectedFields) (*model.User, error) {
+	s.updated = append(s.updated, user)
+	return &user, nil
+}
+
+func (s *storedUserStub) MatchesExpected(user model.User, expected model.ExpectedFields) bool {
+	return expected.Match(user)
+}
+
+type noopEventsProducer struct{}
+
+func (noopEventsProducer) Produce(any) error {
+	return nil
+}
+
+func Test_UpdateUserHandler_ImmutableFields(t *testing.T) {
+	userID := uuid.New()
+	body := `{"first_name":"%s","last_name":"Wick","nickname":"johnny","password":"pwd","email":"%s","country":"UK"}`
+
+	tests := []struct {
+		name           string
+		svcOpts        []service.Opt
+		firstName      string
+		email          string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "email change rejected when immutable",
+			svcOpts:        []service.Opt{service.WithImmutableFields("email")},
+			firstName:      "John",
+			email:          "johnny@gmail.com",
+			wantStatusCode: http.StatusConflict,
+			wantBody:       `{"error":"email cannot be changed by update, it has to be changed by its dedicated flow","code":"conflict"}`,
+		},
+		{
+			name:           "other changes allowed when email is immutable",
+			svcOpts:        []service.Opt{service.WithImmutableFields("email")},
+			firstName:      "Johnny",
+			email:          "john@gmail.com",
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "email change allowed by default",
+			firstName:      "John",
+			email:          "johnny@gmail.com",
+			wantStatusCode: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &storedUserStub{stored: model.User{
+				ID: userID, FirstName: "John", LastName: "Wick", Nickname: "johnny", Password: "pwd", Email: "john@gmail.com", Country: "UK",
+			}}
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), service.New(storage, noopEventsProducer{}, tt.svcOpts...))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/v1/users/"+userID.String(),
+				strings.NewReader(fmt.Sprintf(body, tt.firstName, tt.email))))
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			if tt.wantStatusCode == http.StatusConflict {
+				assert.Empty(t, storage.updated)
+			} else {
+				assert.Len(t, storage.updated, 1)
+			}
+		})
+	}
+}
+
+func Test_CreateUserHandler_DBValidationError(t *testing.T) {
+	details := map[string]any{"details": map[string]any{"operatorName": "$jsonSchema"}}
+	body := `{"first_name":"John","last_name":"Wick","nickname":"johnny","password":"pwd","email":"john@gmail.com","country":"UK"}`
+
+	tests := []struct {
+		name     string
+		opts     []Opt
+		wantBody string
+	}{
+		{
+			name:     "with details",
+			wantBody: `{"error":"user failed the DB validation","code":"validation_failed","details":{"details":{"operatorName":"$jsonSchema"}}}`,
+		},
+		{
+			name:     "details disabled",
+			opts:     []Opt{WithValidationErrorDetails(false)},
+			wantBody: `{"error":"user failed the DB validation","code":"validation_failed"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			serviceMock.On("CreateUser", mock.Anything, mock.Anything).
+				Return((*model.User)(nil), storage_err.NewValidationError("user failed the DB validation", details))
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+
+			createUser(serviceMock, newHandlersConfig(tt.opts...))(ctx)
+
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_CreateUserHandler_ClientTimestamps(t *testing.T) {
+	fields := `"first_name":"John","last_name":"Wick","nickname":"johnny","password":"pwd","email":"john@gmail.com","country":"UK"`
+	createdAt := time.Date(2024, 7, 13, 9, 19, 54, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		timestamps     string
+		opts           []Opt
+		wantCreatedAt  time.Time
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "provided timestamps",
+			timestamps:     `,"created_at":"2024-07-13T09:19:54Z","updated_at":"2024-07-13T09:19:54Z"`,
+			opts:           []Opt{WithClientTimestamps(true)},
+			wantCreatedAt:  createdAt,
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "absent timestamps set by server",
+			opts:           []Opt{WithClientTimestamps(true)},
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "explicit zero timestamps rejected",
+			timestamps:     `,"created_at":"0001-01-01T00:00:00Z","updated_at":"2024-07-13T09:19:54Z"`,
+			opts:           []Opt{WithClientTimestamps(true)},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"created_at cannot be zero"}`,
+		},
+		{
+			name:           "timestamps ignored unless allowed",
+			timestamps:     `,"created_at":"2024-07-13T09:19:54Z","updated_at":"2024-07-13T09:19:54Z"`,
+			wantStatusCode: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			if tt.wantStatusCode == http.StatusCreated {
+				serviceMock.On("CreateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+					return u.CreatedAt.Equal(tt.wantCreatedAt) && u.UpdatedAt.Equal(tt.wantCreatedAt)
+				})).Return(&model.User{}, nil)
+			}
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader("{"+fields+tt.timestamps+"}"))
+
+			createUser(serviceMock, newHandlersConfig(tt.opts...))(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_UpdateUserHandler_BodyID(t *testing.T) {
+	userID := uuid.New()
+	body := `{%s"first_name":"John","last_name":"Wick","nickname":"johnny","password":"pwd","email":"john@gmail.com","country":"GB"}`
+
+	tests := []struct {
+		name           string
+		bodyID         string
+		base62         bool
+		opts           []Opt
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "matching body id",
+			bodyID:         fmt.Sprintf(`"id":"%s",`, userID),
+			opts:           []Opt{WithRejectMismatchedBodyID(true)},
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "mismatching body id rejected",
+			bodyID:         fmt.Sprintf(`"id":"%s",`, uuid.New()),
+			opts:           []Opt{WithRejectMismatchedBodyID(true)},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"id in body does not match path"}`,
+		},
+		{
+			name:           "matching base62 body id",
+			bodyID:         fmt.Sprintf(`"id":"%s",`, Base62Codec{}.Encode(userID)),
+			base62:         true,
+			opts:           []Opt{WithRejectMismatchedBodyID(true), WithIDCodec(Base62Codec{})},
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "mismatching base62 body id rejected",
+			bodyID:         fmt.Sprintf(`"id":"%s",`, Base62Codec{}.Encode(uuid.New())),
+			base62:         true,
+			opts:           []Opt{WithRejectMismatchedBodyID(true), WithIDCodec(Base62Codec{})},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"id in body does not match path"}`,
+		},
+		{
+			name:           "uuid body id rejected with base62 codec",
+			bodyID:         fmt.Sprintf(`"id":"%s",`, userID),
+			base62:         true,
+			opts:           []Opt{WithRejectMismatchedBodyID(true), WithIDCodec(Base62Codec{})},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"id in body does not match path"}`,
+		},
+		{
+			name:           "absent body id",
+			opts:           []Opt{WithRejectMismatchedBodyID(true)},
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "mismatching body id overwritten by default",
+			bodyID:         fmt.Sprintf(`"id":"%s",`, uuid.New()),
+			wantStatusCode: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			if tt.wantStatusCode != http.StatusBadRequest {
+				serviceMock.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+					return u.ID == userID
+				}), model.ExpectedFields(nil)).Return(nil)
+			}
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			pathID := userID.String()
+			if tt.base62 {
+				pathID = Base62Codec{}.Encode(userID)
+			}
+			ctx.Params = gin.Params{{Key: userIDPathParam, Value: pathID}}
+			ctx.Request = httptest.NewRequest(http.MethodPut, "/v1/users/"+pathID, strings.NewReader(fmt.Sprintf(body, tt.bodyID)))
+
+			updateUser(serviceMock, newHandlersConfig(tt.opts...))(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, ctx.Writer.Status())
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_UpdateUserHandler_HashedEmails(t *testing.T) {
+	userID := uuid.New()
+	body := `{"first_name":"John","last_name":"Wick","nickname":"johnny","password":"pwd","country":"GB"}`
+
+	tests := []struct {
+		name           string
+		opts           []Opt
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "omitted email keeps the stored hashed one",
+			opts:           []Opt{WithHashedEmails(true)},
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "email required without hashed emails",
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"email is required"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			if tt.wantStatusCode == http.StatusNoContent {
+				serviceMock.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+					return u.ID == userID && u.Email == ""
+				}), model.ExpectedFields(nil)).Return(nil)
+			}
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Params = gin.Params{{Key: userIDPathParam, Value: userID.String()}}
+			ctx.Request = httptest.NewRequest(http.MethodPut, "/v1/users/"+userID.String(), strings.NewReader(body))
+
+			updateUser(serviceMock, newHandlersConfig(tt.opts...))(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, ctx.Writer.Status())
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_GetUsersHandler_ResultTruncated(t *testing.T) {
+	anna := model.User{FirstName: "Anna"}
+	bob := model.User{FirstName: "Bob"}
+	annaJSON := `{"id":"00000000-0000-0000-0000-000000000000","first_name":"Anna","last_name":"","nickname":"",` +
+		`"email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		name       string
+		users      []model.User
+		wantHeader string
+		wantBody   string
+	}{
+		{
+			name:       "capped result",
+			users:      []model.User{anna, bob},
+			wantHeader: "true",
+			wantBody:   `{"users":[` + annaJSON + `],"truncated":true}`,
+		},
+		{
+			name:       "full result",
+			users:      []model.User{anna},
+			wantHeader: "false",
+			wantBody:   `{"users":[` + annaJSON + `],"truncated":false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+
+			getUsersHandler := getUsers(serviceMock, newHandlersConfig(WithResultTruncated(true)))
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = &http.Request{URL: &url.URL{RawQuery: "pageSize=1"}}
+
+			serviceMock.On("GetUsers", ctx, mock.MatchedBy(func(p model.GetUsersParams) bool {
+				return p.PageSize == 1 && p.PeekNext
+			})).Return(tt.users, nil)
+
+			getUsersHandler(ctx)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantHeader, w.Header().Get(resultTruncatedHeader))
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_GetUsersHandler_Streaming(t *testing.T) {
+	anna := model.User{FirstName: "Anna"}
+	bob := model.User{FirstName: "Bob"}
+	annaJSON := `{"id":"00000000-0000-0000-0000-000000000000","first_name":"Anna","last_name":"","nickname":"",` +
+		`"email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`
+	bobJSON := `{"id":"00000000-0000-0000-0000-000000000000","first_name":"Bob","last_name":"","nickname":"",` +
+		`"email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		name         string
+		opts         []Opt
+		users        []model.User
+		serviceError error
+		wantStatus   int
+		wantBody     string
+	}{
+		{
+			name:       "no user",
+			wantStatus: http.StatusOK,
+			wantBody:   `[]`,
+		},
+		{
+			name:       "no user with no content",
+			opts:       []Opt{WithEmptyListNoContent(true)},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "single user",
+			users:      []model.User{anna},
+			wantStatus: http.StatusOK,
+			wantBody:   "[" + annaJSON + "\n]",
+		},
+		{
+			name:       "multiple users",
+			users:      []model.User{anna, bob, anna},
+			wantStatus: http.StatusOK,
+			wantBody:   "[" + annaJSON + "\n," + bobJSON + "\n," + annaJSON + "\n]",
+		},
+		{
+			name:         "failure before the first user",
+			serviceError: errors.New("db down"),
+			wantStatus:   http.StatusInternalServerError,
+			wantBody:     `{"error":"internal server error","code":"internal_error"}`,
+		},
+		{
+			name:         "failure mid-stream",
+			users:        []model.User{anna},
+			serviceError: errors.New("cursor failed"),
+			wantStatus:   http.StatusOK,
+			wantBody:     "[" + annaJSON + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+
+			getUsersHandler := getUsers(serviceMock, newHandlersConfig(append(tt.opts, WithListStreaming(true))...))
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = &http.Request{URL: &url.URL{}}
+
+			serviceMock.On("StreamUsers", ctx, mock.Anything, mock.Anything).
+				Run(func(args mock.Arguments) {
+					stream := args.Get(2).(func(model.User) error)
+					for _, u := range tt.users {
+						assert.NoError(t, stream(u))
+					}
+				}).
+				Return(tt.serviceError)
+
+			getUsersHandler(ctx)
+
+			assert.Equal(t, tt.wantStatus, ctx.Writer.Status())
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			if tt.wantBody != "" {
+				assert.Contains(t, w.Header().Get("Content-Type"), jsonContentType)
+			}
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_TouchUserHandler(t *testing.T) {
+	existing := uuid.New()
+	missing := uuid.New()
+	tests := []struct {
+		name         string
+		userID       string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "touched",
+			userID:       existing.String(),
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "user not found",
+			userID:       missing.String(),
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"error":"user not found","code":"user_not_found","id":"` + missing.String() + `"}`,
+		},
+		{
+			name:         "invalid user ID",
+			userID:       "not-uuid",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"incorrect user ID format: invalid UUID length: 8"}`,
 		},
 	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotErr := validateRequiredRequestFields(tt.user)
+			serviceMock := new(ServiceMock)
+			serviceMock.On("TouchUser", mock.Anything, existing).Return(nil)
+			serviceMock.On("TouchUser", mock.Anything, missing).Return(storage_err.NotFoundError)
+
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), serviceMock)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/users/"+tt.userID+"/touch", nil))
 
-			assert.Equal(t, tt.wantErr, gotErr != nil)
-			if tt.wantErr {
-				assert.Equal(t, gotErr.Error(), tt.wantErrString)
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			} else {
+				assert.Empty(t, w.Body.String())
 			}
 		})
 	}
 }
+
+func Test_GetUsersHandler_HiddenUsers(t *testing.T) {
+	for _, includeHidden := range []bool{false, true} {
+		t.Run(fmt.Sprintf("include hidden %t", includeHidden), func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			serviceMock.On("GetUsers", mock.Anything, mock.MatchedBy(func(params model.GetUsersParams) bool {
+				return params.IncludeHidden == includeHidden
+			})).Return([]model.User{}, nil)
+
+			router := gin.New()
+			router.ContextWithFallback = true
+			router.Use(auth.AdminAPIKeyMiddleware("X-Admin-Api-Key", "secret"))
+			CreateUsersHandlers(router.Group("v1"), serviceMock)
+			path := "/v1/users"
+			if includeHidden {
+				path += "?includeHidden=true"
+			}
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("X-Admin-Api-Key", "secret")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			serviceMock.AssertExpectations(t)
+		})
+	}
+
+	t.Run("include hidden by non-admin", func(t *testing.T) {
+		serviceMock := new(ServiceMock)
+		router := gin.New()
+		router.ContextWithFallback = true
+		router.Use(auth.AdminAPIKeyMiddleware("X-Admin-Api-Key", "secret"))
+		CreateUsersHandlers(router.Group("v1"), serviceMock)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users?includeHidden=true", nil))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.JSONEq(t, `{"error":"including the hidden users requires an admin caller","code":"forbidden","parameter":"includeHidden"}`, w.Body.String())
+		serviceMock.AssertNotCalled(t, "GetUsers", mock.Anything, mock.Anything)
+	})
+}
+
+func Test_GetUsersHandler_CreatedBy(t *testing.T) {
+	serviceMock := new(ServiceMock)
+	serviceMock.On("GetUsers", mock.Anything, mock.MatchedBy(func(params model.GetUsersParams) bool {
+		return *params.FilterFields.CreatedBy == "admin" && params.PageSize == 5
+	})).Return([]model.User{}, nil)
+
+	router := gin.New()
+	CreateUsersHandlers(router.Group("v1"), serviceMock)
+
+	// the attribution is returned in the responses, so it is searchable by any caller
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users?created_by=admin&pageSize=5", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	serviceMock.AssertExpectations(t)
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"user-service/internal/model"
+)
+
+const dryRunQueryParam = "dryRun"
+
+// startDryRun marks the request as dry run if requested by the client by dryRun=true query parameter. The writes are then
+// only validated, the events they would produce are captured for the response. Nil capture is returned for other requests.
+// The gin engine needs ContextWithFallback enabled for the dry run to be visible through the gin context.
+func startDryRun(c *gin.Context) (*model.EventCapture, *paramError) {
+	value, ok := c.GetQuery(dryRunQueryParam)
+	if !ok {
+		return nil, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, &paramError{
+			parameter: dryRunQueryParam,
+			code:      codeInvalidParameter,
+			msg:       "dryRun query parameter has to be a boolean",
+		}
+	}
+	if !dryRun {
+		return nil, nil
+	}
+
+	ctx, capture := model.ContextWithEventCapture(model.ContextWithDryRun(c.Request.Context()))
+	c.Request = c.Request.WithContext(ctx)
+	return capture, nil
+}
+
+// newDryRunResponse returns the response of the dry run with the user and the event the write would produce.
+func newDryRunResponse(capture *model.EventCapture, user *userResponse, cfg handlersConfig) eventEchoResponse {
+	resp := newEventEchoResponse(capture, user, cfg)
+	resp.DryRun = true
+	return resp
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	storage_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+func Test_DryRun(t *testing.T) {
+	userID := uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")
+	valid := `{"first_name":"Anna","last_name":"Alakava","nickname":"anna","password":"pwd","email":"ann@gmail.com","country":"UK"}`
+	dryRunCtx := mock.MatchedBy(func(ctx context.Context) bool { return model.IsDryRun(ctx) })
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		mock     func(m *ServiceMock)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/v1/users?dryRun=true",
+			body:   valid,
+			mock: func(m *ServiceMock) {
+				m.On("CreateUser", dryRunCtx, mock.Anything).Return(&model.User{ID: userID, FirstName: "Anna"}, nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"dry_run":true,"user":{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"Anna","last_name":"","nickname":"",` +
+				`"email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"},"event":null}`,
+		},
+		{
+			name:     "create surfaces validation errors",
+			method:   http.MethodPost,
+			path:     "/v1/users?dryRun=true",
+			body:     `{"first_name":"Anna"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"last name is required"}`,
+		},
+		{
+			name:   "update of non-existing user",
+			method: http.MethodPut,
+			path:   "/v1/users/" + userID.String() + "?dryRun=true",
+			body:   valid,
+			mock: func(m *ServiceMock) {
+				m.On("UpdateUser", dryRunCtx, mock.Anything, mock.Anything).Return(storage_err.NotFoundError)
+			},
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"user not found","code":"user_not_found","id":"` + userID.String() + `"}`,
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete,
+			path:   "/v1/users/" + userID.String() + "?dryRun=true",
+			mock: func(m *ServiceMock) {
+				m.On("DeleteUser", dryRunCtx, userID).Return(nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"dry_run":true,"event":null}`,
+		},
+		{
+			name:     "invalid dry run",
+			method:   http.MethodDelete,
+			path:     "/v1/users/" + userID.String() + "?dryRun=maybe",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"dryRun query parameter has to be a boolean","code":"invalid_parameter","parameter":"dryRun"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			if tt.mock != nil {
+				tt.mock(serviceMock)
+			}
+			router := gin.New()
+			router.ContextWithFallback = true
+			CreateUsersHandlers(router.Group("v1"), serviceMock)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"user-service/internal/model"
+)
+
+const echoEventQueryParam = "echoEvent"
+
+// eventEchoResponse is the response of the write handlers including the produced event for debugging.
+type eventEchoResponse struct {
+	// DryRun tells the write was only validated, the user and the event are what it would produce.
+	DryRun bool          `json:"dry_run,omitempty"`
+	User   *userResponse `json:"user,omitempty"`
+	// Event is nil if no event was produced
+	Event *eventResponse `json:"event"`
+}
+
+// eventResponse is the user event exposed to the API clients, the user IDs are encoded by the configured ID codec
+// the same way as in the user responses.
+type eventResponse struct {
+	Action   model.Action `json:"action"`
+	UserData any          `json:"user_data"`
+}
+
+// deletedUserResponse is the user data of the deleted event.
+type deletedUserResponse struct {
+	ID string `json:"id"`
+}
+
+func newEventResponse(event model.UserEvent, cfg handlersConfig) eventResponse {
+	data := event.UserData
+	switch d := data.(type) {
+	case model.User:
+		data = newUserResponse(d, cfg)
+	case model.UserDeletedData:
+		data = deletedUserResponse{ID: cfg.idCodec.Encode(d.UserID)}
+	}
+	return eventResponse{Action: event.Action, UserData: data}
+}
+
+// captureEvents starts capturing the events produced while handling the request if the event echo is enabled
+// and requested by the client. Nil is returned otherwise.
+// The gin engine needs ContextWithFallback enabled for the capture to be visible through the gin context.
+func captureEvents(c *gin.Context, cfg handlersConfig) *model.EventCapture {
+	if !cfg.echoEvent || c.Query(echoEventQueryParam) != "true" {
+		return nil
+	}
+
+	ctx, capture := model.ContextWithEventCapture(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	return capture
+}
+
+func newEventEchoResponse(capture *model.EventCapture, user *userResponse, cfg handlersConfig) eventEchoResponse {
+	resp := eventEchoResponse{User: user}
+	if events := capture.Events(); len(events) > 0 {
+		event := newEventResponse(events[0], cfg)
+		resp.Event = &event
+	}
+	return resp
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/model"
+)
+
+func Test_EchoEvent(t *testing.T) {
+	userID := uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")
+	user := model.User{
+		ID:        userID,
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+	}
+	userJSON := `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"valid","last_name":"valid","nickname":"valid",` +
+		`"password":"valid","email":"valid@gmail.com","country":"valid","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`
+	// captures the event the same way the real service does
+	produceEvent := func(event model.UserEvent) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			model.CaptureEvent(args.Get(0).(context.Context), event)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		query          string
+		echoEnabled    bool
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "create - echo requested",
+			method:         http.MethodPost,
+			query:          "echoEvent=true",
+			echoEnabled:    true,
+			wantStatusCode: http.StatusCreated,
+			wantBody:       `{"user":` + userJSON + `,"event":{"action":"created","user_data":` + userJSON + `}}`,
+		},
+		{
+			name:           "create - echo not requested",
+			method:         http.MethodPost,
+			echoEnabled:    true,
+			wantStatusCode: http.StatusCreated,
+			wantBody:       userJSON,
+		},
+		{
+			name:           "create - echo disabled",
+			method:         http.MethodPost,
+			query:          "echoEvent=true",
+			wantStatusCode: http.StatusCreated,
+			wantBody:       userJSON,
+		},
+		{
+			name:           "update - echo requested",
+			method:         http.MethodPut,
+			query:          "echoEvent=true",
+			echoEnabled:    true,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"event":{"action":"updated","user_data":` + userJSON + `}}`,
+		},
+		{
+			name:           "update - echo disabled",
+			method:         http.MethodPut,
+			query:          "echoEvent=true",
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "delete - echo requested",
+			method:         http.MethodDelete,
+			query:          "echoEvent=true",
+			echoEnabled:    true,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"event":{"action":"deleted","user_data":{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004"}}}`,
+		},
+		{
+			name:           "delete - echo disabled",
+			method:         http.MethodDelete,
+			query:          "echoEvent=true",
+			wantStatusCode: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			serviceMock.On("CreateUser", mock.Anything, mock.Anything).
+				Run(produceEvent(model.NewUserCreatedEvent(user))).Return(&user, nil).Maybe()
+			serviceMock.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).
+				Run(produceEvent(model.NewUserUpdatedEvent(user))).Return(nil).Maybe()
+			serviceMock.On("DeleteUser", mock.Anything, userID).
+				Run(produceEvent(model.NewUserDeletedEvent(userID))).Return(nil).Maybe()
+
+			router := gin.New()
+			router.ContextWithFallback = true
+			CreateUsersHandlers(router.Group("v1"), serviceMock, WithEchoEvent(tt.echoEnabled))
+
+			path := "/v1/users"
+			if tt.method != http.MethodPost {
+				path += "/" + userID.String()
+			}
+			body := `{"first_name":"valid","last_name":"valid","nickname":"valid","password":"valid","email":"valid@gmail.com","country":"valid"}`
+			req := httptest.NewRequest(tt.method, path+"?"+tt.query, strings.NewReader(body))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_EchoEvent_IDCodec(t *testing.T) {
+	userID := uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")
+	encodedID := Base62Codec{}.Encode(userID)
+	serviceMock := new(ServiceMock)
+	serviceMock.On("DeleteUser", mock.Anything, userID).
+		Run(func(args mock.Arguments) {
+			model.CaptureEvent(args.Get(0).(context.Context), model.NewUserDeletedEvent(userID))
+		}).Return(nil)
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	CreateUsersHandlers(router.Group("v1"), serviceMock, WithEchoEvent(true), WithIDCodec(Base62Codec{}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/users/"+encodedID+"?echoEvent=true", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"event":{"action":"deleted","user_data":{"id":"`+encodedID+`"}}}`, w.Body.String())
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EmailValidation is the level of the user email validation.
+type EmailValidation string
+
+const (
+	// EmailValidationSyntax validates only the email address syntax.
+	EmailValidationSyntax EmailValidation = "syntax"
+	// EmailValidationMX also requires the email domain to have MX records, so it can receive emails.
+	EmailValidationMX EmailValidation = "mx"
+)
+
+// maxCachedMXDomains bounds the MX cache, it is reset when full.
+const maxCachedMXDomains = 10_000
+
+// MXResolver looks up the MX records of a domain, satisfied by *net.Resolver.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+type mxCacheEntry struct {
+	hasMX   bool
+	expires time.Time
+}
+
+// MXChecker checks the email domains have MX records. The lookup results are cached per domain for the cache TTL.
+// Failed lookups (e.g. timeouts) are not cached and the domain is considered valid, so DNS outages don't block the users.
+type MXChecker struct {
+	resolver MXResolver
+	timeout  time.Duration
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]mxCacheEntry
+}
+
+func NewMXChecker(resolver MXResolver, timeout, cacheTTL time.Duration) *MXChecker {
+	return &MXChecker{
+		resolver: resolver,
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+		now:      time.Now,
+		cache:    map[string]mxCacheEntry{},
+	}
+}
+
+// HasMX returns false only if the domain provably has no MX records. The lookup error is returned along with true
+// if it could not be determined.
+func (c *MXChecker) HasMX(ctx context.Context, domain string) (bool, error) {
+	domain = strings.ToLower(domain)
+	if hasMX, ok := c.cached(domain); ok {
+		return hasMX, nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	records, err := c.resolver.LookupMX(lookupCtx, domain)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return true, err
+	}
+
+	hasMX := len(records) > 0
+	c.store(domain, hasMX)
+	return hasMX, nil
+}
+
+func (c *MXChecker) cached(domain string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[domain]
+	if !ok || c.now().After(entry.expires) {
+		return false, false
+	}
+	return entry.hasMX, true
+}
+
+func (c *MXChecker) store(domain string, hasMX bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxCachedMXDomains {
+		c.cache = map[string]mxCacheEntry{}
+	}
+	c.cache[domain] = mxCacheEntry{hasMX: hasMX, expires: c.now().Add(c.cacheTTL)}
+}
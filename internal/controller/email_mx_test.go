@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+type resolverStub struct {
+	records map[string][]*net.MX
+	err     error
+	calls   int
+}
+
+func (r *resolverStub) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	records, ok := r.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func Test_validateUser_EmailMX(t *testing.T) {
+	validUser := func(email string) model.User {
+		return model.User{FirstName: "valid", LastName: "valid", Nickname: "valid", Password: "valid", Email: email, Country: "valid"}
+	}
+	resolver := func() *resolverStub {
+		return &resolverStub{records: map[string][]*net.MX{
+			"gmail.com":    {{Host: "gmail-smtp-in.l.google.com.", Pref: 5}},
+			"no-mx.com":    {},
+			"company.com":  {{Host: "mx.company.com.", Pref: 10}},
+			"mixedcase.io": {{Host: "mx.mixedcase.io.", Pref: 10}},
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		email       string
+		resolverErr error
+		mx          bool
+		wantErr     string
+	}{
+		{
+			name:  "syntax only - domain without MX accepted",
+			email: "john@no-mx.com",
+		},
+		{
+			name:    "syntax only - invalid syntax",
+			email:   "john.gmail.com",
+			wantErr: "email is invalid",
+		},
+		{
+			name:  "mx - domain with MX",
+			email: "john@gmail.com",
+			mx:    true,
+		},
+		{
+			name:  "mx - domain case insensitive",
+			email: "John Wick <john@MixedCase.IO>",
+			mx:    true,
+		},
+		{
+			name:    "mx - domain without MX",
+			email:   "john@no-mx.com",
+			mx:      true,
+			wantErr: "email domain cannot receive emails",
+		},
+		{
+			name:    "mx - non-existing domain",
+			email:   "john@does-not-exist.com",
+			mx:      true,
+			wantErr: "email domain cannot receive emails",
+		},
+		{
+			name:        "mx - lookup failure accepted",
+			email:       "john@gmail.com",
+			resolverErr: errors.New("i/o timeout"),
+			mx:          true,
+		},
+		{
+			name:    "mx - invalid syntax not looked up",
+			email:   "john.gmail.com",
+			mx:      true,
+			wantErr: "email is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := resolver()
+			r.err = tt.resolverErr
+			var opts []Opt
+			if tt.mx {
+				opts = append(opts, WithEmailMXCheck(NewMXChecker(r, time.Second, time.Hour)))
+			}
+
+			err := validateUser(context.Background(), validUser(tt.email), newHandlersConfig(opts...))
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if !tt.mx {
+				assert.Equal(t, 0, r.calls)
+			}
+		})
+	}
+}
+
+func Test_MXChecker_Cache(t *testing.T) {
+	r := &resolverStub{records: map[string][]*net.MX{"gmail.com": {{Host: "gmail-smtp-in.l.google.com.", Pref: 5}}}}
+	now := time.Date(2024, 7, 13, 9, 0, 0, 0, time.UTC)
+	checker := NewMXChecker(r, time.Second, time.Hour)
+	checker.now = func() time.Time { return now }
+
+	for _, domain := range []string{"gmail.com", "GMAIL.com", "unknown.com", "unknown.com"} {
+		_, err := checker.HasMX(context.Background(), domain)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, r.calls, "positive and negative results are cached")
+
+	now = now.Add(time.Hour + time.Second)
+	hasMX, err := checker.HasMX(context.Background(), "gmail.com")
+	assert.NoError(t, err)
+	assert.True(t, hasMX)
+	assert.Equal(t, 3, r.calls, "expired result is looked up again")
+
+	r.err = errors.New("i/o timeout")
+	_, _ = checker.HasMX(context.Background(), "other.com")
+	_, _ = checker.HasMX(context.Background(), "other.com")
+	assert.Equal(t, 5, r.calls, "failed lookups are not cached")
+}
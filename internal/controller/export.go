@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+	"user-service/internal/auth"
+	"user-service/internal/model"
+)
+
+type ExportFormat string
+
+const (
+	// ExportFormatNDJSON exports the users as newline delimited JSON objects.
+	ExportFormatNDJSON ExportFormat = "ndjson"
+	// ExportFormatJSON exports the users as a single JSON array e.g. for full backups.
+	ExportFormatJSON ExportFormat = "json"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	jsonContentType   = "application/json"
+	// exportTruncatedTrailer is sent after the exported users, as the truncation is known only at the end of the export.
+	exportTruncatedTrailer = "X-Export-Truncated"
+	// exportRangeMaxBytes limits the bytes of a single range response, the longer ranges are sent partially
+	// and the client requests the rest from the end of the Content-Range.
+	exportRangeMaxBytes = 4 << 20
+)
+
+// exportUsers returns a handler that streams all the users in the configured format, up to the configured maximum.
+// The users are written as they are read from the DB cursor, the whole export is never buffered.
+// A single byte range can be requested to resume a dropped export, the users are ordered by ID so the export is deterministic.
+// Only the requested range is buffered, up to exportRangeMaxBytes.
+func exportUsers(svc Service, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if cfg.exportTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.exportTimeout)
+			defer cancel()
+		}
+
+		asArray := cfg.exportFormat == ExportFormatJSON
+		if asArray {
+			c.Header("Content-Type", jsonContentType)
+		} else {
+			c.Header("Content-Type", ndjsonContentType)
+		}
+		c.Header("Accept-Ranges", "bytes")
+		c.Header("Trailer", exportTruncatedTrailer)
+
+		// the range is buffered, as its last byte and so the Content-Range is known only once the range is written
+		var out io.Writer = c.Writer
+		byteRange, ranged := parseByteRange(c.GetHeader("Range"))
+		var rw *rangeWriter
+		if ranged {
+			rw = newRangeWriter(byteRange, exportRangeMaxBytes)
+			out = rw
+		} else {
+			c.Status(http.StatusOK)
+		}
+
+		encoder := json.NewEncoder(out)
+		exported := 0
+		truncated, err := svc.ExportUsers(ctx, cfg.exportMaxUsers, auth.IsAdmin(ctx), func(user model.User) error {
+			if asArray {
+				if err := writeArrayDelimiter(out, exported); err != nil {
+					return err
+				}
+			}
+			exported++
+			return encoder.Encode(newUserResponse(user, cfg))
+		})
+		if asArray && err == nil {
+			err = writeArrayEnd(out, exported)
+		}
+		if errors.Is(err, errRangeSatisfied) {
+			// the rest of the export is out of the requested range
+			err = nil
+		}
+		if err != nil {
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Trailer")
+				c.Writer.Header().Del("Content-Type")
+				respondServiceError(c, err, cfg)
+				return
+			}
+			// the status is already sent, missing trailer (and closing bracket of the array) tells the client
+			// the export is incomplete
+			logrus.WithError(err).Error("users export failed mid-stream")
+			c.Abort()
+			return
+		}
+
+		if ranged {
+			if rw.buf.Len() == 0 {
+				// the whole export is before the range start
+				c.Writer.Header().Del("Trailer")
+				c.Writer.Header().Del("Content-Type")
+				c.Header("Content-Range", fmt.Sprintf("bytes */%d", rw.written))
+				c.Status(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			c.Header("Content-Range", rw.contentRange())
+			c.Status(http.StatusPartialContent)
+			if _, err := rw.buf.WriteTo(c.Writer); err != nil {
+				logrus.WithError(err).Error("users export range write failed")
+				c.Abort()
+				return
+			}
+		}
+		c.Writer.Header().Set(exportTruncatedTrailer, strconv.FormatBool(truncated))
+	}
+}
+
+// writeArrayDelimiter writes the array opening bracket before the first exported user and a comma before the others.
+func writeArrayDelimiter(w io.Writer, exported int) error {
+	delimiter := ","
+	if exported == 0 {
+		delimiter = "["
+	}
+	_, err := io.WriteString(w, delimiter)
+	return err
+}
+
+// writeArrayEnd writes the array closing bracket, the opening one too if no user was exported.
+func writeArrayEnd(w io.Writer, exported int) error {
+	end := "]"
+	if exported == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(w, end)
+	return err
+}
@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-service/internal/auth"
+	"user-service/internal/model"
+)
+
+func Test_ExportUsersHandler(t *testing.T) {
+	users := []model.User{
+		{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"), FirstName: "John"},
+		{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170005"), FirstName: "Jane"},
+	}
+
+	tests := []struct {
+		name           string
+		exported       []model.User
+		truncated      bool
+		serviceError   error
+		wantStatusCode int
+		wantBody       string
+		wantTrailer    string
+	}{
+		{
+			name:           "all users exported",
+			exported:       users,
+			wantStatusCode: http.StatusOK,
+			wantBody: `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John","last_name":"","nickname":"","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n" +
+				`{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170005","first_name":"Jane","last_name":"","nickname":"","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n",
+			wantTrailer: "false",
+		},
+		{
+			name:           "export truncated by the cap",
+			exported:       users[:1],
+			truncated:      true,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John","last_name":"","nickname":"","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n",
+			wantTrailer:    "true",
+		},
+		{
+			name:           "export fails before the first user",
+			serviceError:   errors.New("db down"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `{"error":"internal server error","code":"internal_error"}`,
+		},
+		{
+			name:           "export fails mid-stream",
+			exported:       users[:1],
+			serviceError:   errors.New("db down"),
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John","last_name":"","nickname":"","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+
+			exportUsersHandler := exportUsers(serviceMock, newHandlersConfig(WithExportMaxUsers(2)))
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/v1/users/export", nil)
+
+			serviceMock.On("ExportUsers", ctx.Request.Context(), 2, false, mock.Anything).
+				Run(func(args mock.Arguments) {
+					export := args.Get(3).(func(model.User) error)
+					for _, u := range tt.exported {
+						assert.NoError(t, export(u))
+					}
+				}).
+				Return(tt.truncated, tt.serviceError)
+
+			// call the handler
+			exportUsersHandler(ctx)
+
+			res := w.Result()
+			assert.Equal(t, tt.wantStatusCode, res.StatusCode)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantTrailer, res.Trailer.Get(exportTruncatedTrailer))
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_ExportUsersHandler_JSONArray(t *testing.T) {
+	users := []model.User{
+		{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"), FirstName: "John"},
+		{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170005"), FirstName: "Jane"},
+		{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170006"), FirstName: "Jack"},
+	}
+
+	tests := []struct {
+		name          string
+		exported      []model.User
+		serviceError  error
+		wantValidJSON bool
+		wantUsers     []string
+		wantTrailer   string
+	}{
+		{
+			name:          "several users",
+			exported:      users,
+			wantValidJSON: true,
+			wantUsers:     []string{"John", "Jane", "Jack"},
+			wantTrailer:   "false",
+		},
+		{
+			name:          "no users",
+			wantValidJSON: true,
+			wantUsers:     []string{},
+			wantTrailer:   "false",
+		},
+		{
+			name:         "export fails mid-stream",
+			exported:     users[:2],
+			serviceError: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+
+			exportUsersHandler := exportUsers(serviceMock, newHandlersConfig(WithExportFormat(ExportFormatJSON), WithExportTimeout(time.Minute)))
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/v1/users/export", nil)
+
+			serviceMock.On("ExportUsers", mock.Anything, defaultExportMaxUsers, false, mock.Anything).
+				Run(func(args mock.Arguments) {
+					_, hasDeadline := args.Get(0).(context.Context).Deadline()
+					assert.True(t, hasDeadline)
+					export := args.Get(3).(func(model.User) error)
+					for _, u := range tt.exported {
+						assert.NoError(t, export(u))
+					}
+				}).
+				Return(false, tt.serviceError)
+
+			// call the handler
+			exportUsersHandler(ctx)
+
+			res := w.Result()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, jsonContentType, res.Header.Get("Content-Type"))
+			assert.Equal(t, tt.wantValidJSON, json.Valid(w.Body.Bytes()))
+			assert.Equal(t, tt.wantTrailer, res.Trailer.Get(exportTruncatedTrailer))
+			if tt.wantValidJSON {
+				var got []map[string]any
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				gotNames := []string{}
+				for _, u := range got {
+					gotNames = append(gotNames, u["first_name"].(string))
+				}
+				assert.Equal(t, tt.wantUsers, gotNames)
+			}
+			serviceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_ExportUsersHandler_Range(t *testing.T) {
+	users := []model.User{
+		{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"), FirstName: "John"},
+		{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170005"), FirstName: "Jane"},
+	}
+	full := `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John","last_name":"","nickname":"","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n" +
+		`{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170005","first_name":"Jane","last_name":"","nickname":"","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}` + "\n"
+
+	tests := []struct {
+		name             string
+		rangeHeader      string
+		wantStatusCode   int
+		wantBody         string
+		wantContentRange string
+	}{
+		{
+			name:           "no range",
+			wantStatusCode: http.StatusOK,
+			wantBody:       full,
+		},
+		{
+			name:             "resume from offset",
+			rangeHeader:      "bytes=100-",
+			wantStatusCode:   http.StatusPartialContent,
+			wantBody:         full[100:],
+			wantContentRange: fmt.Sprintf("bytes 100-%d/%d", len(full)-1, len(full)),
+		},
+		{
+			name:             "bounded range",
+			rangeHeader:      "bytes=150-249",
+			wantStatusCode:   http.StatusPartialContent,
+			wantBody:         full[150:250],
+			wantContentRange: fmt.Sprintf("bytes 150-249/%d", len(full)),
+		},
+		{
+			name:             "bounded range past the end of the export",
+			rangeHeader:      "bytes=150-9999",
+			wantStatusCode:   http.StatusPartialContent,
+			wantBody:         full[150:],
+			wantContentRange: fmt.Sprintf("bytes 150-%d/%d", len(full)-1, len(full)),
+		},
+		{
+			name:             "range beyond the export",
+			rangeHeader:      "bytes=10000-",
+			wantStatusCode:   http.StatusRequestedRangeNotSatisfiable,
+			wantContentRange: fmt.Sprintf("bytes */%d", len(full)),
+		},
+		{
+			name:           "unsupported range is ignored",
+			rangeHeader:    "bytes=-100",
+			wantStatusCode: http.StatusOK,
+			wantBody:       full,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			router := gin.New()
+			router.GET("/v1/users/export", exportUsers(serviceMock, newHandlersConfig()))
+			serviceMock.On("ExportUsers", mock.Anything, defaultExportMaxUsers, false, mock.Anything).
+				Run(func(args mock.Arguments) {
+					export := args.Get(3).(func(model.User) error)
+					for _, u := range users {
+						if err := export(u); err != nil {
+							return
+						}
+					}
+				}).
+				Return(false, nil)
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/export", nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantContentRange, w.Header().Get("Content-Range"))
+		})
+	}
+}
+
+func Test_ExportUsersHandler_AdminOnly(t *testing.T) {
+	serviceMock := new(ServiceMock)
+	// the admins export also the hidden users
+	serviceMock.On("ExportUsers", mock.Anything, defaultExportMaxUsers, true, mock.Anything).Return(false, nil)
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(auth.AdminAPIKeyMiddleware("X-Admin-Api-Key", "secret"))
+	CreateUsersHandlers(router.Group("v1"), serviceMock)
+
+	// the anonymous callers can't export the users
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/export", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"admin caller is required","code":"forbidden"}`, w.Body.String())
+	serviceMock.AssertNotCalled(t, "ExportUsers", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/export", nil)
+	req.Header.Set("X-Admin-Api-Key", "secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	serviceMock.AssertExpectations(t)
+}
@@ -2,31 +2,81 @@ package controller
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"strconv"
 	"strings"
+	storage_err "user-service/internal/errors"
 	"user-service/internal/model"
 )
 
-var supportedSortFields = map[string]struct{}{
-	"last_name":  {},
-	"first_name": {},
-	"nickname":   {},
-	"password":   {},
-	"email":      {},
-	"country":    {},
-	"created_at": {},
-	"updated_at": {},
-}
-
 const (
-	userIDPathParam = "userID"
-	defaultPageSize = 20
-	defaultPage     = 0
+	userIDPathParam           = "userID"
+	defaultPage               = 0
+	includeHiddenQueryParam   = "includeHidden"
+	caseInsensitiveQueryParam = "caseInsensitive"
+	createdByQueryParam       = "created_by"
+	sortByQueryParam          = "sortBy"
 )
 
-func parseGetUsersParams(c *gin.Context) (*model.GetUsersParams, error) {
-	pageSize := defaultPageSize
+// paginationQueryParams are the page size and the page query parameters of the users list.
+var paginationQueryParams = []string{"pageSize", "page"}
+
+// boolQueryParamValues are the documented values of the boolean query parameters, the other strconv.ParseBool forms are accepted too.
+var boolQueryParamValues = []string{"true", "false"}
+
+// listOptionParam is a query parameter of the users list other than the pagination, sorting and filters.
+type listOptionParam struct {
+	Name string `json:"name"`
+	// Values are the accepted values, comma separated lists of them for compute.
+	Values []string `json:"values"`
+}
+
+// usersListOptionParams returns the other query parameters of the users list, the same definitions the requests
+// are checked by, so they are always described as parsed.
+func usersListOptionParams(cfg handlersConfig) []listOptionParam {
+	params := []listOptionParam{
+		{Name: includeHiddenQueryParam, Values: boolQueryParamValues},
+		{Name: caseInsensitiveQueryParam, Values: boolQueryParamValues},
+		{Name: computeQueryParam, Values: []string{computeAge, computeWeek}},
+	}
+	if cfg.prettyJSON {
+		params = append(params, listOptionParam{Name: prettyQueryParam, Values: boolQueryParamValues})
+	}
+	return params
+}
+
+// singleValueQueryParams returns all the query parameters of the users list that cannot be repeated.
+func singleValueQueryParams(cfg handlersConfig) []string {
+	params := append(append([]string{}, paginationQueryParams...), sortByQueryParam)
+	for _, param := range usersListOptionParams(cfg) {
+		params = append(params, param.Name)
+	}
+	return append(params, model.FilterableFields...)
+}
+
+// parseUserID parses the user ID path parameter. Only the configured UUID version is accepted if set.
+func parseUserID(c *gin.Context, cfg handlersConfig) (uuid.UUID, error) {
+	id, err := cfg.idCodec.Decode(c.Param(userIDPathParam))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if cfg.userIDVersion != 0 && id.Version() != cfg.userIDVersion {
+		return uuid.Nil, fmt.Errorf("expected UUID version %d, got %d", cfg.userIDVersion, id.Version())
+	}
+	return id, nil
+}
+
+// parseGetUsersParams parses the list query parameters, the returned errors are *paramError.
+func parseGetUsersParams(c *gin.Context, cfg handlersConfig) (*model.GetUsersParams, error) {
+	if cfg.strictQueryParams {
+		if err := rejectDuplicateQueryParams(c, singleValueQueryParams(cfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	pageSize := cfg.defaultPageSize
 	page := defaultPage
 	sort := model.Sort{
 		Field: "last_name",
@@ -34,83 +84,186 @@ func parseGetUsersParams(c *gin.Context) (*model.GetUsersParams, error) {
 	}
 
 	if got, ok := c.GetQuery("pageSize"); ok {
-		parsed, err := strconv.Atoi(got)
+		parsed, err := parseIntParam("pageSize", got)
 		if err != nil {
-			return nil, errors.New("pageSize query parameter has to be a number")
+			return nil, err
 		}
-		if parsed < 0 {
-			return nil, errors.New("pageSize query parameter has to be a positive number")
+		if parsed > cfg.maxPageSize {
+			return nil, &paramError{parameter: "pageSize", code: codeParameterOutOfRange, msg: fmt.Sprintf("pageSize query parameter cannot be bigger than %d", cfg.maxPageSize)}
 		}
 		pageSize = parsed
 	}
 
 	if got, ok := c.GetQuery("page"); ok {
-		parsed, err := strconv.Atoi(got)
+		parsed, err := parseIntParam("page", got)
 		if err != nil {
-			return nil, errors.New("page query parameter has to be a number")
-		}
-		if parsed < 0 {
-			return nil, errors.New("page query parameter has to be a positive number")
+			return nil, err
 		}
 		page = parsed
 	}
 
-	if got, ok := c.GetQuery("sortBy"); ok {
-		parsed, err := parseSortBy(got)
+	if got, ok := c.GetQuery(sortByQueryParam); ok {
+		parsed, err := parseSortBy(got, cfg.sortFields)
 		if err != nil {
 			return nil, err
 		}
 		sort = *parsed
 	}
 
-	return &model.GetUsersParams{
-		PageSize:     pageSize,
-		Page:         page,
-		Sort:         sort,
-		FilterFields: parseFilterFields(c),
-	}, nil
+	filter, err := parseFilterFields(c, cfg.filterFields)
+	if err != nil {
+		return nil, err
+	}
+
+	includeHidden := false
+	if got, ok := c.GetQuery(includeHiddenQueryParam); ok {
+		includeHidden, err = strconv.ParseBool(got)
+		if err != nil {
+			return nil, &paramError{
+				parameter: includeHiddenQueryParam,
+				code:      codeInvalidParameter,
+				msg:       "includeHidden query parameter has to be a boolean",
+			}
+		}
+	}
+
+	caseInsensitive := false
+	if got, ok := c.GetQuery(caseInsensitiveQueryParam); ok {
+		caseInsensitive, err = strconv.ParseBool(got)
+		if err != nil {
+			return nil, &paramError{
+				parameter: caseInsensitiveQueryParam,
+				code:      codeInvalidParameter,
+				msg:       "caseInsensitive query parameter has to be a boolean",
+			}
+		}
+	}
+
+	params := &model.GetUsersParams{
+		PageSize:        pageSize,
+		Page:            page,
+		Sort:            sort,
+		FilterFields:    filter,
+		IncludeHidden:   includeHidden,
+		CaseInsensitive: caseInsensitive,
+	}
+	// the ranges are validated by the same rules as in the storage, so the rejection doesn't depend on the layer
+	if err := params.Validate(); err != nil {
+		var invalidParamErr *storage_err.InvalidParameterError
+		if errors.As(err, &invalidParamErr) {
+			return nil, newInvalidParamError(invalidParamErr)
+		}
+		return nil, err
+	}
+	return params, nil
+}
+
+// parseIntParam parses the integer query parameter, the surrounding whitespace is trimmed. The plus sign
+// and leading zeros are rejected, so each number has a single accepted form.
+func parseIntParam(param, value string) (int, error) {
+	value = strings.TrimSpace(value)
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &paramError{parameter: param, code: codeInvalidParameter, msg: fmt.Sprintf("%s query parameter has to be a number", param)}
+	}
+	if canonical := strconv.Itoa(parsed); value != canonical {
+		return 0, &paramError{parameter: param, code: codeInvalidParameter, msg: fmt.Sprintf("%s query parameter has to be a number without plus sign and leading zeros", param)}
+	}
+	return parsed, nil
 }
 
-func parseSortBy(sortBy string) (*model.Sort, error) {
+// rejectDuplicateQueryParams fails if any of the given single-value query parameters is repeated, as only its first value
+// would be used. The repeatable parameters are not to be given.
+func rejectDuplicateQueryParams(c *gin.Context, singleValueParams []string) error {
+	for _, param := range singleValueParams {
+		if values, _ := c.GetQueryArray(param); len(values) > 1 {
+			return &paramError{parameter: param, code: codeDuplicateParameter, msg: fmt.Sprintf("%s query parameter cannot be repeated", param)}
+		}
+	}
+	return nil
+}
+
+func parseSortBy(sortBy string, sortFields map[string]struct{}) (*model.Sort, error) {
 	sortBy = strings.ToLower(sortBy)
 	parts := strings.Split(sortBy, ".")
 
 	if len(parts) != 2 {
-		return nil, errors.New("invalid sortBy query parameter format")
+		return nil, &paramError{parameter: sortByQueryParam, code: codeInvalidParameter, msg: "invalid sortBy query parameter format"}
 	}
 
-	if _, ok := supportedSortFields[parts[0]]; !ok {
-		return nil, errors.New("unsupported sorting field")
+	if _, ok := sortFields[parts[0]]; !ok {
+		return nil, &paramError{parameter: sortByQueryParam, code: codeUnsupportedParameter, msg: "unsupported sorting field"}
 	}
 
-	if parts[1] != "asc" && parts[1] != "desc" {
-		return nil, errors.New("invalid sorting type")
+	sortType, ok := sortTypeSynonyms[parts[1]]
+	if !ok {
+		return nil, &paramError{parameter: sortByQueryParam, code: codeUnsupportedParameter, msg: "invalid sorting type"}
 	}
 
 	return &model.Sort{
 		Field: parts[0],
-		Type:  parts[1],
+		Type:  sortType,
 	}, nil
 }
 
-func parseFilterFields(c *gin.Context) model.FilterFields {
+// sortTypeSynonyms maps the accepted sort types to the normalized asc or desc.
+var sortTypeSynonyms = map[string]string{
+	"asc":        "asc",
+	"ascending":  "asc",
+	"1":          "asc",
+	"desc":       "desc",
+	"descending": "desc",
+	"-1":         "desc",
+}
+
+// parseFilterFields parses the filters, the supported filters not allowed by the configuration are rejected
+// rather than ignored, so they don't silently return unfiltered users.
+func parseFilterFields(c *gin.Context, filterFields map[string]struct{}) (model.FilterFields, error) {
+	for _, field := range model.FilterableFields {
+		if _, ok := c.GetQuery(field); !ok {
+			continue
+		}
+		if _, ok := filterFields[field]; !ok {
+			return model.FilterFields{}, &paramError{
+				parameter: field,
+				code:      codeUnsupportedParameter,
+				msg:       fmt.Sprintf("filtering by %s is not supported", field),
+			}
+		}
+	}
+
 	filter := model.FilterFields{}
 
+	// the filter is set whenever the query key is present, so an empty value filters the users with the empty field
 	if v, ok := c.GetQuery("first_name"); ok {
-		filter.FirstName = v
+		filter.FirstName = &v
 	}
 	if v, ok := c.GetQuery("last_name"); ok {
-		filter.LastName = v
+		filter.LastName = &v
 	}
 	if v, ok := c.GetQuery("nickname"); ok {
-		filter.Nickname = v
+		filter.Nickname = &v
 	}
 	if v, ok := c.GetQuery("email"); ok {
-		filter.Email = v
+		filter.Email = &v
 	}
 	if v, ok := c.GetQuery("country"); ok {
-		filter.Country = v
+		filter.Country = &v
+	}
+	if v, ok := c.GetQuery("phone"); ok {
+		// numbers in other formats are matched as well
+		if phone, err := model.NormalizePhone(v); err == nil {
+			v = phone
+		}
+		filter.Phone = &v
+	}
+	if v, ok := c.GetQuery("email_domain"); ok {
+		domain := strings.TrimPrefix(v, "@")
+		filter.EmailDomain = &domain
+	}
+	if v, ok := c.GetQuery(createdByQueryParam); ok {
+		filter.CreatedBy = &v
 	}
 
-	return filter
+	return filter, nil
 }
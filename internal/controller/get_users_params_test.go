@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
 	"net/http"
 	url2 "net/url"
 	"testing"
@@ -58,6 +60,31 @@ func Test_parseSortBy(t *testing.T) {
 			want:    &model.Sort{Field: "email", Type: "desc"},
 			wantErr: false,
 		},
+		{
+			name:   "ascending synonym",
+			sortBy: "email.ascending",
+			want:   &model.Sort{Field: "email", Type: "asc"},
+		},
+		{
+			name:   "descending synonym",
+			sortBy: "email.Descending",
+			want:   &model.Sort{Field: "email", Type: "desc"},
+		},
+		{
+			name:   "1 synonym",
+			sortBy: "email.1",
+			want:   &model.Sort{Field: "email", Type: "asc"},
+		},
+		{
+			name:   "-1 synonym",
+			sortBy: "email.-1",
+			want:   &model.Sort{Field: "email", Type: "desc"},
+		},
+		{
+			name:    "unsupported numeric type",
+			sortBy:  "email.0",
+			wantErr: true,
+		},
 		{
 			name:    "unsupported field and desc type",
 			sortBy:  "unknown.desc",
@@ -76,7 +103,7 @@ func Test_parseSortBy(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseSortBy(tt.sortBy)
+			got, err := parseSortBy(tt.sortBy, model.FieldSet(model.SortableFields))
 
 			assert.Equal(t, tt.wantErr, err != nil)
 			assert.Equal(t, tt.want, got)
@@ -94,35 +121,71 @@ func Test_parseFilterFields(t *testing.T) {
 			name:  "first name",
 			query: "first_name=John",
 			want: model.FilterFields{
-				FirstName: "John",
+				FirstName: model.Ptr("John"),
 			},
 		},
 		{
 			name:  "last name",
 			query: "last_name=Wick",
 			want: model.FilterFields{
-				LastName: "Wick",
+				LastName: model.Ptr("Wick"),
 			},
 		},
 		{
 			name:  "nickname",
 			query: "nickname=johnywicky",
 			want: model.FilterFields{
-				Nickname: "johnywicky",
+				Nickname: model.Ptr("johnywicky"),
 			},
 		},
 		{
 			name:  "email",
 			query: "email=john.wick@example.com",
 			want: model.FilterFields{
-				Email: "john.wick@example.com",
+				Email: model.Ptr("john.wick@example.com"),
 			},
 		},
 		{
 			name:  "country",
 			query: "country=UK",
 			want: model.FilterFields{
-				Country: "UK",
+				Country: model.Ptr("UK"),
+			},
+		},
+		{
+			name:  "phone normalized",
+			query: "phone=%2B44%2020%207183%208750",
+			want: model.FilterFields{
+				Phone: model.Ptr("+442071838750"),
+			},
+		},
+		{
+			name:  "invalid phone kept",
+			query: "phone=12",
+			want: model.FilterFields{
+				Phone: model.Ptr("12"),
+			},
+		},
+		{
+			name:  "email domain",
+			query: "email_domain=example.com",
+			want: model.FilterFields{
+				EmailDomain: model.Ptr("example.com"),
+			},
+		},
+		{
+			name:  "email domain with at sign",
+			query: "email_domain=@example.com",
+			want: model.FilterFields{
+				EmailDomain: model.Ptr("example.com"),
+			},
+		},
+		{
+			name:  "created by",
+			query: "created_by=admin&country=UK",
+			want: model.FilterFields{
+				CreatedBy: model.Ptr("admin"),
+				Country:   model.Ptr("UK"),
 			},
 		},
 		{
@@ -130,15 +193,24 @@ func Test_parseFilterFields(t *testing.T) {
 			query: "unknown=idk",
 			want:  model.FilterFields{},
 		},
+		{
+			name:  "present but empty",
+			query: "first_name=&country",
+			want: model.FilterFields{
+				FirstName: model.Ptr(""),
+				Country:   model.Ptr(""),
+			},
+		},
 		{
 			name:  "all present",
-			query: "first_name=John&last_name=Wick&nickname=johnywicky&email=john.wick@example.com&country=UK",
+			query: "first_name=John&last_name=Wick&nickname=johnywicky&email=john.wick@example.com&country=UK&email_domain=example.com",
 			want: model.FilterFields{
-				FirstName: "John",
-				LastName:  "Wick",
-				Nickname:  "johnywicky",
-				Email:     "john.wick@example.com",
-				Country:   "UK",
+				FirstName:   model.Ptr("John"),
+				LastName:    model.Ptr("Wick"),
+				Nickname:    model.Ptr("johnywicky"),
+				Email:       model.Ptr("john.wick@example.com"),
+				Country:     model.Ptr("UK"),
+				EmailDomain: model.Ptr("example.com"),
 			},
 		},
 	}
@@ -152,8 +224,9 @@ func Test_parseFilterFields(t *testing.T) {
 				},
 			}
 
-			got := parseFilterFields(&ctx)
+			got, err := parseFilterFields(&ctx, newHandlersConfig().filterFields)
 
+			assert.Equal(t, nil, err)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -164,7 +237,10 @@ func Test_parseGetUsersParams(t *testing.T) {
 		name    string
 		query   string
 		want    *model.GetUsersParams
+		opts    []Opt
 		wantErr bool
+		// wantErrParam is the parameter the returned error has to name
+		wantErrParam string
 	}{
 		{
 			name:  "empty query - defaults",
@@ -218,6 +294,30 @@ func Test_parseGetUsersParams(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:  "page size with surrounding whitespace",
+			query: "pageSize=%205%20",
+			want: &model.GetUsersParams{
+				PageSize: 5,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+			},
+		},
+		{
+			name:         "page size with leading zeros",
+			query:        "pageSize=007",
+			wantErr:      true,
+			wantErrParam: "pageSize",
+		},
+		{
+			name:         "page with plus sign",
+			query:        "page=%2B5",
+			wantErr:      true,
+			wantErrParam: "page",
+		},
 		{
 			name:  "sorting",
 			query: "sortBy=first_name.desc",
@@ -242,12 +342,53 @@ func Test_parseGetUsersParams(t *testing.T) {
 					Type:  "asc",
 				},
 				FilterFields: model.FilterFields{
-					Nickname: "punisher",
-					Email:    "test@bubu.com",
+					Nickname: model.Ptr("punisher"),
+					Email:    model.Ptr("test@bubu.com"),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:  "hidden users included",
+			query: "includeHidden=true",
+			want: &model.GetUsersParams{
+				PageSize: 20,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
 				},
+				IncludeHidden: true,
 			},
 			wantErr: false,
 		},
+		{
+			name:         "invalid hidden users inclusion",
+			query:        "includeHidden=maybe",
+			wantErr:      true,
+			wantErrParam: "includeHidden",
+		},
+		{
+			name:  "case-insensitive filters",
+			query: "caseInsensitive=true&nickname=Punisher",
+			want: &model.GetUsersParams{
+				PageSize: 20,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+				FilterFields:    model.FilterFields{Nickname: model.Ptr("Punisher")},
+				CaseInsensitive: true,
+			},
+			wantErr: false,
+		},
+		{
+			name:         "invalid case-insensitive filters",
+			query:        "caseInsensitive=maybe",
+			wantErr:      true,
+			wantErrParam: "caseInsensitive",
+		},
 		{
 			name:  "all fields combined",
 			query: "pageSize=13&page=4&sortBy=first_name.desc&nickname=punisher&email=test@bubu.com",
@@ -259,26 +400,170 @@ func Test_parseGetUsersParams(t *testing.T) {
 					Type:  "desc",
 				},
 				FilterFields: model.FilterFields{
-					Nickname: "punisher",
-					Email:    "test@bubu.com",
+					Nickname: model.Ptr("punisher"),
+					Email:    model.Ptr("test@bubu.com"),
 				},
 			},
 			wantErr: false,
 		},
 		{
-			name:    "invalid page",
-			query:   "page=notNumber",
-			wantErr: true,
+			name:         "invalid page",
+			query:        "page=notNumber",
+			wantErr:      true,
+			wantErrParam: "page",
 		},
 		{
-			name:    "invalid page size",
-			query:   "pageSize=notNumber",
-			wantErr: true,
+			name:         "invalid page size",
+			query:        "pageSize=notNumber",
+			wantErr:      true,
+			wantErrParam: "pageSize",
 		},
 		{
-			name:    "invalid sort by",
-			query:   "sortBy=invalid_format",
-			wantErr: true,
+			name:         "invalid sort by",
+			query:        "sortBy=invalid_format",
+			wantErr:      true,
+			wantErrParam: "sortBy",
+		},
+		{
+			name:  "page size at max",
+			query: "pageSize=100",
+			want: &model.GetUsersParams{
+				PageSize: 100,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:         "page size over max",
+			query:        "pageSize=101",
+			wantErr:      true,
+			wantErrParam: "pageSize",
+		},
+		{
+			name:  "configured default page size",
+			query: "page=1",
+			opts:  []Opt{WithDefaultPageSize(50)},
+			want: &model.GetUsersParams{
+				PageSize: 50,
+				Page:     1,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+			},
+		},
+		{
+			name:  "sorting by allowed field",
+			query: "sortBy=created_at.desc",
+			opts:  []Opt{WithSortFields("last_name", "created_at")},
+			want: &model.GetUsersParams{
+				PageSize: 20,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "created_at",
+					Type:  "desc",
+				},
+			},
+		},
+		{
+			name:         "sorting by disabled field",
+			query:        "sortBy=email.asc",
+			opts:         []Opt{WithSortFields("last_name", "created_at")},
+			wantErr:      true,
+			wantErrParam: "sortBy",
+		},
+		{
+			name:  "filtering by allowed field",
+			query: "country=UK",
+			opts:  []Opt{WithFilterFields("country")},
+			want: &model.GetUsersParams{
+				PageSize: 20,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+				FilterFields: model.FilterFields{
+					Country: model.Ptr("UK"),
+				},
+			},
+		},
+		{
+			name:         "filtering by disabled field",
+			query:        "country=UK&email=john@wick.com",
+			opts:         []Opt{WithFilterFields("country")},
+			wantErr:      true,
+			wantErrParam: "email",
+		},
+		{
+			name:  "requested page size overrides configured default",
+			query: "pageSize=5",
+			opts:  []Opt{WithDefaultPageSize(50)},
+			want: &model.GetUsersParams{
+				PageSize: 5,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+			},
+		},
+		{
+			name:         "duplicate page - strict",
+			query:        "page=1&page=2",
+			opts:         []Opt{WithStrictQueryParams(true)},
+			wantErr:      true,
+			wantErrParam: "page",
+		},
+		{
+			name:         "duplicate pageSize - strict",
+			query:        "pageSize=5&pageSize=10",
+			opts:         []Opt{WithStrictQueryParams(true)},
+			wantErr:      true,
+			wantErrParam: "pageSize",
+		},
+		{
+			name:         "duplicate sortBy - strict",
+			query:        "sortBy=first_name.asc&sortBy=first_name.desc",
+			opts:         []Opt{WithStrictQueryParams(true)},
+			wantErr:      true,
+			wantErrParam: "sortBy",
+		},
+		{
+			name:         "duplicate filter - strict",
+			query:        "country=UK&country=DE",
+			opts:         []Opt{WithStrictQueryParams(true)},
+			wantErr:      true,
+			wantErrParam: "country",
+		},
+		{
+			name:  "duplicate page - first value used by default",
+			query: "page=1&page=2",
+			want: &model.GetUsersParams{
+				PageSize: 20,
+				Page:     1,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+			},
+		},
+		{
+			name:  "unknown duplicate - strict",
+			query: "unknown=1&unknown=2",
+			opts:  []Opt{WithStrictQueryParams(true)},
+			want: &model.GetUsersParams{
+				PageSize: 20,
+				Page:     0,
+				Sort: model.Sort{
+					Field: "last_name",
+					Type:  "asc",
+				},
+			},
 		},
 	}
 	for _, tt := range tests {
@@ -291,10 +576,100 @@ func Test_parseGetUsersParams(t *testing.T) {
 				},
 			}
 
-			got, err := parseGetUsersParams(&ctx)
+			got, err := parseGetUsersParams(&ctx, newHandlersConfig(tt.opts...))
 
 			assert.Equal(t, tt.wantErr, err != nil)
 			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				var paramErr *paramError
+				assert.Equal(t, true, errors.As(err, &paramErr))
+				assert.Equal(t, tt.wantErrParam, paramErr.parameter)
+			}
+		})
+	}
+}
+
+func Test_parseUserID(t *testing.T) {
+	v1 := uuid.Must(uuid.NewUUID())
+	v4 := uuid.New()
+
+	tests := []struct {
+		name    string
+		id      string
+		opts    []Opt
+		want    uuid.UUID
+		wantErr bool
+	}{
+		{
+			name: "any version by default - v1",
+			id:   v1.String(),
+			want: v1,
+		},
+		{
+			name: "any version by default - v4",
+			id:   v4.String(),
+			want: v4,
+		},
+		{
+			name: "expected version",
+			id:   v4.String(),
+			opts: []Opt{WithUserIDVersion(4)},
+			want: v4,
+		},
+		{
+			name:    "other version rejected",
+			id:      v1.String(),
+			opts:    []Opt{WithUserIDVersion(4)},
+			wantErr: true,
+		},
+		{
+			name:    "invalid format",
+			id:      "not-uuid",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := gin.Context{Params: gin.Params{{Key: userIDPathParam, Value: tt.id}}}
+
+			got, err := parseUserID(&ctx, newHandlersConfig(tt.opts...))
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseIntParam(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr string
+	}{
+		{value: "5", want: 5},
+		{value: " 5 ", want: 5},
+		{value: "0", want: 0},
+		{value: "-5", want: -5},
+		{value: "+5", wantErr: "page query parameter has to be a number without plus sign and leading zeros"},
+		{value: "007", wantErr: "page query parameter has to be a number without plus sign and leading zeros"},
+		{value: "-0", wantErr: "page query parameter has to be a number without plus sign and leading zeros"},
+		{value: "5 5", wantErr: "page query parameter has to be a number"},
+		{value: "", wantErr: "page query parameter has to be a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseIntParam("page", tt.value)
+
+			if tt.wantErr != "" {
+				var paramErr *paramError
+				assert.Equal(t, true, errors.As(err, &paramErr))
+				assert.Equal(t, tt.wantErr, paramErr.Error())
+				assert.Equal(t, codeInvalidParameter, paramErr.code)
+				assert.Equal(t, "page", paramErr.parameter)
+				return
+			}
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
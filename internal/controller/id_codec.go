@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"math/big"
+	"strings"
+)
+
+// IDCodec encodes the user IDs exposed in the responses and decodes them from the path parameters,
+// so the API can use other ID representation than the UUIDs the users are stored by.
+type IDCodec interface {
+	Encode(id uuid.UUID) string
+	Decode(id string) (uuid.UUID, error)
+}
+
+// UUIDCodec exposes the IDs as the canonical UUID strings.
+type UUIDCodec struct{}
+
+func (UUIDCodec) Encode(id uuid.UUID) string {
+	return id.String()
+}
+
+func (UUIDCodec) Decode(id string) (uuid.UUID, error) {
+	return uuid.Parse(id)
+}
+
+const base62IDLength = 22
+
+// Base62Codec exposes the IDs as 22 characters long base62 strings (0-9, a-z, A-Z) e.g. 0vSwKuMbR7424pqf5brSC0.
+type Base62Codec struct{}
+
+func (Base62Codec) Encode(id uuid.UUID) string {
+	encoded := new(big.Int).SetBytes(id[:]).Text(62)
+	return strings.Repeat("0", base62IDLength-len(encoded)) + encoded
+}
+
+func (Base62Codec) Decode(id string) (uuid.UUID, error) {
+	if len(id) != base62IDLength {
+		return uuid.Nil, fmt.Errorf("invalid base62 ID length: %d", len(id))
+	}
+	num, ok := new(big.Int).SetString(id, 62)
+	// 22 base62 characters can hold more than the 128 bits of UUID
+	if !ok || num.BitLen() > 8*len(uuid.UUID{}) {
+		return uuid.Nil, fmt.Errorf("invalid base62 ID: %s", id)
+	}
+	var decoded uuid.UUID
+	num.FillBytes(decoded[:])
+	return decoded, nil
+}
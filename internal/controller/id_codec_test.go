@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_IDCodecs_RoundTrip(t *testing.T) {
+	ids := []uuid.UUID{
+		uuid.Nil,
+		uuid.Max,
+		uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"),
+		uuid.New(),
+	}
+	for name, codec := range map[string]IDCodec{"uuid": UUIDCodec{}, "base62": Base62Codec{}} {
+		for _, id := range ids {
+			t.Run(name+" "+id.String(), func(t *testing.T) {
+				got, err := codec.Decode(codec.Encode(id))
+
+				assert.NoError(t, err)
+				assert.Equal(t, id, got)
+			})
+		}
+	}
+}
+
+func Test_Base62Codec(t *testing.T) {
+	codec := Base62Codec{}
+
+	assert.Equal(t, "0000000000000000000000", codec.Encode(uuid.Nil))
+	assert.Equal(t, "7N42dgm5tFLK9N8MT7fHC7", codec.Encode(uuid.Max))
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			id:   "0vUCpBzPVNzQHwkVlHq7WE",
+		},
+		{
+			name:    "too short",
+			id:      "0vUCpBzPVNzQHwkVlHq7W",
+			wantErr: true,
+		},
+		{
+			name:    "invalid character",
+			id:      "0vUCpBzPVNzQHwkVlHq7W-",
+			wantErr: true,
+		},
+		{
+			name:    "overflows UUID",
+			id:      "7N42dgm5tFLK9N8MT7fHC8",
+			wantErr: true,
+		},
+		{
+			name:    "UUID",
+			id:      "10e4feb6-40f9-11ef-a3eb-0242ac170004",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := codec.Decode(tt.id)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
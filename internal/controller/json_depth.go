@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+)
+
+// payloadTooDeepError is returned when reading the JSON payload nested deeper than the maximum depth.
+type payloadTooDeepError struct {
+	maxDepth int
+}
+
+func (e payloadTooDeepError) Error() string {
+	return fmt.Sprintf("payload is nested deeper than %d levels", e.maxDepth)
+}
+
+// depthLimitedReader fails reading the JSON payload as soon as its objects and arrays are nested deeper than
+// the maximum depth. It tracks only the brackets outside the strings, so the payload is not buffered
+// and the streamed payloads stay streamed.
+type depthLimitedReader struct {
+	r        io.ReadCloser
+	maxDepth int
+	depth    int
+	inString bool
+	escaped  bool
+	err      error
+}
+
+func (d *depthLimitedReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.r.Read(p)
+	for _, b := range p[:n] {
+		switch {
+		case d.escaped:
+			d.escaped = false
+		case d.inString:
+			switch b {
+			case '\\':
+				d.escaped = true
+			case '"':
+				d.inString = false
+			}
+		case b == '"':
+			d.inString = true
+		case b == '{' || b == '[':
+			d.depth++
+			if d.depth > d.maxDepth {
+				d.err = payloadTooDeepError{maxDepth: d.maxDepth}
+				return 0, d.err
+			}
+		case b == '}' || b == ']':
+			d.depth--
+		}
+	}
+	return n, err
+}
+
+func (d *depthLimitedReader) Close() error {
+	return d.r.Close()
+}
+
+// limitJSONDepth returns a middleware that makes reading the request payload fail once it is nested deeper
+// than the maximum depth, before the deeply nested values are decoded. The handlers report the read failure
+// as any other invalid payload. It does nothing if the maximum depth is zero.
+func limitJSONDepth(maxDepth int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxDepth > 0 && c.Request.Body != nil {
+			c.Request.Body = &depthLimitedReader{r: c.Request.Body, maxDepth: maxDepth}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/model"
+)
+
+func Test_MaxJSONDepth(t *testing.T) {
+	const validFields = `"first_name":"John","last_name":"Wick","nickname":"johnnywicky","password":"securepwd",` +
+		`"email":"johnnywicky@gmail.com","country":"UK"`
+
+	tests := []struct {
+		name            string
+		path            string
+		payload         string
+		wantStatusCode  int
+		wantFailureBody string
+	}{
+		{
+			name:           "nested up to the limit",
+			path:           "/v1/users",
+			payload:        `{"extra":{"a":[1]},` + validFields + `}`,
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "brackets in the strings are not nesting",
+			path:           "/v1/users",
+			payload:        `{"extra":"[[[{{{\"[[[",` + validFields + `}`,
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:            "deeply nested",
+			path:            "/v1/users",
+			payload:         `{"extra":` + strings.Repeat("[", 10_000) + strings.Repeat("]", 10_000) + `,` + validFields + `}`,
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"payload is nested deeper than 3 levels"}`,
+		},
+		{
+			name:            "deeply nested batch user",
+			path:            "/v1/users/batch",
+			payload:         `[{"extra":{"a":[1]},` + validFields + `}]`,
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"payload is nested deeper than 3 levels"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			serviceMock.On("CreateUser", mock.Anything, mock.Anything).Return(&model.User{ID: uuid.New()}, nil).Maybe()
+
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), serviceMock, WithMaxJSONDepth(3))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.payload)))
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantFailureBody != "" {
+				assert.Equal(t, tt.wantFailureBody, w.Body.String())
+				serviceMock.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
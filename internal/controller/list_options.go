@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"user-service/internal/model"
+)
+
+// usersAllowedMethods are the methods of the users collection path.
+const usersAllowedMethods = "GET, POST, OPTIONS"
+
+// listOptionsResponse describes the query parameters of the users list.
+type listOptionsResponse struct {
+	Pagination paginationOptions `json:"pagination"`
+	Sort       sortOptions       `json:"sort"`
+	// Filters are the query parameters the users can be filtered by.
+	Filters []string `json:"filters"`
+	// Params are the other query parameters with their accepted values.
+	Params []listOptionParam `json:"params"`
+}
+
+type paginationOptions struct {
+	Params          []string `json:"params"`
+	DefaultPageSize int      `json:"default_page_size"`
+	MaxPageSize     int      `json:"max_page_size"`
+}
+
+type sortOptions struct {
+	Param  string   `json:"param"`
+	Fields []string `json:"fields"`
+	// Types are the normalized sort types, their synonyms e.g. ascending or -1 are accepted too.
+	Types []string `json:"types"`
+}
+
+// describeUsersList returns a handler that responds with the supported query parameters of the users list.
+// They are derived from the same configuration the list parameters are parsed by, so the API describes itself
+// as it behaves.
+func describeUsersList(cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sortFields := make([]string, 0, len(cfg.sortFields))
+		for field := range cfg.sortFields {
+			sortFields = append(sortFields, field)
+		}
+		sort.Strings(sortFields)
+
+		filters := make([]string, 0, len(cfg.filterFields))
+		for _, field := range model.FilterableFields {
+			if _, ok := cfg.filterFields[field]; ok {
+				filters = append(filters, field)
+			}
+		}
+
+		c.Header("Allow", usersAllowedMethods)
+		c.JSON(http.StatusOK, listOptionsResponse{
+			Pagination: paginationOptions{
+				Params:          paginationQueryParams,
+				DefaultPageSize: cfg.defaultPageSize,
+				MaxPageSize:     cfg.maxPageSize,
+			},
+			Sort: sortOptions{
+				Param:  sortByQueryParam,
+				Fields: sortFields,
+				Types:  []string{"asc", "desc"},
+			},
+			Filters: filters,
+			Params:  usersListOptionParams(cfg),
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/model"
+)
+
+func Test_DescribeUsersListHandler(t *testing.T) {
+	describe := func(opts ...Opt) (*httptest.ResponseRecorder, listOptionsResponse) {
+		router := gin.New()
+		CreateUsersHandlers(router.Group("v1"), new(ServiceMock), opts...)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/v1/users", nil))
+
+		var resp listOptionsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w, resp
+	}
+
+	t.Run("supported params", func(t *testing.T) {
+		w, resp := describe()
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "GET, POST, OPTIONS", w.Header().Get("Allow"))
+		assert.Equal(t, []string{"pageSize", "page"}, resp.Pagination.Params)
+		assert.Equal(t, defaultPageSize, resp.Pagination.DefaultPageSize)
+		assert.Equal(t, defaultMaxPageSize, resp.Pagination.MaxPageSize)
+		assert.Equal(t, "sortBy", resp.Sort.Param)
+		assert.Len(t, resp.Sort.Fields, len(model.SortableFields))
+		for _, field := range resp.Sort.Fields {
+			assert.Contains(t, model.SortableFields, field)
+		}
+		for synonym := range sortTypeSynonyms {
+			assert.Contains(t, resp.Sort.Types, sortTypeSynonyms[synonym])
+		}
+		assert.Equal(t, model.FilterableFields, resp.Filters)
+		assert.Equal(t, []listOptionParam{
+			{Name: "includeHidden", Values: []string{"true", "false"}},
+			{Name: "caseInsensitive", Values: []string{"true", "false"}},
+			{Name: "compute", Values: []string{"age", "week"}},
+		}, resp.Params)
+	})
+
+	t.Run("configured params", func(t *testing.T) {
+		_, resp := describe(WithSortFields("nickname", "email"), WithFilterFields("country", "email_domain"), WithMaxPageSize(50))
+
+		assert.Equal(t, 50, resp.Pagination.MaxPageSize)
+		assert.Equal(t, []string{"email", "nickname"}, resp.Sort.Fields)
+		assert.Equal(t, []string{"country", "email_domain"}, resp.Filters)
+	})
+
+	t.Run("pretty param", func(t *testing.T) {
+		_, resp := describe(WithPrettyJSON(true))
+
+		assert.Contains(t, resp.Params, listOptionParam{Name: "pretty", Values: []string{"true", "false"}})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
+	storage_err "user-service/internal/errors"
 	"user-service/internal/model"
 )
 
@@ -16,18 +17,40 @@ func (m *ServiceMock) CreateUser(ctx context.Context, user model.User) (*model.U
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
+func (m *ServiceMock) CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]model.User, []storage_err.BatchItemError, error) {
+	args := m.Called(ctx, users, ordered)
+	created, _ := args.Get(0).([]model.User)
+	failures, _ := args.Get(1).([]storage_err.BatchItemError)
+	return created, failures, args.Error(2)
+}
+
 func (m *ServiceMock) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	args := m.Called(ctx, id)
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
+func (m *ServiceMock) GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
 func (m *ServiceMock) GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error) {
 	args := m.Called(ctx, params)
 	return args.Get(0).([]model.User), args.Error(1)
 }
 
-func (m *ServiceMock) UpdateUser(ctx context.Context, user model.User) error {
-	args := m.Called(ctx, user)
+func (m *ServiceMock) StreamUsers(ctx context.Context, params model.GetUsersParams, stream func(model.User) error) error {
+	args := m.Called(ctx, params, stream)
+	return args.Error(0)
+}
+
+func (m *ServiceMock) ExportUsers(ctx context.Context, maxUsers int, includeHidden bool, export func(model.User) error) (bool, error) {
+	args := m.Called(ctx, maxUsers, includeHidden, export)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *ServiceMock) UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) error {
+	args := m.Called(ctx, user, expected)
 	return args.Error(0)
 }
 
@@ -35,3 +58,13 @@ func (m *ServiceMock) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
+
+func (m *ServiceMock) TouchUser(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *ServiceMock) BulkUpdateUsers(ctx context.Context, update model.BulkUpdate) (int64, error) {
+	args := m.Called(ctx, update)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,364 @@
+package controller
+
+import (
+	"github.com/google/uuid"
+	"time"
+	"user-service/internal/model"
+)
+
+const (
+	defaultMaxPageSize    = 100
+	defaultPageSize       = 20
+	defaultExportMaxUsers = 1_000_000
+	defaultMaxFieldLength = 256
+)
+
+type Opt func(*handlersConfig)
+
+// WithMaxPageSize sets the maximum number of users the list endpoint returns in a single response.
+func WithMaxPageSize(size int) Opt {
+	return func(c *handlersConfig) {
+		c.maxPageSize = size
+	}
+}
+
+// WithDefaultPageSize sets the number of users the list endpoint returns when the page size is not requested.
+func WithDefaultPageSize(size int) Opt {
+	return func(c *handlersConfig) {
+		c.defaultPageSize = size
+	}
+}
+
+// WithEmptyListNoContent makes the list endpoint respond with 204 No Content instead of 200 with empty array when no user matches.
+func WithEmptyListNoContent(noContent bool) Opt {
+	return func(c *handlersConfig) {
+		c.emptyListNoContent = noContent
+	}
+}
+
+// WithTimeFormat sets the encoding of the user timestamps in responses.
+func WithTimeFormat(format TimeFormat) Opt {
+	return func(c *handlersConfig) {
+		c.timeFormat = format
+	}
+}
+
+// WithExportMaxUsers sets the maximum number of users the export endpoint returns, the export is truncated beyond it.
+func WithExportMaxUsers(maxUsers int) Opt {
+	return func(c *handlersConfig) {
+		c.exportMaxUsers = maxUsers
+	}
+}
+
+// WithExportFormat sets the format of the users export, NDJSON by default.
+func WithExportFormat(format ExportFormat) Opt {
+	return func(c *handlersConfig) {
+		c.exportFormat = format
+	}
+}
+
+// WithExportTimeout sets the deadline of the users export, the export is aborted when exceeded. No deadline is set when zero.
+func WithExportTimeout(timeout time.Duration) Opt {
+	return func(c *handlersConfig) {
+		c.exportTimeout = timeout
+	}
+}
+
+// WithResultTruncated tells the clients whether the users list is capped by the page size or is the full result.
+// The list is then wrapped in an envelope with the truncated flag and the X-Result-Truncated header is set.
+func WithResultTruncated(enabled bool) Opt {
+	return func(c *handlersConfig) {
+		c.resultTruncated = enabled
+	}
+}
+
+// WithListStreaming writes the users list as a JSON array while the users are read from the DB instead of buffering it.
+// An error during the streaming can't change the already sent status, the array is left unterminated instead.
+func WithListStreaming(enabled bool) Opt {
+	return func(c *handlersConfig) {
+		c.listStreaming = enabled
+	}
+}
+
+// WithStrictQueryParams rejects list requests repeating a single-value query parameter instead of using its first value.
+func WithStrictQueryParams(strict bool) Opt {
+	return func(c *handlersConfig) {
+		c.strictQueryParams = strict
+	}
+}
+
+// WithStrictPayloadFields rejects create and update payloads containing fields the clients cannot set by the operation.
+func WithStrictPayloadFields(strict bool) Opt {
+	return func(c *handlersConfig) {
+		c.strictPayloadFields = strict
+	}
+}
+
+// WithMaxFieldLengths overrides the maximum lengths in characters of the given user string fields, all of them default to 256.
+func WithMaxFieldLengths(maxLengths map[string]int) Opt {
+	return func(c *handlersConfig) {
+		for f, maxLength := range maxLengths {
+			c.maxFieldLengths[f] = maxLength
+		}
+	}
+}
+
+// WithSoftValidation accepts users with invalid values of the given fields, the failures are only logged and counted.
+func WithSoftValidation(fields ...string) Opt {
+	return func(c *handlersConfig) {
+		for _, f := range fields {
+			c.softValidationFields[f] = struct{}{}
+		}
+	}
+}
+
+// WithPasswordPersonalFieldsCheck rejects users whose password equals, ignoring case, their email, nickname, first or last name.
+func WithPasswordPersonalFieldsCheck(enabled bool) Opt {
+	return func(c *handlersConfig) {
+		c.passwordPersonalFieldsCheck = enabled
+	}
+}
+
+// WithEmailMXCheck requires the user email domains to have MX records, only the email syntax is validated by default.
+func WithEmailMXCheck(checker *MXChecker) Opt {
+	return func(c *handlersConfig) {
+		c.emailMXChecker = checker
+	}
+}
+
+// WithEventsStream enables the endpoint streaming the user events received from the subscriber.
+func WithEventsStream(subscriber EventsSubscriber) Opt {
+	return func(c *handlersConfig) {
+		c.eventsSubscriber = subscriber
+	}
+}
+
+// WithSortFields restricts the fields the users list can be sorted by, all the supported ones are allowed when none is given.
+func WithSortFields(fields ...string) Opt {
+	return func(c *handlersConfig) {
+		if len(fields) > 0 {
+			c.sortFields = model.FieldSet(fields)
+		}
+	}
+}
+
+// WithFilterFields restricts the filters of the users list, all the supported ones are allowed when none is given.
+func WithFilterFields(fields ...string) Opt {
+	return func(c *handlersConfig) {
+		if len(fields) > 0 {
+			c.filterFields = model.FieldSet(fields)
+		}
+	}
+}
+
+// WithClientTimestamps accepts the client supplied created_at and updated_at on user creation e.g. for migrations.
+// The timestamps are ignored by default.
+func WithClientTimestamps(allow bool) Opt {
+	return func(c *handlersConfig) {
+		c.clientTimestamps = allow
+	}
+}
+
+// WithUserIDVersion rejects the user IDs of other UUID versions than the given one. Any version is accepted by default.
+func WithUserIDVersion(version uuid.Version) Opt {
+	return func(c *handlersConfig) {
+		c.userIDVersion = version
+	}
+}
+
+// WithIDCodec sets the encoding of the user IDs in the responses and path parameters, UUIDCodec by default.
+func WithIDCodec(codec IDCodec) Opt {
+	return func(c *handlersConfig) {
+		c.idCodec = codec
+	}
+}
+
+// WithRejectMismatchedBodyID rejects updates whose body ID differs from the path one.
+// The body ID is overwritten by the path one by default.
+func WithRejectMismatchedBodyID(reject bool) Opt {
+	return func(c *handlersConfig) {
+		c.rejectMismatchedBodyID = reject
+	}
+}
+
+// WithHashedEmails tells the emails are stored hashed, so the clients can't read them back and the updates
+// can omit the email to keep the stored one.
+func WithHashedEmails(hashed bool) Opt {
+	return func(c *handlersConfig) {
+		c.hashedEmails = hashed
+	}
+}
+
+// WithReadOnlyMode rejects the writes while the mode is enabled. Admin handlers with it allow to toggle the mode.
+func WithReadOnlyMode(mode *ReadOnlyMode) Opt {
+	return func(c *handlersConfig) {
+		c.readOnlyMode = mode
+	}
+}
+
+// WithIndexer enables the admin endpoint (re)building the users DB indexes.
+func WithIndexer(indexer Indexer) Opt {
+	return func(c *handlersConfig) {
+		c.indexer = indexer
+	}
+}
+
+// WithEventsFlusher enables the admin endpoint producing the pending buffered events, waiting at most the timeout.
+func WithEventsFlusher(flusher EventsFlusher, timeout time.Duration) Opt {
+	return func(c *handlersConfig) {
+		c.eventsFlusher = flusher
+		c.eventsFlushTimeout = timeout
+	}
+}
+
+// WithValidationErrorDetails includes the DB explanation of the schema validation failures in the 400 responses.
+// Enabled by default, disable to not expose the DB schema to the clients.
+func WithValidationErrorDetails(enabled bool) Opt {
+	return func(c *handlersConfig) {
+		c.validationErrorDetails = enabled
+	}
+}
+
+// WithProblemDetails writes all the error responses as application/problem+json (RFC 7807). Otherwise only the clients
+// accepting application/problem+json get them, the others get the {"error":...} JSON.
+func WithProblemDetails(enabled bool) Opt {
+	return func(c *handlersConfig) {
+		c.problemDetails = enabled
+	}
+}
+
+// WithPrettyJSON allows the clients to request indented JSON responses by pretty=true query parameter e.g. for debugging
+// with curl. Disabled by default as the indented responses have to be buffered.
+func WithPrettyJSON(enabled bool) Opt {
+	return func(c *handlersConfig) {
+		c.prettyJSON = enabled
+	}
+}
+
+// WithEchoEvent allows the clients to request the produced user event in the create, update and delete responses
+// by echoEvent=true query parameter. Meant for debugging only, it's disabled by default.
+func WithEchoEvent(enabled bool) Opt {
+	return func(c *handlersConfig) {
+		c.echoEvent = enabled
+	}
+}
+
+// WithBatchStreaming decodes the batch payload while creating its users in chunks of the given size,
+// so the memory doesn't grow with the batch size. The payload is limited to maxBodyBytes, unlimited if zero.
+func WithBatchStreaming(chunkSize int, maxBodyBytes int64) Opt {
+	return func(c *handlersConfig) {
+		c.batchChunkSize = chunkSize
+		c.batchMaxBodyBytes = maxBodyBytes
+	}
+}
+
+// WithBatchLimits limits the batch payload to maxItems users and the number of the batches processed at once
+// to maxConcurrent, the batches over it are rejected rather than queued. Zero disables the limit.
+func WithBatchLimits(maxItems, maxConcurrent int) Opt {
+	return func(c *handlersConfig) {
+		c.batchMaxItems = maxItems
+		c.batchSlots = nil
+		if maxConcurrent > 0 {
+			c.batchSlots = make(chan struct{}, maxConcurrent)
+		}
+	}
+}
+
+// WithMaxJSONDepth rejects the JSON payloads with the objects and arrays nested deeper than the depth,
+// so the deeply nested payloads are not decoded. Zero disables the limit.
+func WithMaxJSONDepth(depth int) Opt {
+	return func(c *handlersConfig) {
+		c.maxJSONDepth = depth
+	}
+}
+
+// WithProfileAuditor sets the auditor of the user profile reads, the reads are logged by default.
+func WithProfileAuditor(auditor ProfileAuditor) Opt {
+	return func(c *handlersConfig) {
+		c.profileAuditor = auditor
+	}
+}
+
+type handlersConfig struct {
+	maxPageSize         int
+	defaultPageSize     int
+	emptyListNoContent  bool
+	resultTruncated     bool
+	listStreaming       bool
+	timeFormat          TimeFormat
+	exportMaxUsers      int
+	exportFormat        ExportFormat
+	exportTimeout       time.Duration
+	strictPayloadFields bool
+	strictQueryParams   bool
+	// rejectMismatchedBodyID rejects updates with body ID different from the path one instead of overwriting it
+	rejectMismatchedBodyID bool
+	// softValidationFields are the user fields whose validation failures don't reject the request
+	softValidationFields map[string]struct{}
+	// maxFieldLengths are the maximum lengths in characters of the user string fields
+	maxFieldLengths map[string]int
+	emailMXChecker  *MXChecker
+	// hashedEmails allows the updates to omit the email, as the stored hashes can't be sent back as valid emails
+	hashedEmails     bool
+	eventsSubscriber EventsSubscriber
+	sortFields       map[string]struct{}
+	filterFields     map[string]struct{}
+	clientTimestamps bool
+	// passwordPersonalFieldsCheck rejects the passwords matching the personal fields of the user
+	passwordPersonalFieldsCheck bool
+	// userIDVersion is the only accepted version of the user IDs, any is accepted if zero
+	userIDVersion uuid.Version
+	idCodec       IDCodec
+	echoEvent     bool
+	readOnlyMode  *ReadOnlyMode
+	indexer       Indexer
+	// eventsFlusher produces the buffered events, waiting at most eventsFlushTimeout
+	eventsFlusher      EventsFlusher
+	eventsFlushTimeout time.Duration
+	// validationErrorDetails includes the DB explanation of the schema validation failures in the responses
+	validationErrorDetails bool
+	// problemDetails writes the errors as application/problem+json regardless of the Accept header
+	problemDetails bool
+	prettyJSON     bool
+	profileAuditor ProfileAuditor
+	// batchChunkSize is the number of the batch users created at once while the payload is streamed, not streamed if zero
+	batchChunkSize    int
+	batchMaxBodyBytes int64
+	// batchMaxItems is the maximum number of the users in the batch, unlimited if zero
+	batchMaxItems int
+	// batchSlots are the slots of the concurrently processed batches, unlimited if nil
+	batchSlots chan struct{}
+	// maxJSONDepth is the maximum nesting depth of the JSON payloads, unlimited if zero
+	maxJSONDepth int
+}
+
+func newHandlersConfig(opts ...Opt) handlersConfig {
+	cfg := handlersConfig{
+		maxPageSize:            defaultMaxPageSize,
+		defaultPageSize:        defaultPageSize,
+		timeFormat:             TimeFormatRFC3339,
+		exportMaxUsers:         defaultExportMaxUsers,
+		exportFormat:           ExportFormatNDJSON,
+		idCodec:                UUIDCodec{},
+		validationErrorDetails: true,
+		profileAuditor:         LogProfileAuditor{},
+		softValidationFields:   map[string]struct{}{},
+		maxFieldLengths: map[string]int{
+			"first_name": defaultMaxFieldLength,
+			"last_name":  defaultMaxFieldLength,
+			"nickname":   defaultMaxFieldLength,
+			"password":   defaultMaxFieldLength,
+			"email":      defaultMaxFieldLength,
+			"country":    defaultMaxFieldLength,
+			"phone":      defaultMaxFieldLength,
+		},
+		sortFields:   model.FieldSet(model.SortableFields),
+		filterFields: model.FieldSet(model.FilterableFields),
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// createPayloadFields are the user fields the clients can set on create. ID and timestamps are server generated.
+var createPayloadFields = map[string]struct{}{
+	"first_name": {},
+	"last_name":  {},
+	"nickname":   {},
+	"password":   {},
+	"email":      {},
+	"country":    {},
+	"phone":      {},
+}
+
+// importPayloadFields are the user fields the clients can set on create when the client timestamps are allowed.
+var importPayloadFields = map[string]struct{}{
+	"first_name": {},
+	"last_name":  {},
+	"nickname":   {},
+	"password":   {},
+	"email":      {},
+	"country":    {},
+	"phone":      {},
+	"created_at": {},
+	"updated_at": {},
+}
+
+// updatePayloadFields are the user fields the clients can set on update. ID is allowed as clients
+// often send back the whole user they read, timestamps are server generated. The if holds the expected current field values.
+var updatePayloadFields = map[string]struct{}{
+	"id":         {},
+	"if":         {},
+	"first_name": {},
+	"last_name":  {},
+	"nickname":   {},
+	"password":   {},
+	"email":      {},
+	"country":    {},
+	"phone":      {},
+}
+
+// allowedPayloadFields returns a middleware that rejects JSON object payloads containing fields
+// not allowed for the operation. It does nothing unless the strict payload fields are enabled.
+func allowedPayloadFields(cfg handlersConfig, allowed map[string]struct{}, operation string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.strictPayloadFields {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
+			return
+		}
+		// the handler binds the payload again
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			// invalid payloads are reported by the handler binding
+			c.Next()
+			return
+		}
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := allowed[name]; !ok {
+				respondError(c, http.StatusBadRequest, apiError{Error: fmt.Sprintf("field %q is not allowed on %s", name, operation)}, cfg)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
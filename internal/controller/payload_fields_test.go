@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/model"
+)
+
+func Test_AllowedPayloadFields(t *testing.T) {
+	userID := uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")
+	const validFields = `"first_name":"John","last_name":"Wick","nickname":"johnnywicky","password":"securepwd",` +
+		`"email":"johnnywicky@gmail.com","country":"UK"`
+
+	tests := []struct {
+		name            string
+		strict          bool
+		method          string
+		payload         string
+		wantStatusCode  int
+		wantFailureBody string
+	}{
+		{
+			name:           "create with allowed fields",
+			strict:         true,
+			method:         http.MethodPost,
+			payload:        `{` + validFields + `}`,
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:            "create with server generated id",
+			strict:          true,
+			method:          http.MethodPost,
+			payload:         `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004",` + validFields + `}`,
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"field \"id\" is not allowed on create"}`,
+		},
+		{
+			name:           "update with id",
+			strict:         true,
+			method:         http.MethodPut,
+			payload:        `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004",` + validFields + `}`,
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:            "update with server generated timestamp",
+			strict:          true,
+			method:          http.MethodPut,
+			payload:         `{"created_at":"2024-07-13T09:19:54.625Z",` + validFields + `}`,
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"field \"created_at\" is not allowed on update"}`,
+		},
+		{
+			name:            "update with unknown field",
+			strict:          true,
+			method:          http.MethodPut,
+			payload:         `{"role":"admin",` + validFields + `}`,
+			wantStatusCode:  http.StatusBadRequest,
+			wantFailureBody: `{"error":"field \"role\" is not allowed on update"}`,
+		},
+		{
+			name:           "not strict ignores the fields",
+			method:         http.MethodPost,
+			payload:        `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","role":"admin",` + validFields + `}`,
+			wantStatusCode: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			serviceMock.On("CreateUser", mock.Anything, mock.Anything).Return(&model.User{ID: userID}, nil).Maybe()
+			serviceMock.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), serviceMock, WithStrictPayloadFields(tt.strict))
+			w := httptest.NewRecorder()
+			path := "/v1/users"
+			if tt.method == http.MethodPut {
+				path += "/" + userID.String()
+			}
+
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, path, strings.NewReader(tt.payload)))
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantFailureBody != "" {
+				assert.Equal(t, tt.wantFailureBody, w.Body.String())
+				serviceMock.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+				serviceMock.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const prettyQueryParam = "pretty"
+
+// prettyJSONWriter buffers the JSON response body, so it can be indented once the handler finishes.
+// The other responses e.g. the NDJSON export or the event stream are written through.
+type prettyJSONWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *prettyJSONWriter) Write(data []byte) (int, error) {
+	if !isJSONContentType(w.Header().Get("Content-Type")) {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *prettyJSONWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// prettyJSON returns a middleware that indents the JSON responses of the requests with pretty=true query parameter,
+// e.g. for reading them in the terminal. The response is buffered, so the streamed lists are written only once complete.
+func prettyJSON(cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.GetQuery(prettyQueryParam)
+		if !ok {
+			c.Next()
+			return
+		}
+		pretty, err := strconv.ParseBool(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, apiError{
+				Error:     "pretty query parameter has to be a boolean",
+				Code:      codeInvalidParameter,
+				Parameter: prettyQueryParam,
+			}, cfg)
+			return
+		}
+		if !pretty {
+			c.Next()
+			return
+		}
+
+		writer := &prettyJSONWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		body := writer.body.Bytes()
+		if len(body) == 0 {
+			c.Writer.WriteHeaderNow()
+			return
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err != nil {
+			// e.g. a list stream failed mid-way, the body is written as is
+			_, _ = c.Writer.Write(body)
+			return
+		}
+		_, _ = c.Writer.Write(indented.Bytes())
+	}
+}
+
+// isJSONContentType returns true for application/json and the JSON based media types e.g. application/problem+json.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func Test_PrettyJSON(t *testing.T) {
+	createdAt := time.Date(2024, 7, 13, 9, 19, 54, 625_000_000, time.UTC)
+	user := model.User{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"), FirstName: "John", LastName: "Wick",
+		Nickname: "johnny", Email: "john@gmail.com", Country: "UK", CreatedAt: createdAt, UpdatedAt: createdAt}
+	serviceMock := new(ServiceMock)
+	serviceMock.On("GetUserByID", mock.Anything, user.ID).Return(&user, nil)
+
+	compact := `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John","last_name":"Wick","nickname":"johnny",` +
+		`"email":"john@gmail.com","country":"UK","created_at":"2024-07-13T09:19:54.625Z","updated_at":"2024-07-13T09:19:54.625Z"}`
+	pretty := `{
+  "id": "10e4feb6-40f9-11ef-a3eb-0242ac170004",
+  "first_name": "John",
+  "last_name": "Wick",
+  "nickname": "johnny",
+  "email": "john@gmail.com",
+  "country": "UK",
+  "created_at": "2024-07-13T09:19:54.625Z",
+  "updated_at": "2024-07-13T09:19:54.625Z"
+}`
+
+	tests := []struct {
+		name       string
+		opts       []Opt
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "compact by default",
+			opts:       []Opt{WithPrettyJSON(true)},
+			wantStatus: http.StatusOK,
+			wantBody:   compact,
+		},
+		{
+			name:       "pretty on request",
+			opts:       []Opt{WithPrettyJSON(true)},
+			query:      "?pretty=true",
+			wantStatus: http.StatusOK,
+			wantBody:   pretty,
+		},
+		{
+			name:       "compact when disabled",
+			query:      "?pretty=true",
+			wantStatus: http.StatusOK,
+			wantBody:   compact,
+		},
+		{
+			name:       "invalid value",
+			opts:       []Opt{WithPrettyJSON(true)},
+			query:      "?pretty=yes",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"pretty query parameter has to be a boolean","code":"invalid_parameter","parameter":"pretty"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), serviceMock, tt.opts...)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/"+user.ID.String()+tt.query, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		})
+	}
+}
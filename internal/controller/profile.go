@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+	"user-service/internal/auth"
+)
+
+// ProfileAuditor records the privileged reads of the user profiles.
+type ProfileAuditor interface {
+	ProfileAccessed(ctx context.Context, access ProfileAccess)
+}
+
+// ProfileAccess is the audited read of the user profile.
+type ProfileAccess struct {
+	UserID uuid.UUID `json:"-"`
+	// AccessedBy is the authenticated subject that read the profile, empty for unauthenticated ones.
+	AccessedBy string    `json:"accessed_by,omitempty"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// LogProfileAuditor logs the user profile reads.
+type LogProfileAuditor struct{}
+
+func (LogProfileAuditor) ProfileAccessed(_ context.Context, access ProfileAccess) {
+	logrus.WithField("user_id", access.UserID).
+		WithField("accessed_by", access.AccessedBy).
+		WithField("accessed_at", access.AccessedAt).
+		Info("user profile accessed")
+}
+
+// requireAuthenticatedCaller returns a middleware that rejects the requests without the authenticated subject
+// with 401 Unauthorized, so every audited read is attributed.
+func requireAuthenticatedCaller(cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth.SubjectFromContext(c.Request.Context()) == "" {
+			respondError(c, http.StatusUnauthorized, apiError{Error: "authenticated caller is required", Code: codeUnauthenticated}, cfg)
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireAdminCaller returns a middleware rejecting the callers not authenticated as admins by the admin API key.
+func requireAdminCaller(cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.IsAdmin(c.Request.Context()) {
+			respondError(c, http.StatusForbidden, apiError{Error: "admin caller is required", Code: codeForbidden}, cfg)
+			return
+		}
+		c.Next()
+	}
+}
+
+// getUserProfile returns a handler that returns the user without the password and with the audit note
+// for the support tooling. Every successful read is reported to the profile auditor.
+func getUserProfile(svc Service, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := parseUserID(c, cfg)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: fmt.Sprintf("incorrect user ID format: %v", err.Error())}, cfg)
+			return
+		}
+
+		user, err := svc.GetUserProfile(c, userID)
+		if err != nil {
+			respondServiceError(c, err, cfg)
+			return
+		}
+		// the storage never reads it, cleared also here so no storage implementation can leak it
+		user.Password = ""
+
+		access := ProfileAccess{
+			UserID:     userID,
+			AccessedBy: auth.SubjectFromContext(c.Request.Context()),
+			AccessedAt: time.Now().UTC(),
+		}
+		cfg.profileAuditor.ProfileAccessed(c.Request.Context(), access)
+
+		resp := newUserResponse(*user, cfg)
+		resp.audit = &access
+		c.JSON(http.StatusOK, resp)
+	}
+}
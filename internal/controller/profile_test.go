@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/auth"
+	storage_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+type profileAuditorStub struct {
+	accesses []ProfileAccess
+}
+
+func (a *profileAuditorStub) ProfileAccessed(_ context.Context, access ProfileAccess) {
+	a.accesses = append(a.accesses, access)
+}
+
+func Test_GetUserProfileHandler(t *testing.T) {
+	user := model.User{ID: uuid.New(), FirstName: "anna", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com"}
+	missing := uuid.New()
+	serviceMock := new(ServiceMock)
+	serviceMock.On("GetUserProfile", mock.Anything, user.ID).Return(&user, nil)
+	serviceMock.On("GetUserProfile", mock.Anything, missing).Return((*model.User)(nil), storage_err.NotFoundError)
+	auditor := &profileAuditorStub{}
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(auth.TrustedHeaderSubjectMiddleware("X-Subject"))
+	CreateUsersHandlers(router.Group("v1"), serviceMock, WithProfileAuditor(auditor))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/"+user.ID.String()+"/profile", nil)
+	req.Header.Set("X-Subject", "support-agent")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, user.ID.String(), body["id"])
+	assert.NotContains(t, body, "password")
+	require.Contains(t, body, "_audit")
+	assert.Equal(t, "support-agent", body["_audit"].(map[string]any)["accessed_by"])
+	require.Len(t, auditor.accesses, 1)
+	assert.Equal(t, user.ID, auditor.accesses[0].UserID)
+	assert.Equal(t, "support-agent", auditor.accesses[0].AccessedBy)
+
+	// failed reads are not audited
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/v1/users/"+missing.String()+"/profile", nil)
+	req.Header.Set("X-Subject", "support-agent")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Len(t, auditor.accesses, 1)
+
+	// unauthenticated reads are rejected
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/"+user.ID.String()+"/profile", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error":"authenticated caller is required","code":"unauthenticated"}`, w.Body.String())
+	assert.Len(t, auditor.accesses, 1)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync/atomic"
+)
+
+// ReadOnlyMode rejects the user writes while enabled e.g. during a migration window. It can be toggled at runtime.
+type ReadOnlyMode struct {
+	enabled atomic.Bool
+}
+
+// NewReadOnlyMode creates new ReadOnlyMode in the given state.
+func NewReadOnlyMode(enabled bool) *ReadOnlyMode {
+	m := &ReadOnlyMode{}
+	m.enabled.Store(enabled)
+	return m
+}
+
+// Enabled returns true if the writes are rejected.
+func (m *ReadOnlyMode) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// SetEnabled enables or disables the read-only mode.
+func (m *ReadOnlyMode) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+type readOnlyRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// rejectWritesIfReadOnly returns a middleware that rejects the requests with 503 Service Unavailable while the read-only mode is enabled.
+func rejectWritesIfReadOnly(cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.readOnlyMode != nil && cfg.readOnlyMode.Enabled() {
+			respondError(c, http.StatusServiceUnavailable, apiError{Error: "service is in read-only mode"}, cfg)
+			return
+		}
+		c.Next()
+	}
+}
+
+// setReadOnly returns a handler that enables or disables the read-only mode and responds with the new state.
+func setReadOnly(mode *ReadOnlyMode, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req readOnlyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: err.Error()}, cfg)
+			return
+		}
+		if req.Enabled == nil {
+			respondError(c, http.StatusBadRequest, apiError{Error: "enabled is required"}, cfg)
+			return
+		}
+
+		mode.SetEnabled(*req.Enabled)
+		c.JSON(http.StatusOK, gin.H{"enabled": mode.Enabled()})
+	}
+}
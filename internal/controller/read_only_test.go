@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_SetReadOnly(t *testing.T) {
+	tests := []struct {
+		name           string
+		initial        bool
+		body           string
+		wantStatusCode int
+		wantBody       string
+		wantEnabled    bool
+	}{
+		{
+			name:           "enable",
+			body:           `{"enabled":true}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"enabled":true}`,
+			wantEnabled:    true,
+		},
+		{
+			name:           "disable",
+			initial:        true,
+			body:           `{"enabled":false}`,
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"enabled":false}`,
+		},
+		{
+			name:           "missing enabled",
+			initial:        true,
+			body:           `{}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"enabled is required"}`,
+			wantEnabled:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := NewReadOnlyMode(tt.initial)
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/admin/readonly", strings.NewReader(tt.body))
+
+			setReadOnly(mode, newHandlersConfig())(ctx)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantEnabled, mode.Enabled())
+		})
+	}
+}
+
+func Test_ReadOnlyMode_ToggledAtRuntime(t *testing.T) {
+	userID := uuid.New()
+	serviceMock := new(ServiceMock)
+	serviceMock.On("DeleteUser", mock.Anything, userID).Return(nil)
+	mode := NewReadOnlyMode(false)
+
+	router := gin.New()
+	v1 := router.Group("v1")
+	CreateUsersHandlers(v1, serviceMock, WithReadOnlyMode(mode))
+	CreateAdminHandlers(v1.Group("admin"), serviceMock, WithReadOnlyMode(mode))
+	toggle := func(body string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/readonly", strings.NewReader(body)))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	deleteUser := func() int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/users/"+userID.String(), nil))
+		return w.Code
+	}
+
+	toggle(`{"enabled":true}`)
+	assert.Equal(t, http.StatusServiceUnavailable, deleteUser())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/admin/bulk-update", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// the rejection is a problem like the other errors for the clients accepting it
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/v1/users/"+userID.String(), nil)
+	req.Header.Set("Accept", problemJSONContentType)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, problemJSONContentType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Service Unavailable","status":503,"detail":"service is in read-only mode",
+		"instance":"/v1/users/`+userID.String()+`"}`, w.Body.String())
+
+	toggle(`{"enabled":false}`)
+	assert.Equal(t, http.StatusNoContent, deleteUser())
+	serviceMock.AssertNumberOfCalls(t, "DeleteUser", 1)
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	storage_err "user-service/internal/errors"
+)
+
+// respondServiceError aborts the request with the status and structured body the service error maps to.
+// The DB explanation of the validation failures is included unless disabled. Unexpected errors are logged.
+func respondServiceError(c *gin.Context, err error, cfg handlersConfig) {
+	status := storage_err.HTTPStatus(err)
+	resp := apiError{Error: storage_err.Message(err)}
+	switch status {
+	case http.StatusBadRequest:
+		var invalidParamErr *storage_err.InvalidParameterError
+		errors.As(err, &invalidParamErr)
+		resp = newInvalidParamError(invalidParamErr).apiError()
+	case http.StatusNotFound:
+		// the ID as requested by the client, so it can be logged without parsing the message, empty without the path ID
+		resp.Code, resp.ID = codeUserNotFound, c.Param(userIDPathParam)
+	case http.StatusConflict:
+		resp.Code = codeConflict
+	case http.StatusPreconditionFailed:
+		resp.Code = codePreconditionFailed
+	case http.StatusUnprocessableEntity:
+		resp.Code = codeValidationFailed
+		if cfg.validationErrorDetails {
+			var validationErr *storage_err.ValidationError
+			errors.As(err, &validationErr)
+			resp.Details = validationErr.Details()
+		}
+	case http.StatusServiceUnavailable:
+		resp.Code = codeUnavailable
+	case http.StatusGatewayTimeout:
+		resp.Code = codeTimeout
+	default:
+		status = http.StatusInternalServerError
+		logrus.WithError(err).
+			WithField("method", c.Request.Method).
+			WithField("path", c.FullPath()).
+			Error("request failed")
+		resp.Code = codeInternalError
+	}
+
+	respondError(c, status, resp, cfg)
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	storage_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+func Test_respondServiceError(t *testing.T) {
+	details := map[string]any{"operatorName": "$jsonSchema"}
+
+	tests := []struct {
+		name       string
+		err        error
+		opts       []Opt
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "not found",
+			err:        storage_err.NotFoundError,
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error":"user not found","code":"user_not_found"}`,
+		},
+		{
+			name:       "conflict",
+			err:        fmt.Errorf("create user: %w", storage_err.NewConflictError("nickname already exists")),
+			wantStatus: http.StatusConflict,
+			wantBody:   `{"error":"nickname already exists","code":"conflict"}`,
+		},
+		{
+			name:       "precondition failed",
+			err:        storage_err.PreconditionFailedError,
+			wantStatus: http.StatusPreconditionFailed,
+			wantBody:   `{"error":"user doesn't match the expected field values","code":"precondition_failed"}`,
+		},
+		{
+			name:       "validation",
+			err:        storage_err.NewValidationError("user failed the DB validation", details),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"error":"user failed the DB validation","code":"validation_failed","details":{"operatorName":"$jsonSchema"}}`,
+		},
+		{
+			name:       "validation without details",
+			err:        storage_err.NewValidationError("user failed the DB validation", details),
+			opts:       []Opt{WithValidationErrorDetails(false)},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"error":"user failed the DB validation","code":"validation_failed"}`,
+		},
+		{
+			name:       "invalid parameter",
+			err:        fmt.Errorf("find users: %w", storage_err.NewInvalidParameterError("email_domain", "email domain filter is not supported with hashed emails")),
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"email domain filter is not supported with hashed emails","code":"invalid_parameter","parameter":"email_domain"}`,
+		},
+		{
+			name:       "deadline",
+			err:        fmt.Errorf("find users: %w", context.DeadlineExceeded),
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   `{"error":"request timed out","code":"timeout"}`,
+		},
+		{
+			name:       "server selection",
+			err:        topology.ServerSelectionError{Wrapped: topology.ErrServerSelectionTimeout},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"error":"service temporarily unavailable","code":"unavailable"}`,
+		},
+		{
+			name:       "circuit open",
+			err:        storage_err.CircuitOpenError,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"error":"service temporarily unavailable","code":"unavailable"}`,
+		},
+		{
+			name:       "unknown",
+			err:        errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal server error","code":"internal_error"}`,
+		},
+		{
+			// not expected from the user handlers, mapped to the generic failure
+			name:       "not attempted",
+			err:        storage_err.NotAttemptedError,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal server error","code":"internal_error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+
+			respondServiceError(ctx, tt.err, newHandlersConfig(tt.opts...))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.True(t, ctx.IsAborted())
+		})
+	}
+}
+
+func Test_InvalidParameter_ConsistentAcrossLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		params   model.GetUsersParams
+		wantBody string
+	}{
+		{
+			name:     "negative page size",
+			query:    "pageSize=-1",
+			params:   model.GetUsersParams{PageSize: -1, Sort: model.Sort{Field: "last_name"}},
+			wantBody: `{"error":"pageSize cannot be a negative number","code":"parameter_out_of_range","parameter":"pageSize"}`,
+		},
+		{
+			name:     "negative page",
+			query:    "page=-1",
+			params:   model.GetUsersParams{Page: -1, Sort: model.Sort{Field: "last_name"}},
+			wantBody: `{"error":"page cannot be a negative number","code":"parameter_out_of_range","parameter":"page"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// rejected by the controller
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), new(ServiceMock))
+			controllerW := httptest.NewRecorder()
+			router.ServeHTTP(controllerW, httptest.NewRequest(http.MethodGet, "/v1/users?"+tt.query, nil))
+
+			// rejected by the storage
+			storageW := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(storageW)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+			respondServiceError(ctx, fmt.Errorf("find users: %w", tt.params.Validate()), newHandlersConfig())
+
+			assert.Equal(t, http.StatusBadRequest, controllerW.Code)
+			assert.Equal(t, tt.wantBody, controllerW.Body.String())
+			assert.Equal(t, controllerW.Code, storageW.Code)
+			assert.Equal(t, controllerW.Body.String(), storageW.Body.String())
+		})
+	}
+}
+
+func Test_UserNotFoundDetails(t *testing.T) {
+	missing := uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")
+	const valid = `{"first_name":"John","last_name":"Wick","nickname":"johnnywicky","password":"securepwd",` +
+		`"email":"johnnywicky@gmail.com","country":"UK"}`
+
+	tests := []struct {
+		name     string
+		opts     []Opt
+		method   string
+		path     string
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "get",
+			method:   http.MethodGet,
+			path:     "/v1/users/" + missing.String(),
+			wantBody: `{"error":"user not found","code":"user_not_found","id":"10e4feb6-40f9-11ef-a3eb-0242ac170004"}`,
+		},
+		{
+			name:     "update",
+			method:   http.MethodPut,
+			path:     "/v1/users/" + missing.String(),
+			body:     valid,
+			wantBody: `{"error":"user not found","code":"user_not_found","id":"10e4feb6-40f9-11ef-a3eb-0242ac170004"}`,
+		},
+		{
+			name:     "delete",
+			method:   http.MethodDelete,
+			path:     "/v1/users/" + missing.String(),
+			wantBody: `{"error":"user not found","code":"user_not_found","id":"10e4feb6-40f9-11ef-a3eb-0242ac170004"}`,
+		},
+		{
+			name:     "ID as requested",
+			opts:     []Opt{WithIDCodec(Base62Codec{})},
+			method:   http.MethodGet,
+			path:     "/v1/users/" + Base62Codec{}.Encode(missing),
+			wantBody: `{"error":"user not found","code":"user_not_found","id":"` + Base62Codec{}.Encode(missing) + `"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			serviceMock.On("GetUserByID", mock.Anything, missing).Return((*model.User)(nil), storage_err.NotFoundError).Maybe()
+			serviceMock.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(storage_err.NotFoundError).Maybe()
+			serviceMock.On("DeleteUser", mock.Anything, missing).Return(storage_err.NotFoundError).Maybe()
+
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), serviceMock, tt.opts...)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"user-service/internal/model"
+)
+
+type EventsSubscriber interface {
+	Subscribe() (<-chan any, func())
+}
+
+// streamUserEvents returns a handler that streams the user events as Server-Sent Events until the client disconnects.
+func streamUserEvents(subscriber EventsSubscriber, cfg handlersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, unsubscribe := subscriber.Subscribe()
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					// subscription closed e.g. on server shutdown
+					return
+				}
+				c.SSEvent(sseEventName(event), sseEventData(event, cfg))
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+func sseEventName(event any) string {
+	if e, ok := event.(model.UserEvent); ok {
+		return string(e.Action)
+	}
+	return "message"
+}
+
+// sseEventData returns the user event as exposed to the API clients without the password, as the stream is public.
+func sseEventData(event any, cfg handlersConfig) any {
+	e, ok := event.(model.UserEvent)
+	if !ok {
+		return event
+	}
+	if user, ok := e.UserData.(model.User); ok {
+		user.Password = ""
+		e.UserData = user
+	}
+	return newEventResponse(e, cfg)
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-service/internal/auth"
+	"user-service/internal/model"
+)
+
+type subscriberStub struct {
+	events       chan any
+	unsubscribed chan struct{}
+}
+
+func (s *subscriberStub) Subscribe() (<-chan any, func()) {
+	return s.events, func() { close(s.unsubscribed) }
+}
+
+func Test_StreamUserEvents(t *testing.T) {
+	subscriber := &subscriberStub{events: make(chan any, 1), unsubscribed: make(chan struct{})}
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(auth.AdminAPIKeyMiddleware("X-Admin-Api-Key", "secret"))
+	CreateUsersHandlers(router.Group("v1"), new(ServiceMock), WithEventsStream(subscriber))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// the anonymous callers can't stream the events
+	anonymous, err := http.Get(server.URL + "/v1/users/stream")
+	require.NoError(t, err)
+	_ = anonymous.Body.Close()
+	assert.Equal(t, http.StatusForbidden, anonymous.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/users/stream", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Admin-Api-Key", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	user := model.User{
+		ID:        uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"),
+		FirstName: "John",
+		LastName:  "Wick",
+		Nickname:  "johnnywicky",
+		Password:  "securepwd",
+		Email:     "johnnywicky@gmail.com",
+		Country:   "UK",
+		CreatedAt: time.Date(2024, 7, 13, 9, 19, 54, 625000000, time.UTC),
+		UpdatedAt: time.Date(2024, 7, 13, 9, 19, 54, 625000000, time.UTC),
+	}
+	subscriber.events <- model.NewUserCreatedEvent(user)
+
+	// read single SSE event - lines until the empty line
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []string{
+		"event:created",
+		`data:{"action":"created","user_data":{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John",` +
+			`"last_name":"Wick","nickname":"johnnywicky","email":"johnnywicky@gmail.com","country":"UK",` +
+			`"created_at":"2024-07-13T09:19:54.625Z","updated_at":"2024-07-13T09:19:54.625Z"}}`,
+	}, lines)
+
+	// client disconnect has to cancel the subscription
+	cancel()
+	select {
+	case <-subscriber.unsubscribed:
+	case <-time.After(time.Second):
+		t.Fatal("subscription not cancelled after client disconnect")
+	}
+}
+
+func Test_sseEventData(t *testing.T) {
+	user := model.User{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"), Nickname: "johnnywicky", Password: "securepwd"}
+	cfg := newHandlersConfig(WithIDCodec(Base62Codec{}))
+
+	data, err := json.Marshal(sseEventData(model.NewUserUpdatedEvent(user), cfg))
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"action":"updated","user_data":{"id":"`+Base62Codec{}.Encode(user.ID)+`","first_name":"","last_name":"",`+
+		`"nickname":"johnnywicky","email":"","country":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}}`, string(data))
+	assert.Equal(t, "heartbeat", sseEventData("heartbeat", cfg))
+}
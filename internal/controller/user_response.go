@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"encoding/json"
+	"user-service/internal/model"
+)
+
+type TimeFormat string
+
+const (
+	TimeFormatRFC3339     TimeFormat = "rfc3339"
+	TimeFormatEpochMillis TimeFormat = "epoch_millis"
+)
+
+// resultTruncatedHeader tells whether more users match the list request than were returned.
+const resultTruncatedHeader = "X-Result-Truncated"
+
+// userResponse is the JSON representation of the user returned by the handlers.
+type userResponse struct {
+	user       model.User
+	timeFormat TimeFormat
+	idCodec    IDCodec
+	// computed are the requested derived fields, nil if none
+	computed *computedFields
+	// audit is the note of the audited profile read, nil for the other reads
+	audit *ProfileAccess
+}
+
+func newUserResponse(user model.User, cfg handlersConfig) userResponse {
+	return userResponse{
+		user:       user,
+		timeFormat: cfg.timeFormat,
+		idCodec:    cfg.idCodec,
+	}
+}
+
+func newUsersResponse(users []model.User, cfg handlersConfig) []userResponse {
+	resp := make([]userResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, newUserResponse(u, cfg))
+	}
+	return resp
+}
+
+// usersListResponse is the users list envelope telling whether the list is capped by the page size.
+type usersListResponse struct {
+	Users     []userResponse `json:"users"`
+	Truncated bool           `json:"truncated"`
+}
+
+func (u userResponse) MarshalJSON() ([]byte, error) {
+	// fields of the embedded alias are shadowed by the outer ones, ID is first to keep it first in the JSON
+	type alias model.User
+	id := u.user.ID.String()
+	if u.idCodec != nil {
+		id = u.idCodec.Encode(u.user.ID)
+	}
+	accountAgeDays := u.computed.accountAgeDays(u.user)
+	createdWeek := u.computed.createdWeek(u.user)
+	if u.timeFormat != TimeFormatEpochMillis {
+		return json.Marshal(struct {
+			ID string `json:"id"`
+			alias
+			AccountAgeDays *int           `json:"account_age_days,omitempty"`
+			CreatedWeek    *string        `json:"created_week,omitempty"`
+			Audit          *ProfileAccess `json:"_audit,omitempty"`
+		}{
+			ID:             id,
+			alias:          alias(u.user),
+			AccountAgeDays: accountAgeDays,
+			CreatedWeek:    createdWeek,
+			Audit:          u.audit,
+		})
+	}
+
+	return json.Marshal(struct {
+		ID string `json:"id"`
+		alias
+		CreatedAt      int64          `json:"created_at"`
+		UpdatedAt      int64          `json:"updated_at"`
+		AccountAgeDays *int           `json:"account_age_days,omitempty"`
+		CreatedWeek    *string        `json:"created_week,omitempty"`
+		Audit          *ProfileAccess `json:"_audit,omitempty"`
+	}{
+		ID:             id,
+		alias:          alias(u.user),
+		CreatedAt:      u.user.CreatedAt.UnixMilli(),
+		UpdatedAt:      u.user.UpdatedAt.UnixMilli(),
+		AccountAgeDays: accountAgeDays,
+		CreatedWeek:    createdWeek,
+		Audit:          u.audit,
+	})
+}
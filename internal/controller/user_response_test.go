@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func Test_userResponse_MarshalJSON(t *testing.T) {
+	user := model.User{
+		ID:        uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004"),
+		FirstName: "John",
+		LastName:  "Wick",
+		Nickname:  "johnnywicky",
+		Password:  "securepwd",
+		Email:     "johnnywicky@gmail.com",
+		Country:   "UK",
+		CreatedAt: time.Date(2024, 7, 13, 9, 19, 54, 625000000, time.UTC),
+		UpdatedAt: time.Date(2024, 7, 14, 9, 19, 54, 625000000, time.UTC),
+	}
+
+	tests := []struct {
+		name       string
+		timeFormat TimeFormat
+		want       string
+	}{
+		{
+			name:       "RFC3339",
+			timeFormat: TimeFormatRFC3339,
+			want: `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John","last_name":"Wick","nickname":"johnnywicky",` +
+				`"password":"securepwd","email":"johnnywicky@gmail.com","country":"UK",` +
+				`"created_at":"2024-07-13T09:19:54.625Z","updated_at":"2024-07-14T09:19:54.625Z"}`,
+		},
+		{
+			name:       "epoch millis",
+			timeFormat: TimeFormatEpochMillis,
+			want: `{"id":"10e4feb6-40f9-11ef-a3eb-0242ac170004","first_name":"John","last_name":"Wick","nickname":"johnnywicky",` +
+				`"password":"securepwd","email":"johnnywicky@gmail.com","country":"UK",` +
+				`"created_at":1720862394625,"updated_at":1720948794625}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(newUserResponse(user, newHandlersConfig(WithTimeFormat(tt.timeFormat))))
+
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
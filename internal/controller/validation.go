@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"user-service/internal/metrics"
+	"user-service/internal/model"
+)
+
+// fieldError is a validation failure of a user field.
+type fieldError struct {
+	field string
+	msg   string
+}
+
+func (e fieldError) Error() string {
+	return e.msg
+}
+
+// validateUser validates the user fields. Failures of the soft validation fields are only logged
+// and counted, the first failure of other fields is returned. The email domain MX records are checked
+// only for otherwise valid emails when the MX checker is set, the same applies to the password personal fields check.
+func validateUser(ctx context.Context, u model.User, cfg handlersConfig) error {
+	return firstHardFieldError(userValidationErrors(ctx, u, cfg), logrus.WithField("user_id", u.ID), cfg)
+}
+
+// validateUpdatedUser validates the updated user as validateUser does, but the email can be omitted to keep the stored one
+// when the emails are hashed.
+func validateUpdatedUser(ctx context.Context, u model.User, cfg handlersConfig) error {
+	errs := userValidationErrors(ctx, u, cfg)
+	if cfg.hashedEmails && u.Email == "" {
+		kept := errs[:0]
+		for _, fe := range errs {
+			if fe.field != "email" {
+				kept = append(kept, fe)
+			}
+		}
+		errs = kept
+	}
+	return firstHardFieldError(errs, logrus.WithField("user_id", u.ID), cfg)
+}
+
+// userValidationErrors returns the failures of all the user validations.
+func userValidationErrors(ctx context.Context, u model.User, cfg handlersConfig) []fieldError {
+	// the lengths first, so a too long field fails with its length rather than its other failures
+	errs := append(fieldLengthErrors(u, cfg.maxFieldLengths), userFieldErrors(u)...)
+	if cfg.passwordPersonalFieldsCheck && !hasFieldError(errs, "password") {
+		if fe := passwordPersonalFieldsError(u); fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+	if cfg.emailMXChecker != nil && !hasFieldError(errs, "email") {
+		if fe := emailMXError(ctx, u.Email, cfg.emailMXChecker); fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+	return errs
+}
+
+// validateBulkUpdateSet validates the bulk updated values by the same length and field validations as the users.
+func validateBulkUpdateSet(set map[string]string, cfg handlersConfig) error {
+	u := model.User{
+		FirstName: set["first_name"],
+		LastName:  set["last_name"],
+		Nickname:  set["nickname"],
+		Country:   set["country"],
+	}
+	var errs []fieldError
+	// the fields not set are empty in the user, their failures don't apply
+	for _, fe := range append(fieldLengthErrors(u, cfg.maxFieldLengths), userFieldErrors(u)...) {
+		if _, ok := set[fe.field]; ok {
+			errs = append(errs, fe)
+		}
+	}
+	return firstHardFieldError(errs, logrus.WithField("bulk_update", true), cfg)
+}
+
+// firstHardFieldError returns the first failure of the fields not in the soft validation, the others are only logged and counted.
+func firstHardFieldError(errs []fieldError, log *logrus.Entry, cfg handlersConfig) error {
+	for _, fe := range errs {
+		if _, soft := cfg.softValidationFields[fe.field]; soft {
+			log.WithField("field", fe.field).
+				Warnf("accepting invalid user field: %s", fe.msg)
+			metrics.CollectSoftValidationWarning(fe.field)
+			continue
+		}
+		return fe
+	}
+	return nil
+}
+
+// UserValidator validates and normalizes the written users by the same rules as the REST handlers,
+// so the other APIs e.g. gRPC accept the same users.
+type UserValidator struct {
+	cfg handlersConfig
+}
+
+// NewUserValidator creates new UserValidator configured by the same options as the handlers,
+// the options not related to the validation are ignored.
+func NewUserValidator(opts ...Opt) UserValidator {
+	return UserValidator{cfg: newHandlersConfig(opts...)}
+}
+
+// Validate validates the user and normalizes its fields, the returned error message names the invalid field.
+func (v UserValidator) Validate(ctx context.Context, u *model.User) error {
+	if err := validateUser(ctx, *u, v.cfg); err != nil {
+		return err
+	}
+	normalizeUser(u)
+	return nil
+}
+
+// normalizeUser converts the user fields to their canonical form. Invalid values accepted by the soft validation are kept.
+func normalizeUser(u *model.User) {
+	if phone, err := model.NormalizePhone(u.Phone); err == nil {
+		u.Phone = phone
+	}
+}
+
+// validateTimestamps validates the client supplied timestamps of the created user. Without any of them
+// the server sets both. Otherwise, both are required, not zero, not in the future and updated_at is not before created_at.
+func validateTimestamps(req createUserRequest, now time.Time) error {
+	if req.CreatedAt == nil && req.UpdatedAt == nil {
+		return nil
+	}
+	if req.CreatedAt == nil {
+		return fieldError{field: "created_at", msg: "created_at is required when updated_at is provided"}
+	}
+	if req.UpdatedAt == nil {
+		return fieldError{field: "updated_at", msg: "updated_at is required when created_at is provided"}
+	}
+	if req.CreatedAt.IsZero() {
+		return fieldError{field: "created_at", msg: "created_at cannot be zero"}
+	}
+	if req.UpdatedAt.IsZero() {
+		return fieldError{field: "updated_at", msg: "updated_at cannot be zero"}
+	}
+	if req.CreatedAt.After(now) {
+		return fieldError{field: "created_at", msg: "created_at cannot be in the future"}
+	}
+	if req.UpdatedAt.After(now) {
+		return fieldError{field: "updated_at", msg: "updated_at cannot be in the future"}
+	}
+	if req.UpdatedAt.Before(*req.CreatedAt) {
+		return fieldError{field: "updated_at", msg: "updated_at cannot be before created_at"}
+	}
+	return nil
+}
+
+// fieldLengthErrors returns the failures of the user string fields longer than their maximum length in characters.
+func fieldLengthErrors(u model.User, maxLengths map[string]int) []fieldError {
+	var errs []fieldError
+	for _, f := range []struct {
+		name  string
+		value string
+	}{
+		{name: "first_name", value: u.FirstName},
+		{name: "last_name", value: u.LastName},
+		{name: "nickname", value: u.Nickname},
+		{name: "password", value: u.Password},
+		{name: "email", value: u.Email},
+		{name: "country", value: u.Country},
+		{name: "phone", value: u.Phone},
+	} {
+		maxLength, ok := maxLengths[f.name]
+		if ok && utf8.RuneCountInString(f.value) > maxLength {
+			errs = append(errs, fieldError{field: f.name, msg: fmt.Sprintf("%s is too long, maximum is %d characters", f.name, maxLength)})
+		}
+	}
+	return errs
+}
+
+func hasFieldError(errs []fieldError, field string) bool {
+	for _, fe := range errs {
+		if fe.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordPersonalFieldsError returns the failure if the password equals, ignoring case, any of the user personal fields.
+func passwordPersonalFieldsError(u model.User) *fieldError {
+	for _, personal := range []string{u.Email, u.Nickname, u.FirstName, u.LastName} {
+		if personal != "" && strings.EqualFold(u.Password, personal) {
+			return &fieldError{field: "password", msg: "password must not match personal fields"}
+		}
+	}
+	return nil
+}
+
+// emailMXError returns the failure if the email domain has no MX records. Domains whose lookup fails are accepted.
+func emailMXError(ctx context.Context, email string, checker *MXChecker) *fieldError {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return nil
+	}
+	domain := addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+	hasMX, err := checker.HasMX(ctx, domain)
+	if err != nil {
+		logrus.WithError(err).
+			WithField("domain", domain).
+			Warn("failed to look up email domain MX records, accepting the email")
+	}
+	if !hasMX {
+		return &fieldError{field: "email", msg: "email domain cannot receive emails"}
+	}
+	return nil
+}
+
+// userFieldErrors returns all the validation failures of the user fields.
+func userFieldErrors(u model.User) []fieldError {
+	var errs []fieldError
+	if u.FirstName == "" {
+		errs = append(errs, fieldError{field: "first_name", msg: "first name is required"})
+	}
+	if u.LastName == "" {
+		errs = append(errs, fieldError{field: "last_name", msg: "last name is required"})
+	}
+	if u.Nickname == "" {
+		errs = append(errs, fieldError{field: "nickname", msg: "nickname is required"})
+	}
+	if u.Password == "" {
+		errs = append(errs, fieldError{field: "password", msg: "password is required"})
+	}
+	if u.Email == "" {
+		errs = append(errs, fieldError{field: "email", msg: "email is required"})
+	} else if _, err := mail.ParseAddress(u.Email); err != nil {
+		errs = append(errs, fieldError{field: "email", msg: "email is invalid"})
+	}
+	if u.Country == "" {
+		errs = append(errs, fieldError{field: "country", msg: "country is required"})
+	}
+	if u.Phone != "" {
+		if _, err := model.NormalizePhone(u.Phone); err != nil {
+			errs = append(errs, fieldError{field: "phone", msg: "phone is invalid"})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,399 @@
+package controller
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func Test_validateUser_SoftValidation(t *testing.T) {
+	valid := model.User{
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Email:     "valid@gmail.com",
+		Country:   "valid",
+	}
+	withoutNickname := valid
+	withoutNickname.Nickname = ""
+	withInvalidEmail := valid
+	withInvalidEmail.Email = "invalid"
+	withoutNicknameAndCountry := withoutNickname
+	withoutNicknameAndCountry.Country = ""
+
+	tests := []struct {
+		name       string
+		user       model.User
+		softFields []string
+		wantErr    string
+	}{
+		{
+			name: "valid user",
+			user: valid,
+		},
+		{
+			name:    "missing nickname rejected by default",
+			user:    withoutNickname,
+			wantErr: "nickname is required",
+		},
+		{
+			name:       "missing nickname accepted in soft mode",
+			user:       withoutNickname,
+			softFields: []string{"nickname"},
+		},
+		{
+			name:       "invalid email rejected when other field is soft",
+			user:       withInvalidEmail,
+			softFields: []string{"nickname"},
+			wantErr:    "email is invalid",
+		},
+		{
+			name:       "invalid email accepted in soft mode",
+			user:       withInvalidEmail,
+			softFields: []string{"email"},
+		},
+		{
+			name:       "soft field failure doesn't hide strict one",
+			user:       withoutNicknameAndCountry,
+			softFields: []string{"nickname"},
+			wantErr:    "country is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUser(context.Background(), tt.user, newHandlersConfig(WithSoftValidation(tt.softFields...)))
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateTimestamps(t *testing.T) {
+	now := time.Date(2024, 7, 13, 9, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		createdAt *time.Time
+		updatedAt *time.Time
+		wantErr   string
+	}{
+		{
+			name: "not provided",
+		},
+		{
+			name:      "valid",
+			createdAt: &past,
+			updatedAt: &now,
+		},
+		{
+			name:      "absent created at",
+			updatedAt: &past,
+			wantErr:   "created_at is required when updated_at is provided",
+		},
+		{
+			name:      "absent updated at",
+			createdAt: &past,
+			wantErr:   "updated_at is required when created_at is provided",
+		},
+		{
+			name:      "zero created at",
+			createdAt: &time.Time{},
+			updatedAt: &past,
+			wantErr:   "created_at cannot be zero",
+		},
+		{
+			name:      "zero updated at",
+			createdAt: &past,
+			updatedAt: &time.Time{},
+			wantErr:   "updated_at cannot be zero",
+		},
+		{
+			name:      "both zero",
+			createdAt: &time.Time{},
+			updatedAt: &time.Time{},
+			wantErr:   "created_at cannot be zero",
+		},
+		{
+			name:      "future created at",
+			createdAt: model.Ptr(now.Add(time.Second)),
+			updatedAt: model.Ptr(now.Add(time.Second)),
+			wantErr:   "created_at cannot be in the future",
+		},
+		{
+			name:      "future updated at",
+			createdAt: &past,
+			updatedAt: model.Ptr(now.Add(time.Second)),
+			wantErr:   "updated_at cannot be in the future",
+		},
+		{
+			name:      "updated before created",
+			createdAt: &now,
+			updatedAt: &past,
+			wantErr:   "updated_at cannot be before created_at",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTimestamps(createUserRequest{CreatedAt: tt.createdAt, UpdatedAt: tt.updatedAt}, now)
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateUser_Phone(t *testing.T) {
+	tests := []struct {
+		name      string
+		phone     string
+		soft      bool
+		wantErr   string
+		wantPhone string
+	}{
+		{
+			name: "absent",
+		},
+		{
+			name:      "valid normalized",
+			phone:     "+44 20 7183 8750",
+			wantPhone: "+442071838750",
+		},
+		{
+			name:    "invalid",
+			phone:   "020 7183 8750",
+			wantErr: "phone is invalid",
+		},
+		{
+			name:      "invalid kept with soft validation",
+			phone:     "020 7183 8750",
+			soft:      true,
+			wantPhone: "020 7183 8750",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := model.User{
+				FirstName: "valid",
+				LastName:  "valid",
+				Nickname:  "valid",
+				Password:  "valid",
+				Email:     "valid@gmail.com",
+				Country:   "valid",
+				Phone:     tt.phone,
+			}
+			var opts []Opt
+			if tt.soft {
+				opts = append(opts, WithSoftValidation("phone"))
+			}
+
+			err := validateUser(context.Background(), user, newHandlersConfig(opts...))
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			normalizeUser(&user)
+			assert.Equal(t, tt.wantPhone, user.Phone)
+		})
+	}
+}
+
+func Test_validateUser_MaxFieldLengths(t *testing.T) {
+	validUser := func() model.User {
+		return model.User{
+			FirstName: "valid",
+			LastName:  "valid",
+			Nickname:  "valid",
+			Password:  "valid",
+			Email:     "valid@gmail.com",
+			Country:   "valid",
+		}
+	}
+	emailOfLength := func(length int) string {
+		return strings.Repeat("a", length-len("@gmail.com")) + "@gmail.com"
+	}
+
+	tests := []struct {
+		name       string
+		maxLengths map[string]int
+		modify     func(u *model.User)
+		wantErr    string
+	}{
+		{
+			name:   "first name at default limit",
+			modify: func(u *model.User) { u.FirstName = strings.Repeat("a", 256) },
+		},
+		{
+			name:    "first name over default limit",
+			modify:  func(u *model.User) { u.FirstName = strings.Repeat("a", 257) },
+			wantErr: "first_name is too long, maximum is 256 characters",
+		},
+		{
+			name:       "last name at limit counted in characters",
+			maxLengths: map[string]int{"last_name": 5},
+			modify:     func(u *model.User) { u.LastName = "ščťžý" },
+		},
+		{
+			name:       "last name over limit",
+			maxLengths: map[string]int{"last_name": 5},
+			modify:     func(u *model.User) { u.LastName = "ščťžýá" },
+			wantErr:    "last_name is too long, maximum is 5 characters",
+		},
+		{
+			name:       "nickname at limit",
+			maxLengths: map[string]int{"nickname": 8},
+			modify:     func(u *model.User) { u.Nickname = "nickname" },
+		},
+		{
+			name:       "nickname over limit",
+			maxLengths: map[string]int{"nickname": 8},
+			modify:     func(u *model.User) { u.Nickname = "nicknames" },
+			wantErr:    "nickname is too long, maximum is 8 characters",
+		},
+		{
+			name:       "password at limit",
+			maxLengths: map[string]int{"password": 8},
+			modify:     func(u *model.User) { u.Password = "password" },
+		},
+		{
+			name:       "password over limit",
+			maxLengths: map[string]int{"password": 8},
+			modify:     func(u *model.User) { u.Password = "passwords" },
+			wantErr:    "password is too long, maximum is 8 characters",
+		},
+		{
+			name:       "email at limit",
+			maxLengths: map[string]int{"email": 64},
+			modify:     func(u *model.User) { u.Email = emailOfLength(64) },
+		},
+		{
+			name:       "email over limit",
+			maxLengths: map[string]int{"email": 64},
+			modify:     func(u *model.User) { u.Email = emailOfLength(65) },
+			wantErr:    "email is too long, maximum is 64 characters",
+		},
+		{
+			name:       "country at limit",
+			maxLengths: map[string]int{"country": 2},
+			modify:     func(u *model.User) { u.Country = "GB" },
+		},
+		{
+			name:       "country over limit",
+			maxLengths: map[string]int{"country": 2},
+			modify:     func(u *model.User) { u.Country = "GBR" },
+			wantErr:    "country is too long, maximum is 2 characters",
+		},
+		{
+			name:       "phone at limit",
+			maxLengths: map[string]int{"phone": 13},
+			modify:     func(u *model.User) { u.Phone = "+442071838750" },
+		},
+		{
+			name:       "phone over limit",
+			maxLengths: map[string]int{"phone": 13},
+			modify:     func(u *model.User) { u.Phone = "+44 2071838750" },
+			wantErr:    "phone is too long, maximum is 13 characters",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := validUser()
+			tt.modify(&user)
+
+			err := validateUser(context.Background(), user, newHandlersConfig(WithMaxFieldLengths(tt.maxLengths)))
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_validateUser_PasswordPersonalFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		disabled bool
+		wantErr  string
+	}{
+		{
+			name:     "safe password",
+			password: "correct-horse-battery",
+		},
+		{
+			name:     "matches email",
+			password: "John.Wick@Gmail.com",
+			wantErr:  "password must not match personal fields",
+		},
+		{
+			name:     "matches nickname",
+			password: "JOHNNYWICKY",
+			wantErr:  "password must not match personal fields",
+		},
+		{
+			name:     "matches first name",
+			password: "john",
+			wantErr:  "password must not match personal fields",
+		},
+		{
+			name:     "matches last name",
+			password: "wick",
+			wantErr:  "password must not match personal fields",
+		},
+		{
+			name:     "matching accepted when disabled",
+			password: "johnnywicky",
+			disabled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := model.User{
+				FirstName: "John",
+				LastName:  "Wick",
+				Nickname:  "johnnywicky",
+				Password:  tt.password,
+				Email:     "john.wick@gmail.com",
+				Country:   "UK",
+			}
+
+			err := validateUser(context.Background(), user, newHandlersConfig(WithPasswordPersonalFieldsCheck(!tt.disabled)))
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_UserValidator(t *testing.T) {
+	validator := NewUserValidator(WithMaxFieldLengths(map[string]int{"nickname": 5}))
+	user := model.User{FirstName: "John", LastName: "Wick", Nickname: "johnny", Password: "pwd", Email: "john@gmail.com", Country: "GB", Phone: "+44 20 7946 0958"}
+
+	err := validator.Validate(context.Background(), &user)
+
+	assert.EqualError(t, err, "nickname is too long, maximum is 5 characters")
+
+	user.Nickname = "john"
+	err = validator.Validate(context.Background(), &user)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "+442079460958", user.Phone)
+}
@@ -0,0 +1,12 @@
+package controller
+
+import "github.com/gin-gonic/gin"
+
+// varyOnAccept returns a middleware that sets the Vary header, so caching proxies keep a separate copy
+// of the response per Accept header value of the request.
+func varyOnAccept() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/model"
+)
+
+func Test_VaryHeader(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantVary string
+	}{
+		{
+			name:     "get user",
+			method:   http.MethodGet,
+			path:     "/v1/users/" + userID.String(),
+			wantVary: "Accept",
+		},
+		{
+			name:     "get users",
+			method:   http.MethodGet,
+			path:     "/v1/users",
+			wantVary: "Accept",
+		},
+		{
+			name:     "delete user - not negotiated",
+			method:   http.MethodDelete,
+			path:     "/v1/users/" + userID.String(),
+			wantVary: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceMock := new(ServiceMock)
+			serviceMock.On("GetUserByID", mock.Anything, userID).Return(&model.User{ID: userID}, nil).Maybe()
+			serviceMock.On("GetUsers", mock.Anything, mock.Anything).Return([]model.User{}, nil).Maybe()
+			serviceMock.On("DeleteUser", mock.Anything, userID).Return(nil).Maybe()
+
+			router := gin.New()
+			CreateUsersHandlers(router.Group("v1"), serviceMock)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Less(t, w.Code, http.StatusBadRequest)
+			assert.Equal(t, tt.wantVary, w.Header().Get("Vary"))
+		})
+	}
+}
@@ -1,12 +1,22 @@
 package errors
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"net/http"
 )
 
 var NotFoundError = errors.New("not found")
 
+// PreconditionFailedError is returned by the conditional writes when the stored data doesn't match the expected one.
+var PreconditionFailedError = errors.New("precondition failed")
+
+// CircuitOpenError is returned by the storage operations that are not executed as the DB is considered unavailable.
+var CircuitOpenError = errors.New("circuit breaker is open")
+
 // ResponseUnmarshallError defines state when DB write was successful but DB response unmarshal failed.
 type ResponseUnmarshallError struct {
 	err error
@@ -19,3 +29,139 @@ func NewResponseUnmarshallError(err error) *ResponseUnmarshallError {
 func (r ResponseUnmarshallError) Error() string {
 	return fmt.Sprintf("failed to unmarshal data returned from DB: %s", r.err.Error())
 }
+
+func (r ResponseUnmarshallError) Unwrap() error {
+	return r.err
+}
+
+// ConflictError defines state when the data to be written collides with already stored data.
+type ConflictError struct {
+	msg string
+}
+
+func NewConflictError(msg string) *ConflictError {
+	return &ConflictError{msg: msg}
+}
+
+func (c ConflictError) Error() string {
+	return c.msg
+}
+
+// ValidationError defines state when the DB rejects the written data by its schema validation.
+type ValidationError struct {
+	msg     string
+	details map[string]any
+}
+
+func NewValidationError(msg string, details map[string]any) *ValidationError {
+	return &ValidationError{msg: msg, details: details}
+}
+
+func (v ValidationError) Error() string {
+	return v.msg
+}
+
+// Details returns the DB explanation of the validation failure, nil if the DB didn't provide any.
+func (v ValidationError) Details() map[string]any {
+	return v.details
+}
+
+// InvalidParameterError defines state when a parameter of the operation can't be used e.g. a negative page.
+type InvalidParameterError struct {
+	// Parameter is the name of the request parameter e.g. pageSize.
+	Parameter string
+	// OutOfRange is set when the parameter is a number out of the allowed range.
+	OutOfRange bool
+	msg        string
+}
+
+func NewInvalidParameterError(parameter, msg string) *InvalidParameterError {
+	return &InvalidParameterError{Parameter: parameter, msg: msg}
+}
+
+func NewOutOfRangeParameterError(parameter, msg string) *InvalidParameterError {
+	return &InvalidParameterError{Parameter: parameter, OutOfRange: true, msg: msg}
+}
+
+func (i InvalidParameterError) Error() string {
+	return i.msg
+}
+
+// NotAttemptedError is the failure of the batch items not written as the ordered batch stopped at a preceding failure.
+var NotAttemptedError = errors.New("not written due to a preceding failure in the ordered batch")
+
+// BatchItemError defines state when a single item of a batch write fails, the other items may be written.
+type BatchItemError struct {
+	// Index is the position of the failed item in the batch.
+	Index int
+	Err   error
+}
+
+func (b BatchItemError) Error() string {
+	return fmt.Sprintf("batch item %d: %s", b.Index, b.Err.Error())
+}
+
+func (b BatchItemError) Unwrap() error {
+	return b.Err
+}
+
+// HTTPStatus maps the error to the HTTP response status the failed request should be answered with.
+// The errors are matched also when wrapped, unknown errors are mapped to 500 Internal Server Error.
+func HTTPStatus(err error) int {
+	var conflictErr *ConflictError
+	var validationErr *ValidationError
+	var invalidParamErr *InvalidParameterError
+	var serverSelectionErr topology.ServerSelectionError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, NotFoundError):
+		return http.StatusNotFound
+	case errors.Is(err, PreconditionFailedError):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, NotAttemptedError):
+		return http.StatusFailedDependency
+	case errors.As(err, &conflictErr):
+		return http.StatusConflict
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &invalidParamErr):
+		return http.StatusBadRequest
+	// no DB server is reachable, checked before the timeouts as the server selection can time out too
+	case errors.Is(err, CircuitOpenError), errors.As(err, &serverSelectionErr), errors.Is(err, mongo.ErrClientDisconnected):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Message returns the client facing message of the error for the status it's mapped to by HTTPStatus, so all the APIs
+// answer the same. The messages of unexpected errors are not exposed.
+func Message(err error) string {
+	var conflictErr *ConflictError
+	var validationErr *ValidationError
+	var invalidParamErr *InvalidParameterError
+	switch HTTPStatus(err) {
+	case http.StatusBadRequest:
+		errors.As(err, &invalidParamErr)
+		return invalidParamErr.Error()
+	case http.StatusNotFound:
+		return "user not found"
+	case http.StatusConflict:
+		errors.As(err, &conflictErr)
+		return conflictErr.Error()
+	case http.StatusPreconditionFailed:
+		return "user doesn't match the expected field values"
+	case http.StatusUnprocessableEntity:
+		errors.As(err, &validationErr)
+		return validationErr.Error()
+	case http.StatusServiceUnavailable:
+		return "service temporarily unavailable"
+	case http.StatusGatewayTimeout:
+		return "request timed out"
+	default:
+		return "internal server error"
+	}
+}
@@ -0,0 +1,75 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"net/http"
+	"testing"
+)
+
+func Test_HTTPStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "no error", err: nil, want: http.StatusOK},
+		{name: "not found", err: NotFoundError, want: http.StatusNotFound},
+		{name: "precondition failed", err: PreconditionFailedError, want: http.StatusPreconditionFailed},
+		{name: "circuit open", err: CircuitOpenError, want: http.StatusServiceUnavailable},
+		{name: "not attempted", err: NotAttemptedError, want: http.StatusFailedDependency},
+		{name: "conflict", err: NewConflictError("nickname already exists"), want: http.StatusConflict},
+		{name: "validation", err: NewValidationError("invalid user", nil), want: http.StatusUnprocessableEntity},
+		{name: "invalid parameter", err: NewInvalidParameterError("sortBy", "sort field is required"), want: http.StatusBadRequest},
+		{name: "response unmarshall", err: NewResponseUnmarshallError(errors.New("bad bson")), want: http.StatusInternalServerError},
+		{name: "server selection", err: topology.ServerSelectionError{Wrapped: topology.ErrServerSelectionTimeout}, want: http.StatusServiceUnavailable},
+		{name: "client disconnected", err: mongo.ErrClientDisconnected, want: http.StatusServiceUnavailable},
+		{name: "deadline", err: context.DeadlineExceeded, want: http.StatusGatewayTimeout},
+		{name: "wrapped deadline", err: fmt.Errorf("find users: %w", context.DeadlineExceeded), want: http.StatusGatewayTimeout},
+		{name: "unknown", err: errors.New("boom"), want: http.StatusInternalServerError},
+		{name: "wrapped not found", err: fmt.Errorf("get user: %w", NotFoundError), want: http.StatusNotFound},
+		{name: "wrapped conflict", err: fmt.Errorf("create user: %w", NewConflictError("id already exists")), want: http.StatusConflict},
+		{name: "batch item", err: BatchItemError{Index: 1, Err: NewConflictError("id already exists")}, want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HTTPStatus(tt.err))
+		})
+	}
+}
+
+func Test_Message(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "not found", err: fmt.Errorf("get user: %w", NotFoundError), want: "user not found"},
+		{name: "precondition failed", err: PreconditionFailedError, want: "user doesn't match the expected field values"},
+		{name: "conflict", err: NewConflictError("nickname already exists"), want: "nickname already exists"},
+		{name: "invalid parameter", err: NewInvalidParameterError("sortBy", "sort field is required"), want: "sort field is required"},
+		{name: "circuit open", err: CircuitOpenError, want: "service temporarily unavailable"},
+		{name: "deadline", err: context.DeadlineExceeded, want: "request timed out"},
+		{name: "not attempted", err: NotAttemptedError, want: "internal server error"},
+		{name: "unknown", err: errors.New("boom"), want: "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Message(tt.err))
+		})
+	}
+}
+
+func Test_ResponseUnmarshallError(t *testing.T) {
+	cause := errors.New("bad bson")
+	err := fmt.Errorf("update user: %w", NewResponseUnmarshallError(cause))
+
+	var unmarshallErr *ResponseUnmarshallError
+	assert.True(t, errors.As(err, &unmarshallErr))
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "failed to unmarshal data returned from DB: bad bson", unmarshallErr.Error())
+}
@@ -0,0 +1,192 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// flushPollInterval is how often Flush checks whether the pending events were produced.
+const flushPollInterval = 10 * time.Millisecond
+
+var ErrProducerClosed = errors.New("producer is closed")
+
+// Gauge is a metric that can go up and down e.g. prometheus.Gauge.
+type Gauge interface {
+	Inc()
+	Dec()
+}
+
+// Counter is a metric that only goes up e.g. prometheus.Counter.
+type Counter interface {
+	Inc()
+}
+
+type noopGauge struct{}
+
+func (noopGauge) Inc() {}
+func (noopGauge) Dec() {}
+
+// FullBufferPolicy decides what happens with the produced events while the buffer is full.
+type FullBufferPolicy string
+
+const (
+	// BlockWhenFull blocks the Produce caller until there is a space in the buffer.
+	BlockWhenFull FullBufferPolicy = "block"
+	// DropWhenFull drops the event, so the caller is never blocked at the cost of losing the events e.g. during broker outage.
+	DropWhenFull FullBufferPolicy = "drop"
+)
+
+type AsyncOpt func(*AsyncProducer)
+
+// WithQueueDepthGauge sets the gauge tracking the number of queued events that were not produced yet.
+func WithQueueDepthGauge(gauge Gauge) AsyncOpt {
+	return func(a *AsyncProducer) {
+		a.queueDepth = gauge
+	}
+}
+
+// WithFullBufferPolicy sets what happens with the events produced while the buffer is full, BlockWhenFull by default.
+func WithFullBufferPolicy(policy FullBufferPolicy) AsyncOpt {
+	return func(a *AsyncProducer) {
+		a.fullBufferPolicy = policy
+	}
+}
+
+// WithDroppedCounter sets the counter of the events dropped by the DropWhenFull policy.
+func WithDroppedCounter(counter Counter) AsyncOpt {
+	return func(a *AsyncProducer) {
+		a.dropped = counter
+	}
+}
+
+// AsyncProducer decouples the event production from the caller. Events are queued to a bounded buffer
+// and produced in order by a single goroutine. Produce blocks or drops the event while the buffer is full
+// based on the FullBufferPolicy.
+type AsyncProducer struct {
+	producer Producer
+	events   chan any
+	drained  chan struct{}
+	// done is closed by Close, so the Produce calls blocked on the full buffer give up and release the lock
+	done             chan struct{}
+	closeOnce        sync.Once
+	queueDepth       Gauge
+	fullBufferPolicy FullBufferPolicy
+	dropped          Counter
+	// queued and produced count the events, their difference is the number of the pending ones
+	queued   atomic.Int64
+	produced atomic.Int64
+
+	// guards the events channel from being closed while events are sent to it
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncProducer creates new AsyncProducer buffering up to bufferSize events for the given producer
+// and starts the goroutine producing them. To drain the buffered events and stop the goroutine call Close().
+func NewAsyncProducer(producer Producer, bufferSize int, opts ...AsyncOpt) *AsyncProducer {
+	a := &AsyncProducer{
+		producer:         producer,
+		events:           make(chan any, bufferSize),
+		drained:          make(chan struct{}),
+		done:             make(chan struct{}),
+		queueDepth:       noopGauge{},
+		fullBufferPolicy: BlockWhenFull,
+		dropped:          noopGauge{},
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	go a.run()
+
+	return a
+}
+
+// Produce queues the event to be produced. Fails only when the producer is closed, also while it waits
+// for a space in the full buffer. Failures of the actual production and the dropped events are logged.
+func (a *AsyncProducer) Produce(event any) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return ErrProducerClosed
+	}
+	// before sending, so the producing goroutine never decrements it first
+	a.queueDepth.Inc()
+	if a.fullBufferPolicy != DropWhenFull {
+		a.queued.Add(1)
+		select {
+		case a.events <- event:
+			return nil
+		case <-a.done:
+			a.queued.Add(-1)
+			a.queueDepth.Dec()
+			return ErrProducerClosed
+		}
+	}
+
+	select {
+	case a.events <- event:
+		a.queued.Add(1)
+	default:
+		a.queueDepth.Dec()
+		a.dropped.Inc()
+		logrus.Warn("events buffer is full, dropping event")
+	}
+	return nil
+}
+
+// Flush waits until the events pending at the call are produced, the producer keeps accepting new events.
+// Returns the number of the pending events and the context error if they were not produced before the context is done.
+func (a *AsyncProducer) Flush(ctx context.Context) (int, error) {
+	target := a.queued.Load()
+	pending := int(target - a.produced.Load())
+
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for a.produced.Load() < target {
+		select {
+		case <-ctx.Done():
+			return pending, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return pending, nil
+}
+
+// Close stops accepting new events and waits until the buffered ones are produced, but at most the timeout.
+// Returns an error if the buffered events were not produced in time.
+func (a *AsyncProducer) Close(timeout time.Duration) error {
+	// unblocks the callers waiting for a space in the buffer, so the lock below is not held up by them
+	a.closeOnce.Do(func() { close(a.done) })
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.drained:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("timed out draining the buffered events")
+	}
+}
+
+func (a *AsyncProducer) run() {
+	defer close(a.drained)
+
+	for event := range a.events {
+		a.queueDepth.Dec()
+		if err := a.producer.Produce(event); err != nil {
+			logrus.WithError(err).Error("failed to produce buffered event")
+		}
+		a.produced.Add(1)
+	}
+}
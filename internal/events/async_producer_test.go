@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingProducerStub records the produced events, each production waits until released.
+type blockingProducerStub struct {
+	mu       sync.Mutex
+	produced []any
+	release  chan struct{}
+}
+
+func (p *blockingProducerStub) Produce(event any) error {
+	<-p.release
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.produced = append(p.produced, event)
+	return nil
+}
+
+func (p *blockingProducerStub) got() []any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]any(nil), p.produced...)
+}
+
+func Test_AsyncProducer_OrderAndDrain(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	stub := &blockingProducerStub{release: release}
+	p := NewAsyncProducer(stub, 10)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Produce(i))
+	}
+	require.NoError(t, p.Close(time.Second))
+
+	assert.Equal(t, []any{0, 1, 2, 3, 4}, stub.got(), "all the buffered events have to be produced in order")
+	assert.ErrorIs(t, p.Produce(5), ErrProducerClosed)
+	assert.NoError(t, p.Close(time.Second), "closing twice is a no-op")
+}
+
+func Test_AsyncProducer_DoesNotBlockCaller(t *testing.T) {
+	stub := &blockingProducerStub{release: make(chan struct{})}
+	p := NewAsyncProducer(stub, 2)
+
+	// the producing goroutine holds the first event, the buffer the other two
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Produce(i))
+	}
+	assert.Empty(t, stub.got())
+
+	assert.Error(t, p.Close(10*time.Millisecond), "events can't be drained while the producer is stuck")
+
+	close(stub.release)
+	assert.Eventually(t, func() bool {
+		return len(stub.got()) == 3
+	}, time.Second, time.Millisecond)
+}
+
+func Test_AsyncProducer_QueueDepth(t *testing.T) {
+	stub := &blockingProducerStub{release: make(chan struct{})}
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_depth"})
+	p := NewAsyncProducer(stub, 5, WithQueueDepthGauge(gauge))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Produce(i))
+	}
+	// the first event is taken by the producing goroutine and stuck in production
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(gauge) == 2
+	}, time.Second, time.Millisecond)
+
+	close(stub.release)
+	require.NoError(t, p.Close(time.Second))
+	assert.Equal(t, float64(0), testutil.ToFloat64(gauge))
+}
+
+func Test_AsyncProducer_DropWhenFull(t *testing.T) {
+	stub := &blockingProducerStub{release: make(chan struct{})}
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_depth"})
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped"})
+	p := NewAsyncProducer(stub, 2, WithQueueDepthGauge(gauge),
+		WithFullBufferPolicy(DropWhenFull), WithDroppedCounter(dropped))
+
+	require.NoError(t, p.Produce(0))
+	// the first event is taken by the producing goroutine, so the buffer is empty
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(gauge) == 0
+	}, time.Second, time.Millisecond)
+
+	for i := 1; i < 5; i++ {
+		require.NoError(t, p.Produce(i), "full buffer doesn't block nor fail the caller")
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(gauge))
+	assert.Equal(t, float64(2), testutil.ToFloat64(dropped))
+
+	close(stub.release)
+	require.NoError(t, p.Close(time.Second))
+	assert.Equal(t, []any{0, 1, 2}, stub.got(), "the events over the buffer size are dropped")
+	assert.Equal(t, float64(0), testutil.ToFloat64(gauge))
+}
+
+func Test_AsyncProducer_Flush(t *testing.T) {
+	stub := &blockingProducerStub{release: make(chan struct{})}
+	p := NewAsyncProducer(stub, 10)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Produce(i))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	pending, err := p.Flush(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "events can't be flushed while the producer is stuck")
+	assert.Equal(t, 3, pending)
+
+	close(stub.release)
+	pending, err = p.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, pending)
+	assert.Equal(t, []any{0, 1, 2}, stub.got(), "all the pending events have to be produced")
+
+	require.NoError(t, p.Produce(3), "the producer keeps accepting events after flush")
+	pending, err = p.Flush(context.Background())
+	require.NoError(t, err)
+	assert.LessOrEqual(t, pending, 1)
+	assert.Equal(t, []any{0, 1, 2, 3}, stub.got())
+	require.NoError(t, p.Close(time.Second))
+}
+
+func Test_AsyncProducer_CloseUnblocksCallers(t *testing.T) {
+	stub := &blockingProducerStub{release: make(chan struct{})}
+	defer close(stub.release)
+	p := NewAsyncProducer(stub, 1)
+
+	// the producing goroutine holds the first event, the buffer the second one
+	require.NoError(t, p.Produce(0))
+	require.NoError(t, p.Produce(1))
+	blocked := make(chan error)
+	go func() {
+		blocked <- p.Produce(2)
+	}()
+
+	start := time.Now()
+	assert.Error(t, p.Close(50*time.Millisecond), "events can't be drained while the producer is stuck")
+	assert.Less(t, time.Since(start), time.Second, "the caller blocked on the full buffer can't hold up the close")
+	select {
+	case err := <-blocked:
+		assert.ErrorIs(t, err, ErrProducerClosed)
+	case <-time.After(time.Second):
+		t.Fatal("the caller blocked on the full buffer was not released by close")
+	}
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"sync"
+)
+
+// Broadcaster fans out the produced events to its in-process subscribers.
+// Slow subscribers miss events instead of blocking the producer.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan any]struct{}
+	bufferSize  int
+	closed      bool
+}
+
+// NewBroadcaster creates new Broadcaster whose subscribers buffer up to bufferSize not yet consumed events.
+func NewBroadcaster(bufferSize int) *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[chan any]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Produce sends the event to all current subscribers. Subscribers with full buffer miss the event.
+func (b *Broadcaster) Produce(event any) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the produced events and a func to cancel the subscription.
+// The channel is closed once the subscription is cancelled or the Broadcaster is closed.
+func (b *Broadcaster) Subscribe() (<-chan any, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := make(chan any, b.bufferSize)
+	if b.closed {
+		close(sub)
+		return sub, func() {}
+	}
+	b.subscribers[sub] = struct{}{}
+
+	return sub, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[sub]; ok {
+			delete(b.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// Close closes the channels of all subscribers, so they can finish. Later subscriptions get a closed channel.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub)
+	}
+}
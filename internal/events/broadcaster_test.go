@@ -0,0 +1,59 @@
+package events
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Broadcaster(t *testing.T) {
+	b := NewBroadcaster(1)
+	first, unsubscribeFirst := b.Subscribe()
+	second, _ := b.Subscribe()
+
+	assert.NoError(t, b.Produce("event1"))
+	assert.Equal(t, "event1", <-first)
+	assert.Equal(t, "event1", <-second)
+
+	// second subscriber doesn't consume, so it misses the event that doesn't fit its buffer
+	assert.NoError(t, b.Produce("event2"))
+	assert.NoError(t, b.Produce("event3"))
+	assert.Equal(t, "event2", <-first)
+	assert.Equal(t, "event2", <-second)
+
+	unsubscribeFirst()
+	_, open := <-first
+	assert.False(t, open, "channel of cancelled subscription has to be closed")
+	// cancelling twice is a no-op
+	unsubscribeFirst()
+
+	b.Close()
+	_, open = <-second
+	assert.False(t, open, "channels have to be closed on Close")
+
+	late, unsubscribeLate := b.Subscribe()
+	_, open = <-late
+	assert.False(t, open, "subscription after Close gets closed channel")
+	unsubscribeLate()
+}
+
+type producerStub struct {
+	err      error
+	produced []any
+}
+
+func (p *producerStub) Produce(event any) error {
+	p.produced = append(p.produced, event)
+	return p.err
+}
+
+func Test_MultiProducer(t *testing.T) {
+	failing := &producerStub{err: errors.New("kafka down")}
+	ok := &producerStub{}
+
+	err := NewMultiProducer(failing, ok).Produce("event")
+
+	assert.ErrorContains(t, err, "kafka down")
+	assert.Equal(t, []any{"event"}, failing.produced)
+	assert.Equal(t, []any{"event"}, ok.produced, "event has to be produced also after previous producer failure")
+}
@@ -0,0 +1,183 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+	"user-service/internal/model"
+)
+
+// DebouncingProducer collapses the user updated events of the same user produced within the window into a single
+// event carrying the final state of the user. The window starts with the first update, so the event is delayed
+// at most by the window. The other events are produced immediately, a pending update of the same user is produced
+// before them to keep the events order.
+type DebouncingProducer struct {
+	producer Producer
+	window   time.Duration
+
+	// guards pending, producing and closed. It's never held while producing, so a slow production of one user's
+	// update doesn't stall the events of the others.
+	mu      sync.Mutex
+	pending map[uuid.UUID]*pendingUpdate
+	// producing are closed once the last taken update of the user is produced, to keep the user's events order
+	producing map[uuid.UUID]chan struct{}
+	closed    bool
+}
+
+type pendingUpdate struct {
+	event model.UserEvent
+	timer *time.Timer
+}
+
+// takenUpdate is the pending update taken out to be produced outside the lock.
+type takenUpdate struct {
+	userID uuid.UUID
+	event  model.UserEvent
+	// prev is closed once the previously taken update of the user is produced, nil if there is none
+	prev chan struct{}
+	done chan struct{}
+}
+
+// NewDebouncingProducer creates new DebouncingProducer delaying the user updated events by at most the window.
+func NewDebouncingProducer(producer Producer, window time.Duration) *DebouncingProducer {
+	return &DebouncingProducer{
+		producer:  producer,
+		window:    window,
+		pending:   map[uuid.UUID]*pendingUpdate{},
+		producing: map[uuid.UUID]chan struct{}{},
+	}
+}
+
+// Produce produces the event, the user updated events are delayed by the window and only the last one of the user
+// within the window is produced. The errors of the delayed events are only logged.
+func (d *DebouncingProducer) Produce(event any) error {
+	userEvent, ok := event.(model.UserEvent)
+	if !ok {
+		return d.producer.Produce(event)
+	}
+
+	switch data := userEvent.UserData.(type) {
+	case model.User:
+		if userEvent.Action == model.USER_UPDATED && d.debounce(data.ID, userEvent) {
+			return nil
+		}
+		d.flush(data.ID)
+	case model.UserDeletedData:
+		d.flush(data.UserID)
+	default:
+		// e.g. bulk update may change any user
+		d.flushAll()
+	}
+
+	return d.producer.Produce(event)
+}
+
+// Close produces all the pending events, the events produced afterward are not delayed.
+func (d *DebouncingProducer) Close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	d.flushAll()
+}
+
+// debounce replaces the pending update of the user by the event or starts a new window for it.
+// Returns false if the producer is closed and the event has to be produced right away.
+func (d *DebouncingProducer) debounce(userID uuid.UUID, event model.UserEvent) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return false
+	}
+	if p, ok := d.pending[userID]; ok {
+		p.event = event
+		return true
+	}
+	p := &pendingUpdate{event: event}
+	p.timer = time.AfterFunc(d.window, func() {
+		d.mu.Lock()
+		// the update might be already produced and followed by a new one with its own window
+		if d.pending[userID] != p {
+			d.mu.Unlock()
+			return
+		}
+		taken := d.take(userID, p)
+		d.mu.Unlock()
+		d.produceTaken(taken)
+	})
+	d.pending[userID] = p
+	return true
+}
+
+// flush produces the pending update of the user, if any, and waits until the taken updates of the user are produced.
+func (d *DebouncingProducer) flush(userID uuid.UUID) {
+	d.mu.Lock()
+	p, ok := d.pending[userID]
+	if !ok {
+		producing := d.producing[userID]
+		d.mu.Unlock()
+		if producing != nil {
+			<-producing
+		}
+		return
+	}
+	taken := d.take(userID, p)
+	d.mu.Unlock()
+
+	d.produceTaken(taken)
+}
+
+// flushAll produces all the pending updates and waits until all the taken ones are produced.
+func (d *DebouncingProducer) flushAll() {
+	d.mu.Lock()
+	taken := make([]*takenUpdate, 0, len(d.pending))
+	for userID, p := range d.pending {
+		taken = append(taken, d.take(userID, p))
+	}
+	producing := make([]chan struct{}, 0, len(d.producing))
+	for _, done := range d.producing {
+		producing = append(producing, done)
+	}
+	d.mu.Unlock()
+
+	for _, t := range taken {
+		d.produceTaken(t)
+	}
+	for _, done := range producing {
+		<-done
+	}
+}
+
+// take removes the pending update of the user to be produced after the previously taken one. Has to be called with mu held.
+func (d *DebouncingProducer) take(userID uuid.UUID, p *pendingUpdate) *takenUpdate {
+	delete(d.pending, userID)
+	p.timer.Stop()
+	taken := &takenUpdate{userID: userID, event: p.event, prev: d.producing[userID], done: make(chan struct{})}
+	d.producing[userID] = taken.done
+	return taken
+}
+
+// produceTaken produces the taken update once the previously taken update of the user is produced.
+func (d *DebouncingProducer) produceTaken(taken *takenUpdate) {
+	if taken.prev != nil {
+		<-taken.prev
+	}
+	d.produceDebounced(taken.userID, taken.event)
+
+	d.mu.Lock()
+	if d.producing[taken.userID] == taken.done {
+		delete(d.producing, taken.userID)
+	}
+	d.mu.Unlock()
+	close(taken.done)
+}
+
+func (d *DebouncingProducer) produceDebounced(userID uuid.UUID, event model.UserEvent) {
+	if err := d.producer.Produce(event); err != nil {
+		logrus.WithError(err).
+			WithField("user_id", userID).
+			Error("failed to produce debounced user updated event")
+	}
+}
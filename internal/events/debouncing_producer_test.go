@@ -0,0 +1,124 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+// syncProducerStub records the produced events, it's safe for concurrent use.
+type syncProducerStub struct {
+	mu       sync.Mutex
+	produced []any
+}
+
+func (p *syncProducerStub) Produce(event any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.produced = append(p.produced, event)
+	return nil
+}
+
+func (p *syncProducerStub) events() []any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]any(nil), p.produced...)
+}
+
+func Test_DebouncingProducer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	anna := model.User{ID: uuid.New(), FirstName: "anna"}
+	annaRenamed := model.User{ID: anna.ID, FirstName: "hanna"}
+	bob := model.User{ID: uuid.New(), FirstName: "bob"}
+
+	t.Run("rapid updates of a user are collapsed to the last one", func(t *testing.T) {
+		stub := &syncProducerStub{}
+		d := NewDebouncingProducer(stub, 50*time.Millisecond)
+
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(anna)))
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(annaRenamed)))
+		assert.Empty(t, stub.events(), "updates are delayed by the window")
+
+		assert.Eventually(t, func() bool {
+			return len(stub.events()) == 1
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []any{model.NewUserUpdatedEvent(annaRenamed)}, stub.events())
+	})
+	t.Run("updates of different users are not collapsed", func(t *testing.T) {
+		stub := &syncProducerStub{}
+		d := NewDebouncingProducer(stub, 50*time.Millisecond)
+
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(anna)))
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(bob)))
+
+		assert.Eventually(t, func() bool {
+			return len(stub.events()) == 2
+		}, time.Second, 10*time.Millisecond)
+		assert.ElementsMatch(t, []any{model.NewUserUpdatedEvent(anna), model.NewUserUpdatedEvent(bob)}, stub.events())
+	})
+	t.Run("pending update is produced before other events of the user", func(t *testing.T) {
+		stub := &syncProducerStub{}
+		d := NewDebouncingProducer(stub, time.Hour)
+
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(anna)))
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(bob)))
+		assert.NoError(t, d.Produce(model.NewUserDeletedEvent(anna.ID)))
+
+		assert.Equal(t, []any{model.NewUserUpdatedEvent(anna), model.NewUserDeletedEvent(anna.ID)}, stub.events())
+		d.Close()
+	})
+	t.Run("close produces pending updates", func(t *testing.T) {
+		stub := &syncProducerStub{}
+		d := NewDebouncingProducer(stub, time.Hour)
+
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(anna)))
+		d.Close()
+		assert.Equal(t, []any{model.NewUserUpdatedEvent(anna)}, stub.events())
+
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(annaRenamed)))
+		assert.Equal(t, []any{model.NewUserUpdatedEvent(anna), model.NewUserUpdatedEvent(annaRenamed)}, stub.events(),
+			"updates are not delayed after close")
+	})
+	t.Run("slow production of a user doesn't stall the others", func(t *testing.T) {
+		release := make(chan struct{})
+		stub := &syncProducerStub{}
+		gated := producerFunc(func(event any) error {
+			if event == any(model.NewUserUpdatedEvent(anna)) {
+				<-release
+			}
+			return stub.Produce(event)
+		})
+		d := NewDebouncingProducer(gated, 10*time.Millisecond)
+
+		assert.NoError(t, d.Produce(model.NewUserUpdatedEvent(anna)))
+		// the debounced update of anna is stuck in the production
+		time.Sleep(50 * time.Millisecond)
+		deleted := make(chan struct{})
+		go func() {
+			assert.NoError(t, d.Produce(model.NewUserDeletedEvent(anna.ID)))
+			close(deleted)
+		}()
+
+		assert.NoError(t, d.Produce(model.NewUserCreatedEvent(bob)))
+		assert.Equal(t, []any{model.NewUserCreatedEvent(bob)}, stub.events())
+
+		close(release)
+		<-deleted
+		assert.Equal(t, []any{model.NewUserCreatedEvent(bob), model.NewUserUpdatedEvent(anna), model.NewUserDeletedEvent(anna.ID)},
+			stub.events(), "the user's events keep their order")
+	})
+	t.Run("other events are not delayed", func(t *testing.T) {
+		stub := &syncProducerStub{}
+		d := NewDebouncingProducer(stub, time.Hour)
+
+		assert.NoError(t, d.Produce(model.NewUserCreatedEvent(anna)))
+		assert.NoError(t, d.Produce("event"))
+
+		assert.Equal(t, []any{model.NewUserCreatedEvent(anna), "event"}, stub.events())
+	})
+}
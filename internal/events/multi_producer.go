@@ -0,0 +1,27 @@
+package events
+
+import "errors"
+
+type Producer interface {
+	Produce(event any) error
+}
+
+type MultiProducer struct {
+	producers []Producer
+}
+
+// NewMultiProducer creates new MultiProducer that produces each event to all the given producers.
+func NewMultiProducer(producers ...Producer) *MultiProducer {
+	return &MultiProducer{producers: producers}
+}
+
+// Produce produces the event to all producers, also when some of them fail. The errors of the failed ones are joined.
+func (m *MultiProducer) Produce(event any) error {
+	var errs []error
+	for _, p := range m.producers {
+		if err := p.Produce(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
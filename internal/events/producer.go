@@ -28,6 +28,7 @@ func NewKafkaProducer(bootstrapServer string, opts ...KafkaConfigOption) (*Kafka
 		return nil, errors.Wrap(err, "failed to create producer")
 	}
 
+	// started only once the producer is created, so a failed constructor leaves no goroutine behind
 	eventsWG := &sync.WaitGroup{}
 	eventsWG.Add(1)
 	go func() {
@@ -41,19 +42,17 @@ func NewKafkaProducer(bootstrapServer string, opts ...KafkaConfigOption) (*Kafka
 	}, nil
 }
 
-// Close gracefully closes the producer.
+// Close gracefully closes the producer. Closing the kafka producer closes its events channel, which terminates
+// the events logging goroutine, Close waits for it.
 func (k *KafkaProducer) Close(flushTimeout time.Duration) {
 	k.p.Flush(int(flushTimeout.Milliseconds()))
 	k.p.Close()
 	k.eventsWG.Wait()
 }
 
-// Produce produces given event data to the topic partition.
-func (k *KafkaProducer) Produce(event []byte, tp kafka.TopicPartition) error {
-	return k.p.Produce(&kafka.Message{
-		TopicPartition: tp,
-		Value:          event,
-	}, nil)
+// Produce produces the message to its topic partition.
+func (k *KafkaProducer) Produce(msg *kafka.Message) error {
+	return k.p.Produce(msg, nil)
 }
 
 // Health always reports the producer as healthy.
@@ -0,0 +1,28 @@
+package events
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"testing"
+	"time"
+)
+
+func Test_NewKafkaProducer_FailureDoesNotLeakGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	p, err := NewKafkaProducer("localhost:9092", WithOption("unknown.property", "value"))
+
+	assert.Error(t, err)
+	assert.Nil(t, p)
+}
+
+func Test_KafkaProducer_CloseTerminatesGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// the producer connects lazily, so no running kafka is needed
+	p, err := NewKafkaProducer("localhost:1")
+	require.NoError(t, err)
+
+	p.Close(10 * time.Millisecond)
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+type RateLimitOpt func(*RateLimitedProducer)
+
+// WithThrottledCounter sets the counter of the events whose production was delayed by the rate limit.
+func WithThrottledCounter(counter Counter) RateLimitOpt {
+	return func(r *RateLimitedProducer) {
+		r.throttled = counter
+	}
+}
+
+// RateLimitedProducer protects the brokers from the event bursts by spacing the produced events evenly
+// to at most the given number per second. Produce blocks until the event is allowed, so the excess events
+// wait in the caller e.g. in the AsyncProducer buffer.
+type RateLimitedProducer struct {
+	producer  Producer
+	interval  time.Duration
+	throttled Counter
+	now       func() time.Time
+	sleep     func(time.Duration)
+
+	mu sync.Mutex
+	// next is the earliest time the next event is allowed to be produced
+	next time.Time
+}
+
+// NewRateLimitedProducer creates new RateLimitedProducer producing at most eventsPerSecond events per second.
+func NewRateLimitedProducer(producer Producer, eventsPerSecond int, opts ...RateLimitOpt) *RateLimitedProducer {
+	r := &RateLimitedProducer{
+		producer:  producer,
+		interval:  time.Second / time.Duration(eventsPerSecond),
+		throttled: noopGauge{},
+		now:       time.Now,
+		sleep:     time.Sleep,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Produce waits until the event is allowed by the rate limit and produces it.
+func (r *RateLimitedProducer) Produce(event any) error {
+	if wait := r.reserve(); wait > 0 {
+		r.throttled.Inc()
+		r.sleep(wait)
+	}
+	return r.producer.Produce(event)
+}
+
+// reserve reserves the next production slot and returns how long to wait for it.
+func (r *RateLimitedProducer) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if r.next.Before(now) {
+		// the unused slots are not saved up, so an idle period doesn't allow a burst
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	return wait
+}
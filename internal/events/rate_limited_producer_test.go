@@ -0,0 +1,56 @@
+package events
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type counterStub struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (c *counterStub) Inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+}
+
+func Test_RateLimitedProducer(t *testing.T) {
+	start := time.Date(2024, 7, 13, 11, 0, 0, 0, time.UTC)
+	clock := start
+	var producedAt []time.Duration
+	stub := &syncProducerStub{}
+	throttled := &counterStub{}
+	limited := NewRateLimitedProducer(producerFunc(func(event any) error {
+		producedAt = append(producedAt, clock.Sub(start))
+		return stub.Produce(event)
+	}), 5, WithThrottledCounter(throttled))
+	limited.now = func() time.Time { return clock }
+	limited.sleep = func(d time.Duration) { clock = clock.Add(d) }
+
+	// a burst of events produced at once is spread to the rate
+	for i := 0; i < 5; i++ {
+		require.NoError(t, limited.Produce(i))
+	}
+	assert.Equal(t, []any{0, 1, 2, 3, 4}, stub.events())
+	assert.Equal(t, []time.Duration{0, 200 * time.Millisecond, 400 * time.Millisecond, 600 * time.Millisecond, 800 * time.Millisecond}, producedAt)
+	assert.Equal(t, 4, throttled.count)
+
+	// an idle period doesn't allow a next burst
+	clock = clock.Add(10 * time.Second)
+	producedAt = nil
+	require.NoError(t, limited.Produce(5))
+	require.NoError(t, limited.Produce(6))
+	assert.Equal(t, []time.Duration{10*time.Second + 800*time.Millisecond, 11 * time.Second}, producedAt)
+	assert.Equal(t, 5, throttled.count)
+}
+
+type producerFunc func(event any) error
+
+func (f producerFunc) Produce(event any) error {
+	return f(event)
+}
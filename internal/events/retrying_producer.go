@@ -0,0 +1,142 @@
+package events
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"time"
+)
+
+// RetryingProducer retries the failed event production with exponential backoff and jitter,
+// so a struggling broker is not hammered. Events failing all the attempts are dead-lettered.
+type RetryingProducer struct {
+	producer       Producer
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	deadLetter     func(event any, err error)
+	outcomes       func(outcome ProduceOutcome) Counter
+	attempts       Observer
+	sleep          func(time.Duration)
+	jitter         func(time.Duration) time.Duration
+}
+
+type RetryOpt func(*RetryingProducer)
+
+// ProduceOutcome is the final outcome of the event production with the retries.
+type ProduceOutcome string
+
+const (
+	// ProducedOK is the outcome of the events produced on the first attempt.
+	ProducedOK ProduceOutcome = "ok"
+	// ProducedRetriedOK is the outcome of the events produced after at least one retry.
+	ProducedRetriedOK ProduceOutcome = "retried_ok"
+	// ProduceFailed is the outcome of the events that failed all the attempts and were dead-lettered.
+	ProduceFailed ProduceOutcome = "failed"
+)
+
+// Observer observes the distribution of values e.g. prometheus.Histogram.
+type Observer interface {
+	Observe(float64)
+}
+
+type noopObserver struct{}
+
+func (noopObserver) Observe(float64) {}
+
+// WithDeadLetter sets the handler of the events that failed all the produce attempts. The failure is logged by default.
+func WithDeadLetter(deadLetter func(event any, err error)) RetryOpt {
+	return func(r *RetryingProducer) {
+		r.deadLetter = deadLetter
+	}
+}
+
+// WithOutcomeCounter sets the counters of the produced events by their final outcome.
+func WithOutcomeCounter(outcomes func(outcome ProduceOutcome) Counter) RetryOpt {
+	return func(r *RetryingProducer) {
+		r.outcomes = outcomes
+	}
+}
+
+// WithAttemptsObserver sets the observer of the number of the produce attempts each event needed.
+func WithAttemptsObserver(attempts Observer) RetryOpt {
+	return func(r *RetryingProducer) {
+		r.attempts = attempts
+	}
+}
+
+// NewRetryingProducer creates new RetryingProducer that tries to produce each event at most maxAttempts times.
+// The backoff between the attempts starts at initialBackoff and doubles up to maxBackoff.
+func NewRetryingProducer(producer Producer, maxAttempts int, initialBackoff, maxBackoff time.Duration, opts ...RetryOpt) *RetryingProducer {
+	r := &RetryingProducer{
+		producer:       producer,
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		deadLetter:     logDeadLetter,
+		outcomes:       func(ProduceOutcome) Counter { return noopGauge{} },
+		attempts:       noopObserver{},
+		sleep:          time.Sleep,
+		jitter:         equalJitter,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Produce produces the event, retrying the failed attempts. The error of the last attempt is returned
+// once the event is dead-lettered.
+func (r *RetryingProducer) Produce(event any) error {
+	var err error
+	for attempt := 1; attempt <= r.maxAttempts; attempt++ {
+		if err = r.producer.Produce(event); err == nil {
+			r.record(attempt, nil)
+			return nil
+		}
+		if attempt < r.maxAttempts {
+			r.sleep(r.jitter(r.backoff(attempt)))
+		}
+	}
+
+	err = fmt.Errorf("event dead-lettered after %d attempts: %w", r.maxAttempts, err)
+	r.record(r.maxAttempts, err)
+	r.deadLetter(event, err)
+	return err
+}
+
+// record records the outcome of the event production and the attempts it took.
+func (r *RetryingProducer) record(attempts int, err error) {
+	outcome := ProducedOK
+	switch {
+	case err != nil:
+		outcome = ProduceFailed
+	case attempts > 1:
+		outcome = ProducedRetriedOK
+	}
+	r.outcomes(outcome).Inc()
+	r.attempts.Observe(float64(attempts))
+}
+
+// backoff returns the backoff after the given failed attempt.
+func (r *RetryingProducer) backoff(attempt int) time.Duration {
+	backoff := r.initialBackoff
+	for i := 1; i < attempt && backoff < r.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, r.maxBackoff)
+}
+
+// equalJitter randomizes the backoff to between its half and full value, so retries of multiple events spread out.
+func equalJitter(backoff time.Duration) time.Duration {
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func logDeadLetter(event any, err error) {
+	logrus.WithError(err).
+		WithField("event_type", fmt.Sprintf("%T", event)).
+		Error("event dead-lettered")
+}
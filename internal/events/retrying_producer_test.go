@@ -0,0 +1,121 @@
+package events
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// failingProducerStub fails the first failures produce attempts.
+type failingProducerStub struct {
+	failures int
+	attempts int
+}
+
+func (p *failingProducerStub) Produce(_ any) error {
+	p.attempts++
+	if p.attempts <= p.failures {
+		return errors.New("broker down")
+	}
+	return nil
+}
+
+func Test_RetryingProducer(t *testing.T) {
+	tests := []struct {
+		name           string
+		failures       int
+		wantAttempts   int
+		wantBackoffs   []time.Duration
+		wantDeadLetter bool
+	}{
+		{
+			name:         "first attempt succeeds",
+			wantAttempts: 1,
+		},
+		{
+			name:         "succeeds after retries",
+			failures:     2,
+			wantAttempts: 3,
+			wantBackoffs: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name:           "dead-lettered after max attempts",
+			failures:       10,
+			wantAttempts:   5,
+			wantBackoffs:   []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond},
+			wantDeadLetter: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &failingProducerStub{failures: tt.failures}
+			var deadLettered []any
+			p := NewRetryingProducer(stub, 5, 100*time.Millisecond, 500*time.Millisecond,
+				WithDeadLetter(func(event any, _ error) {
+					deadLettered = append(deadLettered, event)
+				}))
+			var backoffs []time.Duration
+			p.sleep = func(d time.Duration) {
+				backoffs = append(backoffs, d)
+			}
+			p.jitter = func(d time.Duration) time.Duration {
+				return d
+			}
+
+			err := p.Produce("event")
+
+			assert.Equal(t, tt.wantAttempts, stub.attempts)
+			assert.Equal(t, tt.wantBackoffs, backoffs)
+			if tt.wantDeadLetter {
+				assert.ErrorContains(t, err, "broker down")
+				assert.Equal(t, []any{"event"}, deadLettered)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, deadLettered)
+			}
+		})
+	}
+}
+
+type observerStub struct {
+	values []float64
+}
+
+func (o *observerStub) Observe(v float64) {
+	o.values = append(o.values, v)
+}
+
+func Test_RetryingProducer_Metrics(t *testing.T) {
+	outcomes := map[ProduceOutcome]*counterStub{}
+	attempts := &observerStub{}
+	stub := &failingProducerStub{}
+	p := NewRetryingProducer(stub, 3, time.Millisecond, time.Millisecond,
+		WithDeadLetter(func(any, error) {}),
+		WithOutcomeCounter(func(outcome ProduceOutcome) Counter {
+			if outcomes[outcome] == nil {
+				outcomes[outcome] = &counterStub{}
+			}
+			return outcomes[outcome]
+		}),
+		WithAttemptsObserver(attempts))
+	p.sleep = func(time.Duration) {}
+
+	for _, failures := range []int{0, 2, 5, 0} {
+		stub.failures, stub.attempts = failures, 0
+		_ = p.Produce("event")
+	}
+
+	assert.Equal(t, 2, outcomes[ProducedOK].count)
+	assert.Equal(t, 1, outcomes[ProducedRetriedOK].count)
+	assert.Equal(t, 1, outcomes[ProduceFailed].count)
+	assert.Equal(t, []float64{1, 3, 3, 1}, attempts.values)
+}
+
+func Test_equalJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		got := equalJitter(100 * time.Millisecond)
+		assert.GreaterOrEqual(t, got, 50*time.Millisecond)
+		assert.LessOrEqual(t, got, 100*time.Millisecond)
+	}
+}
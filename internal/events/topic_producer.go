@@ -3,27 +3,115 @@ package events
 import (
 	"encoding/json"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"hash/fnv"
+	"time"
 )
 
+// timestampedEvent is an event that knows when it occurred e.g. model.UserEvent.
+type timestampedEvent interface {
+	OccurredAt() time.Time
+}
+
+// keyedEvent is an event with the key of the changed entity e.g. model.UserEvent keyed by the user ID.
+type keyedEvent interface {
+	Key() []byte
+}
+
+// PartitionStrategy decides the topic partition the events are produced to.
+type PartitionStrategy string
+
+const (
+	// PartitionDefault produces the events without a key, the partition is chosen by the client library.
+	PartitionDefault PartitionStrategy = "default"
+	// PartitionKeyHash produces the events with the key, the partition is the hash of the key by the client library
+	// partitioner, so all the events of an entity are in the same partition.
+	PartitionKeyHash PartitionStrategy = "key_hash"
+	// PartitionModulo produces the events with the key to the partition computed by the service as the FNV-1a hash
+	// of the key modulo the partition count, so another topic with the same count is partitioned the same way
+	// regardless of its producer partitioner.
+	PartitionModulo PartitionStrategy = "modulo"
+)
+
+type TopicOpt func(*KafkaTopicProducer)
+
+// WithEventTimestamps sets the message timestamps to the time the events occurred, or to the produce time
+// if the event doesn't know it. The timestamps are assigned by the client library or the broker by default,
+// based on the topic message.timestamp.type.
+func WithEventTimestamps() TopicOpt {
+	return func(k *KafkaTopicProducer) {
+		k.eventTimestamps = true
+	}
+}
+
+// WithPartitionStrategy sets how the partitions of the events are chosen, partitionCount is used only by PartitionModulo.
+// The events without a key are always produced to any partition.
+func WithPartitionStrategy(strategy PartitionStrategy, partitionCount int) TopicOpt {
+	return func(k *KafkaTopicProducer) {
+		k.partitionStrategy = strategy
+		k.partitionCount = partitionCount
+	}
+}
+
 type KafkaTopicProducer struct {
-	p              *KafkaProducer
-	topicPartition kafka.TopicPartition
+	p               *KafkaProducer
+	topicPartition  kafka.TopicPartition
+	eventTimestamps bool
+	now             func() time.Time
+
+	partitionStrategy PartitionStrategy
+	partitionCount    int
 }
 
 // NewKafkaTopicProducer creates new KafkaTopicProducer that produces events to given topic.
-func NewKafkaTopicProducer(kp *KafkaProducer, topic string) *KafkaTopicProducer {
-	return &KafkaTopicProducer{
-		p:              kp,
-		topicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+func NewKafkaTopicProducer(kp *KafkaProducer, topic string, opts ...TopicOpt) *KafkaTopicProducer {
+	k := &KafkaTopicProducer{
+		p:                 kp,
+		topicPartition:    kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		now:               time.Now,
+		partitionStrategy: PartitionDefault,
 	}
+
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	return k
 }
 
 // Produce marshals the given event into JSON and writes it to the kafka topic.
 func (k *KafkaTopicProducer) Produce(event any) error {
-	jsonBytes, err := json.Marshal(event)
+	msg, err := k.message(event)
 	if err != nil {
 		return err
 	}
 
-	return k.p.Produce(jsonBytes, k.topicPartition)
+	return k.p.Produce(msg)
+}
+
+// message creates the kafka message of the event.
+func (k *KafkaTopicProducer) message(event any) (*kafka.Message, error) {
+	jsonBytes, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &kafka.Message{
+		TopicPartition: k.topicPartition,
+		Value:          jsonBytes,
+	}
+	if e, ok := event.(keyedEvent); ok && k.partitionStrategy != PartitionDefault {
+		msg.Key = e.Key()
+	}
+	if k.partitionStrategy == PartitionModulo && msg.Key != nil {
+		hash := fnv.New32a()
+		_, _ = hash.Write(msg.Key)
+		msg.TopicPartition.Partition = int32(hash.Sum32() % uint32(k.partitionCount))
+	}
+	if k.eventTimestamps {
+		msg.Timestamp = k.now()
+		if e, ok := event.(timestampedEvent); ok && !e.OccurredAt().IsZero() {
+			msg.Timestamp = e.OccurredAt()
+		}
+	}
+	return msg, nil
 }
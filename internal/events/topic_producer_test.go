@@ -0,0 +1,119 @@
+package events
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func Test_KafkaTopicProducer_message(t *testing.T) {
+	updatedAt := time.Date(2024, 7, 13, 9, 19, 54, 625_000_000, time.UTC)
+	now := time.Date(2024, 7, 13, 9, 20, 0, 0, time.UTC)
+	user := model.User{ID: uuid.New(), FirstName: "anna", CreatedAt: updatedAt, UpdatedAt: updatedAt}
+
+	tests := []struct {
+		name          string
+		opts          []TopicOpt
+		event         any
+		wantTimestamp time.Time
+	}{
+		{
+			name:  "assigned by kafka by default",
+			event: model.NewUserUpdatedEvent(user),
+		},
+		{
+			name:          "event occurrence time",
+			opts:          []TopicOpt{WithEventTimestamps()},
+			event:         model.NewUserUpdatedEvent(user),
+			wantTimestamp: updatedAt,
+		},
+		{
+			name:          "produce time when the event time is unknown",
+			opts:          []TopicOpt{WithEventTimestamps()},
+			event:         model.NewUserDeletedEvent(user.ID),
+			wantTimestamp: now,
+		},
+		{
+			name:          "produce time of other events",
+			opts:          []TopicOpt{WithEventTimestamps()},
+			event:         "event",
+			wantTimestamp: now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKafkaTopicProducer(nil, "users", tt.opts...)
+			k.now = func() time.Time { return now }
+
+			msg, err := k.message(tt.event)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTimestamp, msg.Timestamp)
+			assert.Equal(t, "users", *msg.TopicPartition.Topic)
+			assert.NotEmpty(t, msg.Value)
+		})
+	}
+}
+
+func Test_KafkaTopicProducer_PartitionStrategy(t *testing.T) {
+	user := model.User{ID: uuid.MustParse("10e4feb6-40f9-11ef-a3eb-0242ac170004")}
+	userKey := []byte(user.ID.String())
+
+	tests := []struct {
+		name          string
+		strategy      PartitionStrategy
+		event         any
+		wantKey       []byte
+		wantPartition int32
+	}{
+		{
+			name:          "default without key",
+			strategy:      PartitionDefault,
+			event:         model.NewUserUpdatedEvent(user),
+			wantPartition: kafka.PartitionAny,
+		},
+		{
+			name:          "key hash by the client library",
+			strategy:      PartitionKeyHash,
+			event:         model.NewUserDeletedEvent(user.ID),
+			wantKey:       userKey,
+			wantPartition: kafka.PartitionAny,
+		},
+		{
+			name:          "modulo of the key hash",
+			strategy:      PartitionModulo,
+			event:         model.NewUserCreatedEvent(user),
+			wantKey:       userKey,
+			wantPartition: 7,
+		},
+		{
+			name:          "modulo of the same user key",
+			strategy:      PartitionModulo,
+			event:         model.NewUserDeletedEvent(user.ID),
+			wantKey:       userKey,
+			wantPartition: 7,
+		},
+		{
+			name:          "modulo of an event without key",
+			strategy:      PartitionModulo,
+			event:         model.NewUsersBulkUpdatedEvent(model.BulkUpdate{}, 2),
+			wantPartition: kafka.PartitionAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKafkaTopicProducer(nil, "users", WithPartitionStrategy(tt.strategy, 12))
+
+			msg, err := k.message(tt.event)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKey, msg.Key)
+			assert.Equal(t, "users", *msg.TopicPartition.Topic)
+			assert.Equal(t, tt.wantPartition, msg.TopicPartition.Partition)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package grpcapi
+
+import (
+	"user-service/internal/controller"
+	"user-service/internal/model"
+)
+
+const (
+	defaultMaxPageSize = 100
+	defaultPageSize    = 20
+)
+
+type Opt func(*serverConfig)
+
+// WithPageSizes sets the number of users listed when the page size is not requested and the maximum requested one.
+func WithPageSizes(defaultSize, maxSize int) Opt {
+	return func(c *serverConfig) {
+		c.defaultPageSize = defaultSize
+		c.maxPageSize = maxSize
+	}
+}
+
+// WithSortFields restricts the fields the users can be listed by, all the sortable fields are allowed if none is given.
+func WithSortFields(fields ...string) Opt {
+	return func(c *serverConfig) {
+		if len(fields) > 0 {
+			c.sortFields = model.FieldSet(fields)
+		}
+	}
+}
+
+// WithUserValidator sets the validator of the written users, it should be configured the same as the REST handlers.
+func WithUserValidator(validator controller.UserValidator) Opt {
+	return func(c *serverConfig) {
+		c.userValidator = validator
+	}
+}
+
+// WithReadOnlyMode rejects the user writes with Unavailable while the mode is enabled, shared with the REST API.
+func WithReadOnlyMode(mode *controller.ReadOnlyMode) Opt {
+	return func(c *serverConfig) {
+		c.readOnlyMode = mode
+	}
+}
+
+// WithAuthSubjectMetadata sets the request metadata key with the authenticated subject set by a trusted auth proxy,
+// the same as the HTTP header of the REST API.
+func WithAuthSubjectMetadata(key string) Opt {
+	return func(c *serverConfig) {
+		c.authSubjectMetadata = key
+	}
+}
+
+type serverConfig struct {
+	defaultPageSize int
+	maxPageSize     int
+	sortFields      map[string]struct{}
+	userValidator   controller.UserValidator
+	// readOnlyMode is nil if the writes are never rejected
+	readOnlyMode *controller.ReadOnlyMode
+	// authSubjectMetadata is empty if the callers are not authenticated
+	authSubjectMetadata string
+}
+
+func newServerConfig(opts ...Opt) serverConfig {
+	cfg := serverConfig{
+		defaultPageSize: defaultPageSize,
+		maxPageSize:     defaultMaxPageSize,
+		sortFields:      model.FieldSet(model.SortableFields),
+		userValidator:   controller.NewUserValidator(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
@@ -0,0 +1,226 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net/http"
+	"user-service/internal/auth"
+	custom_err "user-service/internal/errors"
+	"user-service/internal/grpcapi/userspb"
+	"user-service/internal/model"
+)
+
+type Service interface {
+	CreateUser(ctx context.Context, user model.User) (*model.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error)
+	UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+}
+
+// NewServer creates new gRPC server exposing the users CRUD operations of the service.
+func NewServer(svc Service, opts ...Opt) *grpc.Server {
+	cfg := newServerConfig(opts...)
+	var interceptors []grpc.UnaryServerInterceptor
+	if cfg.authSubjectMetadata != "" {
+		interceptors = append(interceptors, auth.TrustedMetadataSubjectInterceptor(cfg.authSubjectMetadata))
+	}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	userspb.RegisterUsersServiceServer(server, &UsersServer{svc: svc, cfg: cfg})
+	return server
+}
+
+// UsersServer implements the users gRPC API on top of the same Service as the REST API.
+type UsersServer struct {
+	userspb.UnimplementedUsersServiceServer
+	svc Service
+	cfg serverConfig
+}
+
+func (s *UsersServer) CreateUser(ctx context.Context, req *userspb.CreateUserRequest) (*userspb.User, error) {
+	if err := s.rejectIfReadOnly(); err != nil {
+		return nil, err
+	}
+	if req.GetUser() == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+	user, err := s.validatedUser(ctx, req.GetUser())
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.svc.CreateUser(ctx, *user)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toProtoUser(*created), nil
+}
+
+func (s *UsersServer) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	id, err := parseUserID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.svc.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toProtoUser(*user), nil
+}
+
+func (s *UsersServer) ListUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersResponse, error) {
+	params := model.GetUsersParams{
+		PageSize: int(req.GetPageSize()),
+		Page:     int(req.GetPage()),
+		Sort:     model.Sort{Field: req.GetSortField(), Type: "asc"},
+	}
+	if params.PageSize == 0 {
+		params.PageSize = s.cfg.defaultPageSize
+	}
+	if params.PageSize > s.cfg.maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size cannot be bigger than %d", s.cfg.maxPageSize)
+	}
+	if params.Sort.Field == "" {
+		params.Sort.Field = "last_name"
+	} else if _, ok := s.cfg.sortFields[params.Sort.Field]; !ok {
+		return nil, status.Error(codes.InvalidArgument, "unsupported sorting field")
+	}
+	if req.GetDescending() {
+		params.Sort.Type = "desc"
+	}
+	if err := params.Validate(); err != nil {
+		return nil, statusError(err)
+	}
+
+	users, err := s.svc.GetUsers(ctx, params)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &userspb.ListUsersResponse{Users: make([]*userspb.User, 0, len(users))}
+	for _, u := range users {
+		resp.Users = append(resp.Users, toProtoUser(u))
+	}
+	return resp, nil
+}
+
+func (s *UsersServer) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*emptypb.Empty, error) {
+	if err := s.rejectIfReadOnly(); err != nil {
+		return nil, err
+	}
+	if req.GetUser() == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+	id, err := parseUserID(req.GetUser().GetId())
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.validatedUser(ctx, req.GetUser())
+	if err != nil {
+		return nil, err
+	}
+	user.ID = id
+
+	if err := s.svc.UpdateUser(ctx, *user, model.ExpectedFields{}); err != nil {
+		return nil, statusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UsersServer) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := s.rejectIfReadOnly(); err != nil {
+		return nil, err
+	}
+	id, err := parseUserID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.svc.DeleteUser(ctx, id); err != nil {
+		return nil, statusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// rejectIfReadOnly returns Unavailable while the read-only mode is enabled, the same way the REST API rejects the writes.
+func (s *UsersServer) rejectIfReadOnly() error {
+	if s.cfg.readOnlyMode != nil && s.cfg.readOnlyMode.Enabled() {
+		return status.Error(codes.Unavailable, "service is in read-only mode")
+	}
+	return nil
+}
+
+// validatedUser converts the written user and validates it by the same rules as the REST API.
+func (s *UsersServer) validatedUser(ctx context.Context, u *userspb.User) (*model.User, error) {
+	user := fromProtoUser(u)
+	if err := s.cfg.userValidator.Validate(ctx, user); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return user, nil
+}
+
+func parseUserID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "incorrect user ID format: %v", err)
+	}
+	return parsed, nil
+}
+
+// fromProtoUser converts the written user. The ID and timestamps are not converted, they are set by the service.
+func fromProtoUser(u *userspb.User) *model.User {
+	return &model.User{
+		FirstName: u.GetFirstName(),
+		LastName:  u.GetLastName(),
+		Nickname:  u.GetNickname(),
+		Password:  u.GetPassword(),
+		Email:     u.GetEmail(),
+		Phone:     u.GetPhone(),
+		Country:   u.GetCountry(),
+	}
+}
+
+// toProtoUser converts the returned user, the password is never returned.
+func toProtoUser(u model.User) *userspb.User {
+	return &userspb.User{
+		Id:        u.ID.String(),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Nickname:  u.Nickname,
+		Email:     u.Email,
+		Phone:     u.Phone,
+		Country:   u.Country,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+		CreatedBy: u.CreatedBy,
+		UpdatedBy: u.UpdatedBy,
+	}
+}
+
+// statusCodes are the gRPC status codes of the HTTP statuses the service errors are mapped to.
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnprocessableEntity: codes.InvalidArgument,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// statusError maps the service error to the gRPC status by the HTTP status and message of the REST API.
+// Unexpected errors are logged.
+func statusError(err error) error {
+	code, ok := statusCodes[custom_err.HTTPStatus(err)]
+	if !ok {
+		logrus.WithError(err).Error("gRPC request failed")
+		return status.Error(codes.Internal, custom_err.Message(err))
+	}
+	return status.Error(code, custom_err.Message(err))
+}
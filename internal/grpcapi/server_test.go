@@ -0,0 +1,198 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"user-service/internal/controller"
+	"user-service/internal/grpcapi/userspb"
+	"user-service/internal/service"
+	"user-service/internal/service/test_helpers"
+)
+
+// newTestClient serves the gRPC API of the service backed by the in-memory storage over an in-memory connection.
+func newTestClient(t *testing.T, opts ...Opt) userspb.UsersServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(service.New(test_helpers.NewMemoryStorage(), test_helpers.NoopEventsProducer{}), opts...)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return userspb.NewUsersServiceClient(conn)
+}
+
+func Test_UsersServer_CreateAndGet(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	created, err := client.CreateUser(ctx, &userspb.CreateUserRequest{User: &userspb.User{
+		FirstName: "John",
+		LastName:  "Wick",
+		Nickname:  "johnnywicky",
+		Password:  "securepwd",
+		Email:     "johnnywicky@gmail.com",
+		Phone:     "+44 20 7946 0958",
+		Country:   "UK",
+	}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.GetId())
+	assert.Empty(t, created.GetPassword())
+	assert.Equal(t, "+442079460958", created.GetPhone())
+	assert.False(t, created.GetCreatedAt().AsTime().IsZero())
+
+	got, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: created.GetId()})
+	require.NoError(t, err)
+	assert.Equal(t, created.GetId(), got.GetId())
+	assert.Equal(t, "John", got.GetFirstName())
+	assert.Equal(t, "Wick", got.GetLastName())
+	assert.Equal(t, "johnnywicky", got.GetNickname())
+	assert.Equal(t, "johnnywicky@gmail.com", got.GetEmail())
+	assert.Equal(t, "UK", got.GetCountry())
+	assert.Empty(t, got.GetPassword())
+	assert.Equal(t, created.GetCreatedAt().AsTime(), got.GetCreatedAt().AsTime())
+}
+
+func Test_UsersServer_Errors(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	tests := []struct {
+		name     string
+		call     func() error
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{
+			name: "missing required field",
+			call: func() error {
+				_, err := client.CreateUser(ctx, &userspb.CreateUserRequest{User: &userspb.User{FirstName: "John"}})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+			wantMsg:  "last name is required",
+		},
+		{
+			name: "invalid email",
+			call: func() error {
+				_, err := client.CreateUser(ctx, &userspb.CreateUserRequest{User: &userspb.User{
+					FirstName: "John", LastName: "Wick", Nickname: "johnny", Password: "pwd", Email: "johnny", Country: "UK",
+				}})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+			wantMsg:  "email is invalid",
+		},
+		{
+			name: "invalid ID",
+			call: func() error {
+				_, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: "not-uuid"})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+			wantMsg:  "incorrect user ID format: invalid UUID length: 8",
+		},
+		{
+			name: "not found",
+			call: func() error {
+				_, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: uuid.NewString()})
+				return err
+			},
+			wantCode: codes.NotFound,
+			wantMsg:  "user not found",
+		},
+		{
+			name: "negative page",
+			call: func() error {
+				_, err := client.ListUsers(ctx, &userspb.ListUsersRequest{Page: -1})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+			wantMsg:  "page cannot be a negative number",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, tt.wantCode, st.Code())
+			assert.Equal(t, tt.wantMsg, st.Message())
+		})
+	}
+}
+
+func Test_UsersServer_RESTRules(t *testing.T) {
+	ctx := context.Background()
+	readOnly := controller.NewReadOnlyMode(false)
+	client := newTestClient(t,
+		WithUserValidator(controller.NewUserValidator(controller.WithMaxFieldLengths(map[string]int{"nickname": 5}))),
+		WithReadOnlyMode(readOnly),
+		WithAuthSubjectMetadata("X-Auth-Subject"))
+	user := &userspb.User{FirstName: "John", LastName: "Wick", Nickname: "johnny", Password: "pwd", Email: "john@gmail.com", Country: "UK"}
+
+	// the configured REST validation applies
+	_, err := client.CreateUser(ctx, &userspb.CreateUserRequest{User: user})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "nickname is too long, maximum is 5 characters", status.Convert(err).Message())
+
+	// the authenticated subject is attributed
+	user.Nickname = "john"
+	created, err := client.CreateUser(metadata.AppendToOutgoingContext(ctx, "x-auth-subject", "support-agent"),
+		&userspb.CreateUserRequest{User: user})
+	require.NoError(t, err)
+	assert.Equal(t, "support-agent", created.GetCreatedBy())
+
+	// the writes are rejected in the read-only mode
+	readOnly.SetEnabled(true)
+	_, err = client.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: created.GetId()})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "service is in read-only mode", status.Convert(err).Message())
+}
+
+func Test_UsersServer_ListUsers(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, WithPageSizes(2, 3), WithSortFields("first_name"))
+	for _, name := range []string{"Anna", "Bob", "Cecil"} {
+		_, err := client.CreateUser(ctx, &userspb.CreateUserRequest{User: &userspb.User{
+			FirstName: name, LastName: "Wick", Nickname: name, Password: "pwd", Email: name + "@gmail.com", Country: "UK",
+		}})
+		require.NoError(t, err)
+	}
+
+	// the configured default page size applies
+	got, err := client.ListUsers(ctx, &userspb.ListUsersRequest{SortField: "first_name"})
+	require.NoError(t, err)
+	assert.Len(t, got.GetUsers(), 2)
+
+	got, err = client.ListUsers(ctx, &userspb.ListUsersRequest{PageSize: 3})
+	require.NoError(t, err)
+	assert.Len(t, got.GetUsers(), 3)
+
+	// the page size over the configured maximum is rejected
+	_, err = client.ListUsers(ctx, &userspb.ListUsersRequest{PageSize: 4})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "page_size cannot be bigger than 3", status.Convert(err).Message())
+
+	// only the configured sort fields are allowed
+	_, err = client.ListUsers(ctx, &userspb.ListUsersRequest{SortField: "email"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "unsupported sorting field", status.Convert(err).Message())
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+var (
+	eventsOnce      sync.Once
+	eventQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "user_service",
+		Name:      "event_queue_depth",
+		Help:      "Number of user events queued for the async production that were not produced yet.",
+	})
+	eventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "user_service",
+		Name:      "events_dropped_total",
+		Help:      "Number of user events dropped because the async production buffer was full.",
+	})
+	eventsThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "user_service",
+		Name:      "events_throttled_total",
+		Help:      "Number of user events whose production was delayed by the produce rate limit.",
+	})
+	eventsProduced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "user_service",
+		Name:      "events_produced_total",
+		Help:      "Number of user events by the final outcome of their production: ok, retried_ok or failed.",
+	}, []string{"outcome"})
+	eventProduceAttempts = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Subsystem: "user_service",
+		Name:      "event_produce_attempts",
+		Help:      "Number of the produce attempts the user events needed, including the failed ones.",
+		Buckets:   []float64{1, 2, 3, 5, 8, 13},
+	})
+)
+
+// RegisterEventsMetrics registers the events prometheus metrics.
+func RegisterEventsMetrics() {
+	eventsOnce.Do(func() {
+		prometheus.MustRegister(eventQueueDepth, eventsDropped, eventsThrottled, eventsProduced, eventProduceAttempts)
+	})
+}
+
+// EventQueueDepthGauge returns the gauge of the events queued for the async production.
+func EventQueueDepthGauge() prometheus.Gauge {
+	return eventQueueDepth
+}
+
+// EventsDroppedCounter returns the counter of the events dropped because the async production buffer was full.
+func EventsDroppedCounter() prometheus.Counter {
+	return eventsDropped
+}
+
+// EventsThrottledCounter returns the counter of the events whose production was delayed by the produce rate limit.
+func EventsThrottledCounter() prometheus.Counter {
+	return eventsThrottled
+}
+
+// EventsProducedCounter returns the counter of the events with the given final outcome of their production.
+func EventsProducedCounter(outcome string) prometheus.Counter {
+	return eventsProduced.WithLabelValues(outcome)
+}
+
+// EventProduceAttemptsHistogram returns the histogram of the produce attempts the events needed.
+func EventProduceAttemptsHistogram() prometheus.Histogram {
+	return eventProduceAttempts
+}
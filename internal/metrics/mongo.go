@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+	"sync"
+)
+
+type connectionState int
+
+const (
+	connectionAvailable connectionState = iota
+	connectionCheckedOut
+)
+
+type connectionKey struct {
+	address string
+	id      uint64
+}
+
+var (
+	mongoOnce        sync.Once
+	mongoPoolMetrics *poolMetrics
+)
+
+// poolMetrics tracks the state of the Mongo connections based on the pool events.
+// The gauges are totals of all the pools of the client - one per server.
+type poolMetrics struct {
+	mu          sync.Mutex
+	connections map[connectionKey]connectionState
+	checkedOut  prometheus.Gauge
+	available   prometheus.Gauge
+	// size is the number of the open connections, both checked out and available
+	size prometheus.Gauge
+}
+
+func newPoolMetrics(checkedOut, available, size prometheus.Gauge) *poolMetrics {
+	return &poolMetrics{
+		connections: map[connectionKey]connectionState{},
+		checkedOut:  checkedOut,
+		available:   available,
+		size:        size,
+	}
+}
+
+// NewMongoPoolMonitor registers the Mongo connection pool prometheus metrics and returns
+// the pool monitor that updates them.
+func NewMongoPoolMonitor() *event.PoolMonitor {
+	mongoOnce.Do(func() {
+		mongoPoolMetrics = newPoolMetrics(
+			promauto.NewGauge(prometheus.GaugeOpts{
+				Subsystem: "user_service",
+				Name:      "mongo_pool_checked_out_connections",
+				Help:      "Number of Mongo connections checked out of the pool.",
+			}),
+			promauto.NewGauge(prometheus.GaugeOpts{
+				Subsystem: "user_service",
+				Name:      "mongo_pool_available_connections",
+				Help:      "Number of idle Mongo connections available in the pool.",
+			}),
+			promauto.NewGauge(prometheus.GaugeOpts{
+				Subsystem: "user_service",
+				Name:      "mongo_pool_size",
+				Help:      "Number of open Mongo connections in the pool, both checked out and available.",
+			}),
+		)
+	})
+
+	return &event.PoolMonitor{Event: mongoPoolMetrics.handle}
+}
+
+func (p *poolMetrics) handle(e *event.PoolEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := connectionKey{address: e.Address, id: e.ConnectionID}
+	state, known := p.connections[key]
+
+	switch e.Type {
+	case event.ConnectionReady:
+		p.connections[key] = connectionAvailable
+		p.available.Inc()
+		p.size.Inc()
+	case event.GetSucceeded:
+		if known && state == connectionAvailable {
+			p.connections[key] = connectionCheckedOut
+			p.available.Dec()
+			p.checkedOut.Inc()
+		}
+	case event.ConnectionReturned:
+		if known && state == connectionCheckedOut {
+			p.connections[key] = connectionAvailable
+			p.checkedOut.Dec()
+			p.available.Inc()
+		}
+	case event.ConnectionClosed:
+		// connections failing before being ready are not tracked
+		if !known {
+			return
+		}
+		delete(p.connections, key)
+		p.size.Dec()
+		if state == connectionCheckedOut {
+			p.checkedOut.Dec()
+		} else {
+			p.available.Dec()
+		}
+	}
+}
+
+var (
+	usersOnce  sync.Once
+	usersTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "user_service",
+		Name:      "users_total",
+		Help:      "Estimated number of the stored users, updated by the health checks.",
+	})
+)
+
+// RegisterUsersMetrics registers the stored users prometheus metrics.
+func RegisterUsersMetrics() {
+	usersOnce.Do(func() {
+		prometheus.MustRegister(usersTotal)
+	})
+}
+
+// SetUsersTotal sets the number of the stored users.
+func SetUsersTotal(users int64) {
+	usersTotal.Set(float64(users))
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/event"
+	"testing"
+)
+
+func Test_poolMetrics(t *testing.T) {
+	const address = "mongo:27017"
+	connEvent := func(eventType string, id uint64) *event.PoolEvent {
+		return &event.PoolEvent{Type: eventType, Address: address, ConnectionID: id}
+	}
+
+	tests := []struct {
+		name           string
+		events         []*event.PoolEvent
+		wantCheckedOut float64
+		wantAvailable  float64
+		wantSize       float64
+	}{
+		{
+			name:          "ready connections are available",
+			events:        []*event.PoolEvent{connEvent(event.ConnectionReady, 1), connEvent(event.ConnectionReady, 2)},
+			wantAvailable: 2,
+			wantSize:      2,
+		},
+		{
+			name: "checked out connection",
+			events: []*event.PoolEvent{
+				connEvent(event.ConnectionReady, 1),
+				connEvent(event.ConnectionReady, 2),
+				connEvent(event.GetSucceeded, 1),
+			},
+			wantCheckedOut: 1,
+			wantAvailable:  1,
+			wantSize:       2,
+		},
+		{
+			name: "returned connection",
+			events: []*event.PoolEvent{
+				connEvent(event.ConnectionReady, 1),
+				connEvent(event.GetSucceeded, 1),
+				connEvent(event.ConnectionReturned, 1),
+			},
+			wantAvailable: 1,
+			wantSize:      1,
+		},
+		{
+			name: "closed connections",
+			events: []*event.PoolEvent{
+				connEvent(event.ConnectionReady, 1),
+				connEvent(event.ConnectionReady, 2),
+				connEvent(event.GetSucceeded, 2),
+				connEvent(event.ConnectionClosed, 1),
+				connEvent(event.ConnectionClosed, 2),
+			},
+		},
+		{
+			name: "connection failing before ready",
+			events: []*event.PoolEvent{
+				connEvent(event.ConnectionCreated, 1),
+				connEvent(event.ConnectionClosed, 1),
+			},
+		},
+		{
+			name: "same connection id of different servers",
+			events: []*event.PoolEvent{
+				connEvent(event.ConnectionReady, 1),
+				{Type: event.ConnectionReady, Address: "mongo-2:27017", ConnectionID: 1},
+				connEvent(event.GetSucceeded, 1),
+			},
+			wantCheckedOut: 1,
+			wantAvailable:  1,
+			wantSize:       2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkedOut := prometheus.NewGauge(prometheus.GaugeOpts{Name: "checked_out"})
+			available := prometheus.NewGauge(prometheus.GaugeOpts{Name: "available"})
+			size := prometheus.NewGauge(prometheus.GaugeOpts{Name: "size"})
+			p := newPoolMetrics(checkedOut, available, size)
+
+			for _, e := range tt.events {
+				p.handle(e)
+			}
+
+			assert.Equal(t, tt.wantCheckedOut, testutil.ToFloat64(checkedOut))
+			assert.Equal(t, tt.wantAvailable, testutil.ToFloat64(available))
+			assert.Equal(t, tt.wantSize, testutil.ToFloat64(size))
+		})
+	}
+}
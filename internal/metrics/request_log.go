@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"time"
+)
+
+// routeKey is the gin context key of the matched route, so it's available to the log formatter.
+const routeKey = "request_log_route"
+
+// RequestLogMiddleware returns HTTP middleware that logs every request to the output in the gin format. The requests
+// taking longer than the slow threshold are logged as a warning instead, with the matched route e.g. /v1/users/:userID,
+// so the slow requests of an endpoint can be grouped. The slow logging is disabled when the threshold is zero
+// and skipped for the streaming routes e.g. /v1/users/stream, as they are long by design.
+func RequestLogMiddleware(out io.Writer, slowThreshold time.Duration, streamingRoutes ...string) gin.HandlerFunc {
+	streaming := make(map[string]struct{}, len(streamingRoutes))
+	for _, route := range streamingRoutes {
+		streaming[route] = struct{}{}
+	}
+
+	logger := gin.LoggerWithConfig(gin.LoggerConfig{
+		Output: out,
+		Formatter: func(param gin.LogFormatterParams) string {
+			route, _ := param.Keys[routeKey].(string)
+			if _, ok := streaming[route]; ok || slowThreshold <= 0 || param.Latency <= slowThreshold {
+				return formatRequestLog(param)
+			}
+			if route == "" {
+				// not matched by any route
+				route = removeDynamicPathParams(param.Path)
+			}
+			logrus.WithField("method", param.Method).
+				WithField("path", route).
+				WithField("status", param.StatusCode).
+				WithField("duration", param.Latency).
+				WithField("client_ip", param.ClientIP).
+				Warn("slow HTTP request")
+			return ""
+		},
+	})
+	return func(c *gin.Context) {
+		c.Set(routeKey, c.FullPath())
+		logger(c)
+	}
+}
+
+// formatRequestLog formats the request log line the same way as the default gin logger.
+func formatRequestLog(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		param.Path,
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_RequestLogMiddleware(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(RequestLogMiddleware(&out, 10*time.Millisecond, "/v1/users/stream"))
+	slowHandler := func(c *gin.Context) {
+		if c.Query("slow") == "true" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		c.Status(http.StatusNotFound)
+	}
+	router.GET("/v1/users/:userID", slowHandler)
+	router.GET("/v1/users/stream", slowHandler)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/users/123", nil))
+	assert.Equal(t, 0, len(hook.AllEntries()))
+	assert.Equal(t, true, strings.Contains(out.String(), `"/v1/users/123"`))
+
+	out.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/users/123?slow=true", nil))
+	assert.Equal(t, 1, len(hook.AllEntries()))
+	entry := hook.LastEntry()
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+	assert.Equal(t, "slow HTTP request", entry.Message)
+	assert.Equal(t, "/v1/users/:userID", entry.Data["path"])
+	assert.Equal(t, http.StatusNotFound, entry.Data["status"])
+	// the slow request is logged only once
+	assert.Equal(t, "", out.String())
+
+	// the streaming routes are long by design
+	hook.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/users/stream?slow=true", nil))
+	assert.Equal(t, 0, len(hook.AllEntries()))
+	assert.Equal(t, true, strings.Contains(out.String(), `"/v1/users/stream?slow=true"`))
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+const fieldLabel = "field"
+
+var (
+	validationOnce         sync.Once
+	softValidationWarnings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "user_service",
+		Name:      "soft_validation_warnings_total",
+		Help:      "Number of accepted requests with invalid user field, by the field.",
+	}, []string{fieldLabel})
+)
+
+// RegisterValidationMetrics registers the validation prometheus metrics.
+func RegisterValidationMetrics() {
+	validationOnce.Do(func() {
+		prometheus.MustRegister(softValidationWarnings)
+	})
+}
+
+// CollectSoftValidationWarning counts the accepted request with invalid field.
+func CollectSoftValidationWarning(field string) {
+	softValidationWarnings.With(prometheus.Labels{fieldLabel: field}).Inc()
+}
@@ -0,0 +1,14 @@
+package model
+
+// BulkUpdate defines the change of all the users matching the filter.
+type BulkUpdate struct {
+	Filter FilterFields `json:"filter"`
+	// Set maps the updated user fields to their new values.
+	Set map[string]string `json:"set"`
+}
+
+// UsersBulkUpdatedData is the data of the event emitted once per bulk update instead of the user updated events.
+type UsersBulkUpdatedData struct {
+	BulkUpdate
+	ModifiedCount int64 `json:"modified_count"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "context"
+
+type dryRunKey struct{}
+
+// ContextWithDryRun returns a copy of the context marking the writes done with it as dry run, so they are only
+// validated without being persisted or producing events.
+func ContextWithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun returns true if the context marks the writes as dry run.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"context"
+	"sync"
+)
+
+type eventCaptureKey struct{}
+
+// EventCapture collects the user events produced while handling a request e.g. to show them for debugging.
+type EventCapture struct {
+	mu     sync.Mutex
+	events []UserEvent
+}
+
+// ContextWithEventCapture returns a copy of the context carrying a new event capture.
+func ContextWithEventCapture(ctx context.Context) (context.Context, *EventCapture) {
+	capture := &EventCapture{}
+	return context.WithValue(ctx, eventCaptureKey{}, capture), capture
+}
+
+// CaptureEvent records the event to the capture carried by the context, it does nothing if there is none.
+func CaptureEvent(ctx context.Context, event UserEvent) {
+	capture, ok := ctx.Value(eventCaptureKey{}).(*EventCapture)
+	if !ok {
+		return
+	}
+
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	capture.events = append(capture.events, event)
+}
+
+// Events returns the captured events in the order they were produced.
+func (c *EventCapture) Events() []UserEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]UserEvent(nil), c.events...)
+}
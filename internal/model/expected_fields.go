@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// expectableFields are the user fields whose current values can be expected by the update.
+var expectableFields = map[string]struct{}{
+	"first_name": {},
+	"last_name":  {},
+	"nickname":   {},
+	"email":      {},
+	"country":    {},
+	"phone":      {},
+}
+
+// ExpectedFields are the expected current values of the user fields, the update is done only if all of them match.
+type ExpectedFields map[string]string
+
+// Validate returns an error if any of the fields can't be expected.
+func (e ExpectedFields) Validate() error {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if _, ok := expectableFields[field]; !ok {
+			return fmt.Errorf("field %s cannot be expected", field)
+		}
+	}
+	return nil
+}
+
+// Match returns true if the current values of the user fields match all the expected ones.
+func (e ExpectedFields) Match(user User) bool {
+	current := expectableFieldValues(user)
+	for field, expected := range e {
+		if current[field] != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpectedFieldsOf returns the current values of the given user fields as the expected ones.
+func ExpectedFieldsOf(user User, fields ...string) ExpectedFields {
+	current := expectableFieldValues(user)
+	expected := make(ExpectedFields, len(fields))
+	for _, field := range fields {
+		expected[field] = current[field]
+	}
+	return expected
+}
+
+func expectableFieldValues(user User) map[string]string {
+	return map[string]string{
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"nickname":   user.Nickname,
+		"email":      user.Email,
+		"country":    user.Country,
+		"phone":      user.Phone,
+	}
+}
@@ -1,11 +1,49 @@
 package model
 
+import custom_err "user-service/internal/errors"
+
+// SortableFields are the user fields the users list can be sorted by, the configuration can only restrict them.
+var SortableFields = []string{"first_name", "last_name", "nickname", "password", "email", "country", "created_at", "updated_at"}
+
+// FilterableFields are the query parameters the users list can be filtered by, the configuration can only restrict them.
+var FilterableFields = []string{"first_name", "last_name", "nickname", "email", "country", "phone", "email_domain", "created_by"}
+
+// FieldSet returns the set of the fields e.g. to look up the configured SortableFields or FilterableFields.
+func FieldSet(fields []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		set[f] = struct{}{}
+	}
+	return set
+}
+
 // GetUsersParams represent parameters to fetch users list.
 type GetUsersParams struct {
 	PageSize     int
 	Page         int
 	Sort         Sort
 	FilterFields FilterFields
+	// PeekNext fetches one more user over the page size, so the caller can tell a capped result from the full one.
+	PeekNext bool
+	// IncludeHidden returns also the users hidden by default e.g. the service accounts.
+	IncludeHidden bool
+	// CaseInsensitive matches the exact filters ignoring the case, the sorting ignores it too.
+	CaseInsensitive bool
+}
+
+// Validate returns *errors.InvalidParameterError naming the query parameter if the params can't be used to list
+// the users. It's the single source of the rules shared by the controller and the storage.
+func (p GetUsersParams) Validate() error {
+	if p.PageSize < 0 {
+		return custom_err.NewOutOfRangeParameterError("pageSize", "pageSize cannot be a negative number")
+	}
+	if p.Page < 0 {
+		return custom_err.NewOutOfRangeParameterError("page", "page cannot be a negative number")
+	}
+	if p.Sort.Field == "" {
+		return custom_err.NewInvalidParameterError("sortBy", "sort field is required")
+	}
+	return nil
 }
 
 type Sort struct {
@@ -13,10 +51,26 @@ type Sort struct {
 	Type  string
 }
 
+// FilterFields are the filters of the users, a nil filter is not applied while an empty one matches the empty value.
 type FilterFields struct {
-	FirstName string
-	LastName  string
-	Nickname  string
-	Email     string
-	Country   string
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Nickname  *string `json:"nickname,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Country   *string `json:"country,omitempty"`
+	Phone     *string `json:"phone,omitempty"`
+	// EmailDomain matches users whose email is in the domain, subdomains are not matched.
+	EmailDomain *string `json:"email_domain,omitempty"`
+	// CreatedBy matches users created by the subject, the empty one matches the users created by unauthenticated callers.
+	CreatedBy *string `json:"created_by,omitempty"`
+}
+
+// IsEmpty returns true if no filter is set.
+func (f FilterFields) IsEmpty() bool {
+	return f == FilterFields{}
+}
+
+// Ptr returns pointer to the value e.g. to set a filter.
+func Ptr[T any](v T) *T {
+	return &v
 }
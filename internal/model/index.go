@@ -0,0 +1,11 @@
+package model
+
+// Index describes an index of the users DB collection.
+type Index struct {
+	Name string `json:"name"`
+	// Keys are the indexed fields in the index order.
+	Keys   []string `json:"keys"`
+	Unique bool     `json:"unique"`
+	// CaseInsensitive is set for the indexes with the case-insensitive collation.
+	CaseInsensitive bool `json:"case_insensitive,omitempty"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"errors"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// NormalizePhone parses the phone number in the international format e.g. "+44 20 7183 8750"
+// and returns it in the E.164 format e.g. "+442071838750". Error is returned for invalid numbers.
+func NormalizePhone(phone string) (string, error) {
+	// no default region - only the numbers with the country calling code are accepted
+	num, err := phonenumbers.Parse(phone, "")
+	if err != nil {
+		return "", err
+	}
+	if !phonenumbers.IsValidNumber(num) {
+		return "", errors.New("invalid phone number")
+	}
+	return phonenumbers.Format(num, phonenumbers.E164), nil
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_NormalizePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		phone   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "E.164",
+			phone: "+442071838750",
+			want:  "+442071838750",
+		},
+		{
+			name:  "formatted",
+			phone: "+44 (20) 7183-8750",
+			want:  "+442071838750",
+		},
+		{
+			name:    "missing country calling code",
+			phone:   "020 7183 8750",
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			phone:   "+44 20",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			phone:   "call me",
+			wantErr: true,
+		},
+		{
+			name:    "absent",
+			phone:   "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizePhone(tt.phone)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
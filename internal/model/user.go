@@ -11,9 +11,14 @@ type User struct {
 	FirstName string    `json:"first_name" bson:"first_name"`
 	LastName  string    `json:"last_name" bson:"last_name"`
 	Nickname  string    `json:"nickname" bson:"nickname"`
-	Password  string    `json:"password" bson:"password"`
+	Password  string    `json:"password,omitempty" bson:"password"`
 	Email     string    `json:"email" bson:"email"`
+	// Phone is optional, stored in the E.164 format.
+	Phone     string    `json:"phone,omitempty" bson:"phone,omitempty"`
 	Country   string    `json:"country" bson:"country"`
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// CreatedBy and UpdatedBy are the authenticated subjects that did the changes, empty for unauthenticated ones.
+	CreatedBy string `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
 }
@@ -1,20 +1,45 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"time"
+)
 
 type Action string
 
 const USER_CREATED Action = "created"
 const USER_UPDATED Action = "updated"
 const USER_DELETED Action = "deleted"
+const USERS_BULK_UPDATED Action = "bulk_updated"
 
 // UserEvent defines the event that is emitted by the service upon User data change.
 type UserEvent struct {
 	Action Action `json:"action"`
-	// UserData is either User for create/update or UserDeletedData for delete events.
+	// UserData is either User for create/update, UserDeletedData for delete or UsersBulkUpdatedData for bulk update events.
 	UserData any `json:"user_data"`
 }
 
+// OccurredAt returns the time of the user change, which is the user update time for create/update events.
+// The zero time is returned for the other events as their time is not tracked.
+func (e UserEvent) OccurredAt() time.Time {
+	if user, ok := e.UserData.(User); ok {
+		return user.UpdatedAt
+	}
+	return time.Time{}
+}
+
+// Key returns the ID of the changed user as the event key, nil for the events not related to a single user.
+func (e UserEvent) Key() []byte {
+	switch data := e.UserData.(type) {
+	case User:
+		return []byte(data.ID.String())
+	case UserDeletedData:
+		return []byte(data.UserID.String())
+	default:
+		return nil
+	}
+}
+
 type UserDeletedData struct {
 	UserID uuid.UUID `json:"id"`
 }
@@ -31,6 +56,10 @@ func NewUserDeletedEvent(userID uuid.UUID) UserEvent {
 	return newUserEvent(USER_DELETED, UserDeletedData{UserID: userID})
 }
 
+func NewUsersBulkUpdatedEvent(update BulkUpdate, modifiedCount int64) UserEvent {
+	return newUserEvent(USERS_BULK_UPDATED, UsersBulkUpdatedData{BulkUpdate: update, ModifiedCount: modifiedCount})
+}
+
 func newUserEvent(action Action, userData any) UserEvent {
 	return UserEvent{
 		Action:   action,
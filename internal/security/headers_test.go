@@ -0,0 +1,61 @@
+package security
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_HeadersMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     Headers
+		wantHeaders map[string]string
+	}{
+		{
+			name: "all headers",
+			headers: Headers{
+				FrameOptions:          "DENY",
+				ReferrerPolicy:        "no-referrer",
+				ContentSecurityPolicy: "default-src 'none'",
+				HSTSMaxAge:            365 * 24 * time.Hour,
+			},
+			wantHeaders: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "no-referrer",
+				"Content-Security-Policy":   "default-src 'none'",
+				"Strict-Transport-Security": "max-age=31536000",
+			},
+		},
+		{
+			name: "empty headers not sent",
+			wantHeaders: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "",
+				"Referrer-Policy":           "",
+				"Content-Security-Policy":   "",
+				"Strict-Transport-Security": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(HeadersMiddleware(tt.headers))
+			router.GET("/", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			for name, value := range tt.wantHeaders {
+				assert.Equal(t, value, w.Header().Get(name), name)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"user-service/internal/service/test_helpers"
+)
+
+func BenchmarkCreateUser(b *testing.B) {
+	svc := New(test_helpers.NewMemoryStorage(), test_helpers.NoopEventsProducer{})
+	users := test_helpers.SyntheticUsers("bench", 0, b.N)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := svc.CreateUser(context.Background(), users[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSeedUsers(b *testing.B) {
+	svc := New(test_helpers.NewMemoryStorage(), test_helpers.NoopEventsProducer{})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := test_helpers.SeedUsers(context.Background(), svc, 100, 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
+	"time"
+	custom_err "user-service/internal/errors"
 	"user-service/internal/model"
 )
 
@@ -25,22 +27,63 @@ func (m *StorageMock) CreateUser(ctx context.Context, user model.User) error {
 	return args.Error(0)
 }
 
+func (m *StorageMock) CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]custom_err.BatchItemError, error) {
+	args := m.Called(ctx, users, ordered)
+	failures, _ := args.Get(0).([]custom_err.BatchItemError)
+	return failures, args.Error(1)
+}
+
 func (m *StorageMock) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	args := m.Called(ctx, id)
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
+func (m *StorageMock) GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *StorageMock) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *StorageMock) GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error) {
 	args := m.Called(ctx, params)
 	return args.Get(0).([]model.User), args.Error(1)
 }
 
-func (m *StorageMock) UpdateUser(ctx context.Context, user model.User) (*model.User, error) {
-	args := m.Called(ctx, user)
+func (m *StorageMock) StreamUsers(ctx context.Context, params model.GetUsersParams, stream func(model.User) error) error {
+	args := m.Called(ctx, params, stream)
+	return args.Error(0)
+}
+
+func (m *StorageMock) ExportUsers(ctx context.Context, maxUsers int, includeHidden bool, export func(model.User) error) (bool, error) {
+	args := m.Called(ctx, maxUsers, includeHidden, export)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *StorageMock) UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) (*model.User, error) {
+	args := m.Called(ctx, user, expected)
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
+func (m *StorageMock) TouchUser(ctx context.Context, id uuid.UUID, updatedAt time.Time, updatedBy string) (*model.User, error) {
+	args := m.Called(ctx, id, updatedAt, updatedBy)
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *StorageMock) UpdateMany(ctx context.Context, filter model.FilterFields, set map[string]any) (int64, error) {
+	args := m.Called(ctx, filter, set)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *StorageMock) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
+
+// MatchesExpected compares the fields as the storage without any transformation of the stored fields does.
+func (m *StorageMock) MatchesExpected(user model.User, expected model.ExpectedFields) bool {
+	return expected.Match(user)
+}
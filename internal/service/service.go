@@ -3,50 +3,165 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"time"
+	"user-service/internal/auth"
 	custom_err "user-service/internal/errors"
 	"user-service/internal/model"
 )
 
 type UsersStorage interface {
 	CreateUser(ctx context.Context, user model.User) error
+	CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]custom_err.BatchItemError, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error)
+	Exists(ctx context.Context, id uuid.UUID) (bool, error)
 	GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error)
-	UpdateUser(ctx context.Context, user model.User) (*model.User, error)
+	StreamUsers(ctx context.Context, params model.GetUsersParams, stream func(model.User) error) error
+	ExportUsers(ctx context.Context, maxUsers int, includeHidden bool, export func(model.User) error) (bool, error)
+	UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) (*model.User, error)
+	TouchUser(ctx context.Context, id uuid.UUID, updatedAt time.Time, updatedBy string) (*model.User, error)
+	UpdateMany(ctx context.Context, filter model.FilterFields, set map[string]any) (int64, error)
 	DeleteUser(ctx context.Context, id uuid.UUID) error
+	// MatchesExpected returns true if the read user matches the expected field values. The read user fields can be stored
+	// transformed e.g. the hashed emails, so they are compared by the storage.
+	MatchesExpected(user model.User, expected model.ExpectedFields) bool
 }
 
 type EventsProducer interface {
 	Produce(event any) error
 }
 
+// EventsOrdering defines whether the user events are produced after or before the DB write.
+type EventsOrdering string
+
+const (
+	// EventsAfterCommit produces the event only once the DB write succeeded, so consumers never see
+	// changes that were not persisted. Delivery is best effort - produce failures are only logged.
+	EventsAfterCommit EventsOrdering = "after_commit"
+	// EventsBeforeCommit produces the event before the DB write, so consumers can e.g. pre-reserve resources.
+	// If the DB write fails afterward the event was already produced for a change that didn't happen.
+	EventsBeforeCommit EventsOrdering = "before_commit"
+)
+
+// Clock provides the current time used for the user timestamps.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+type Opt func(*Service)
+
+// WithEventsOrdering sets whether the events are produced after (default) or before the DB write.
+func WithEventsOrdering(ordering EventsOrdering) Opt {
+	return func(s *Service) {
+		s.eventsOrdering = ordering
+	}
+}
+
+// WithClock sets the clock the user timestamps are taken from, the real time is used by default.
+func WithClock(clock Clock) Opt {
+	return func(s *Service) {
+		s.clock = clock
+	}
+}
+
+// WithTimestampPrecision sets the precision the user timestamps are truncated to, milliseconds by default
+// as MongoDB doesn't store more. time.Nanosecond keeps the full precision.
+func WithTimestampPrecision(precision time.Duration) Opt {
+	return func(s *Service) {
+		s.timestampPrecision = precision
+	}
+}
+
+// WithClientTimestamps keeps the timestamps of the created users when they are set e.g. for migrations.
+// The timestamps are always set by the service by default.
+func WithClientTimestamps() Opt {
+	return func(s *Service) {
+		s.clientTimestamps = true
+	}
+}
+
+// WithReadAfterCreate reads the created user back from DB, so the returned user and the event match the persisted state
+// even if the DB transforms it. It costs an extra read, the created user is returned without it by default.
+func WithReadAfterCreate() Opt {
+	return func(s *Service) {
+		s.readAfterCreate = true
+	}
+}
+
+// WithImmutableFields rejects the updates changing any of the given user fields with a conflict, e.g. the email
+// that has to be changed by its verification flow. The stored user is read before each update to compare the fields.
+func WithImmutableFields(fields ...string) Opt {
+	return func(s *Service) {
+		s.immutableFields = fields
+	}
+}
+
 type Service struct {
 	storage        UsersStorage
 	eventsProducer EventsProducer
+	eventsOrdering EventsOrdering
+	clock          Clock
+	// timestampPrecision is the precision the user timestamps are truncated to
+	timestampPrecision time.Duration
+	// clientTimestamps keeps the timestamps of the created user if set
+	clientTimestamps bool
+	readAfterCreate  bool
+	// immutableFields are the user fields the update can't change
+	immutableFields []string
 }
 
-func New(storage UsersStorage, eventsProducer EventsProducer) *Service {
-	return &Service{
+func New(storage UsersStorage, eventsProducer EventsProducer, opts ...Opt) *Service {
+	s := &Service{
 		storage:        storage,
 		eventsProducer: eventsProducer,
+		eventsOrdering: EventsAfterCommit,
+		clock:          realClock{},
+		// db precision is in millis - doesn't support nanos
+		timestampPrecision: time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
+}
+
+// now returns the current time for the user timestamps. The timestamps are always in UTC to not depend
+// on the server time zone.
+func (s Service) now() time.Time {
+	return s.truncate(s.clock.Now())
 }
 
-// CreateUser creates the User in DB and produces user created event.
+// truncate converts the timestamp to UTC with the configured precision.
+func (s Service) truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(s.timestampPrecision)
+}
+
+// CreateUser creates the User in DB and produces user created event according to the events ordering.
+// In dry run the user to be created is returned without being persisted, the event is only captured.
 func (s Service) CreateUser(ctx context.Context, user model.User) (*model.User, error) {
-	newID, err := uuid.NewUUID()
+	user, err := s.newUser(ctx, user)
 	if err != nil {
-		logrus.WithError(err).Error("failed to create UUID for new user")
 		return nil, err
 	}
+	if model.IsDryRun(ctx) {
+		model.CaptureEvent(ctx, model.NewUserCreatedEvent(user))
+		return &user, nil
+	}
 
-	user.ID = newID
-	// db precision is in millis - doesn't support nanos
-	now := time.Now().Truncate(time.Millisecond)
-	user.CreatedAt = now
-	user.UpdatedAt = now
+	if s.eventsOrdering == EventsBeforeCommit {
+		s.produceEvent(ctx, model.NewUserCreatedEvent(user), user.ID, "failed to produce create user event")
+	}
 
 	if err = s.storage.CreateUser(ctx, user); err != nil {
 		logrus.WithError(err).
@@ -55,15 +170,87 @@ func (s Service) CreateUser(ctx context.Context, user model.User) (*model.User,
 		return nil, err
 	}
 
-	err = s.eventsProducer.Produce(model.NewUserCreatedEvent(user))
+	if s.readAfterCreate {
+		stored, err := s.storage.GetUserByID(ctx, user.ID)
+		if err != nil {
+			// the user is created, so don't fail the caller - fall back to the user as it was sent to DB
+			logrus.WithError(err).
+				WithField("user_id", user.ID).
+				Error("failed to read created user")
+		} else {
+			user = *stored
+		}
+	}
+
+	if s.eventsOrdering == EventsAfterCommit {
+		s.produceEvent(ctx, model.NewUserCreatedEvent(user), user.ID, "failed to produce create user event")
+	}
+
+	return &user, nil
+}
+
+// CreateUsers creates the Users in DB in a single batch and produces user created event for each of them according
+// to the events ordering. The users are returned in the batch order, the failed ones are reported by their batch index
+// and no event is produced for them after the commit.
+func (s Service) CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]model.User, []custom_err.BatchItemError, error) {
+	created := make([]model.User, 0, len(users))
+	for _, user := range users {
+		user, err := s.newUser(ctx, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		created = append(created, user)
+	}
+
+	if s.eventsOrdering == EventsBeforeCommit {
+		for _, user := range created {
+			s.produceEvent(ctx, model.NewUserCreatedEvent(user), user.ID, "failed to produce create user event")
+		}
+	}
+
+	failures, err := s.storage.CreateUsers(ctx, created, ordered)
 	if err != nil {
-		// just log but return no error as this is just internal action that does not interest the caller of the func.
 		logrus.WithError(err).
-			WithField("user_id", user.ID).
-			Error("failed to produce create user event")
+			WithField("users", len(created)).
+			Error("failed to create users")
+		return nil, nil, err
 	}
 
-	return &user, nil
+	if s.eventsOrdering == EventsAfterCommit {
+		failed := make(map[int]struct{}, len(failures))
+		for _, f := range failures {
+			failed[f.Index] = struct{}{}
+		}
+		for i, user := range created {
+			if _, ok := failed[i]; !ok {
+				s.produceEvent(ctx, model.NewUserCreatedEvent(user), user.ID, "failed to produce create user event")
+			}
+		}
+	}
+
+	return created, failures, nil
+}
+
+// newUser returns the user to be created with new ID, the timestamps and the creator set.
+func (s Service) newUser(ctx context.Context, user model.User) (model.User, error) {
+	newID, err := uuid.NewUUID()
+	if err != nil {
+		logrus.WithError(err).Error("failed to create UUID for new user")
+		return model.User{}, err
+	}
+
+	user.ID = newID
+	if s.clientTimestamps && !user.CreatedAt.IsZero() {
+		user.CreatedAt = s.truncate(user.CreatedAt)
+		user.UpdatedAt = s.truncate(user.UpdatedAt)
+	} else {
+		now := s.now()
+		user.CreatedAt = now
+		user.UpdatedAt = now
+	}
+	user.CreatedBy = auth.SubjectFromContext(ctx)
+	user.UpdatedBy = user.CreatedBy
+	return user, nil
 }
 
 // GetUserByID retrieves the user from DB based on the provided id.
@@ -82,6 +269,22 @@ func (s Service) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, er
 	return user, nil
 }
 
+// GetUserProfile retrieves the user from DB based on the provided id, never with the password.
+func (s Service) GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	user, err := s.storage.GetUserProfile(ctx, id)
+	if err != nil {
+		if !errors.Is(err, custom_err.NotFoundError) {
+			logrus.WithError(err).
+				WithField("user_id", id).
+				Error("failed to get user profile")
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
 // GetUsers retrieves the users from DB based on passed params.
 func (s Service) GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error) {
 	users, err := s.storage.GetUsers(ctx, params)
@@ -93,20 +296,86 @@ func (s Service) GetUsers(ctx context.Context, params model.GetUsersParams) ([]m
 	return users, nil
 }
 
-// UpdateUser updates the User in DB and produces user updated event.
-func (s Service) UpdateUser(ctx context.Context, user model.User) error {
-	// db precision is in millis - doesn't support nanos
-	user.UpdatedAt = time.Now().Truncate(time.Millisecond)
+// StreamUsers passes the users retrieved from DB based on passed params to the stream function one by one.
+func (s Service) StreamUsers(ctx context.Context, params model.GetUsersParams, stream func(model.User) error) error {
+	var streamErr error
+	err := s.storage.StreamUsers(ctx, params, func(user model.User) error {
+		streamErr = stream(user)
+		return streamErr
+	})
+	if err != nil {
+		// the stream function failures are handled by the caller
+		if streamErr == nil || !errors.Is(err, streamErr) {
+			logrus.WithError(err).Error("failed to stream users")
+		}
+		return err
+	}
+
+	return nil
+}
 
-	updated, err := s.storage.UpdateUser(ctx, user)
+// ExportUsers passes all the users from DB to the export function, but at most maxUsers of them.
+// The hidden users are exported only if includeHidden is set.
+// Returns true if the export was truncated.
+func (s Service) ExportUsers(ctx context.Context, maxUsers int, includeHidden bool, export func(model.User) error) (bool, error) {
+	var exportErr error
+	truncated, err := s.storage.ExportUsers(ctx, maxUsers, includeHidden, func(user model.User) error {
+		exportErr = export(user)
+		return exportErr
+	})
 	if err != nil {
-		var unmarshallErr custom_err.ResponseUnmarshallError
+		// the export function failures are handled by the caller e.g. stopping the export on purpose
+		if exportErr == nil || !errors.Is(err, exportErr) {
+			logrus.WithError(err).Error("failed to export users")
+		}
+		return false, err
+	}
+
+	return truncated, nil
+}
+
+// UpdateUser updates the User in DB and produces user updated event according to the events ordering.
+// No event is produced if the user doesn't exist. In dry run only the existence and the expected fields are checked.
+func (s Service) UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) error {
+	user.UpdatedAt = s.now()
+	// the creator is not updated
+	user.CreatedBy = ""
+	user.UpdatedBy = auth.SubjectFromContext(ctx)
+
+	if model.IsDryRun(ctx) {
+		return s.dryRunUpdate(ctx, user, expected)
+	}
+
+	if s.eventsOrdering == EventsBeforeCommit || len(s.immutableFields) > 0 {
+		// read the stored user to not produce event for non-existing user, to fill the fields that are not updated
+		// and to compare the immutable fields
+		stored, err := s.GetUserByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if expected, err = s.guardImmutableFields(*stored, user, expected); err != nil {
+			return err
+		}
+		if s.eventsOrdering == EventsBeforeCommit {
+			// checked before producing the event, so no event is produced for the update the storage would reject
+			if !s.storage.MatchesExpected(*stored, expected) {
+				return custom_err.PreconditionFailedError
+			}
+			s.produceEvent(ctx, model.NewUserUpdatedEvent(updatedByStored(user, *stored)), user.ID, "failed to produce update user event")
+		}
+	}
+
+	updated, err := s.storage.UpdateUser(ctx, user, expected)
+	if err != nil {
+		var unmarshallErr *custom_err.ResponseUnmarshallError
 		if errors.As(err, &unmarshallErr) {
 			// edge case - the User in the DB is updated but the DB response marshall failed.
 			// Log the error but notify other systems about the change and don't fail as it was success from the caller POV.
 			logrus.WithError(err).
 				WithField("user_id", user.ID).
 				Error("failed to unmarshall DB response")
+			// the stored user is unknown, the event carries the written fields instead
+			updated = &user
 		} else {
 			logrus.WithError(err).
 				WithField("user_id", user.ID).
@@ -115,19 +384,98 @@ func (s Service) UpdateUser(ctx context.Context, user model.User) error {
 		}
 	}
 
-	err = s.eventsProducer.Produce(model.NewUserUpdatedEvent(*updated))
+	if s.eventsOrdering == EventsAfterCommit {
+		s.produceEvent(ctx, model.NewUserUpdatedEvent(*updated), user.ID, "failed to produce update user event")
+	}
+
+	return nil
+}
+
+// TouchUser bumps the user update time without changing its data e.g. to re-trigger the delta sync of the consumers.
+// Produces user updated event according to the events ordering, no event is produced if the user doesn't exist.
+func (s Service) TouchUser(ctx context.Context, id uuid.UUID) error {
+	now := s.now()
+	updatedBy := auth.SubjectFromContext(ctx)
+
+	if s.eventsOrdering == EventsBeforeCommit {
+		stored, err := s.GetUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		stored.UpdatedAt = now
+		stored.UpdatedBy = updatedBy
+		s.produceEvent(ctx, model.NewUserUpdatedEvent(*stored), id, "failed to produce update user event")
+	}
+
+	touched, err := s.storage.TouchUser(ctx, id, now, updatedBy)
 	if err != nil {
-		// just log but return no error as this is just internal action that does not interest the caller of the func.
+		var unmarshallErr *custom_err.ResponseUnmarshallError
+		if !errors.As(err, &unmarshallErr) {
+			logrus.WithError(err).
+				WithField("user_id", id).
+				Error("failed to touch user")
+			return err
+		}
+		// the user is touched, only the DB response failed - the event can't carry the user data then
 		logrus.WithError(err).
-			WithField("user_id", user.ID.String()).
-			Error("failed to produce update user event")
+			WithField("user_id", id).
+			Error("failed to unmarshall DB response, no user updated event produced")
+		return nil
+	}
+
+	if s.eventsOrdering == EventsAfterCommit {
+		s.produceEvent(ctx, model.NewUserUpdatedEvent(*touched), id, "failed to produce update user event")
 	}
 
 	return nil
 }
 
-// DeleteUser deletes the User in DB and produces user deleted event.
+// BulkUpdateUsers sets the fields of all the users matching the filter and returns the number of modified users.
+// A single bulk updated event is produced after the DB write instead of the user updated events, if any user was modified.
+func (s Service) BulkUpdateUsers(ctx context.Context, update model.BulkUpdate) (int64, error) {
+	set := map[string]any{
+		"updated_at": s.now(),
+		"updated_by": auth.SubjectFromContext(ctx),
+	}
+	for field, value := range update.Set {
+		set[field] = value
+	}
+
+	modified, err := s.storage.UpdateMany(ctx, update.Filter, set)
+	if err != nil {
+		logrus.WithError(err).Error("failed to bulk update users")
+		return 0, err
+	}
+
+	if modified > 0 {
+		s.produceEvent(ctx, model.NewUsersBulkUpdatedEvent(update, modified), uuid.Nil, "failed to produce bulk update users event")
+	}
+
+	return modified, nil
+}
+
+// DeleteUser deletes the User in DB and produces user deleted event according to the events ordering.
+// No event is produced if nothing was deleted. In dry run only the existence is checked.
 func (s Service) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if model.IsDryRun(ctx) {
+		return s.dryRunDelete(ctx, id)
+	}
+
+	if s.eventsOrdering == EventsBeforeCommit {
+		// check the user exists to not produce event when there is nothing to delete
+		exists, err := s.storage.Exists(ctx, id)
+		if err != nil {
+			logrus.WithError(err).
+				WithField("user_id", id).
+				Error("failed to check user existence")
+			return err
+		}
+		if !exists {
+			return custom_err.NotFoundError
+		}
+		s.produceEvent(ctx, model.NewUserDeletedEvent(id), id, "failed to produce delete user event")
+	}
+
 	err := s.storage.DeleteUser(ctx, id)
 	if err != nil {
 		logrus.WithError(err).
@@ -136,13 +484,99 @@ func (s Service) DeleteUser(ctx context.Context, id uuid.UUID) error {
 		return err
 	}
 
-	err = s.eventsProducer.Produce(model.NewUserDeletedEvent(id))
+	if s.eventsOrdering == EventsAfterCommit {
+		s.produceEvent(ctx, model.NewUserDeletedEvent(id), id, "failed to produce delete user event")
+	}
+
+	return nil
+}
+
+// dryRunUpdate checks the user exists and matches the expected fields, capturing the event the update would produce.
+func (s Service) dryRunUpdate(ctx context.Context, user model.User, expected model.ExpectedFields) error {
+	stored, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !s.storage.MatchesExpected(*stored, expected) {
+		return custom_err.PreconditionFailedError
+	}
+	if _, err := s.guardImmutableFields(*stored, user, expected); err != nil {
+		return err
+	}
+
+	model.CaptureEvent(ctx, model.NewUserUpdatedEvent(updatedByStored(user, *stored)))
+	return nil
+}
+
+// updatedByStored returns the updated user with the fields the update doesn't change taken from the stored one.
+func updatedByStored(user, stored model.User) model.User {
+	user.CreatedAt = stored.CreatedAt
+	user.CreatedBy = stored.CreatedBy
+	// the omitted email is kept by the storage
+	if user.Email == "" {
+		user.Email = stored.Email
+	}
+	return user
+}
+
+// guardImmutableFields returns a conflict error if the update changes any immutable field of the stored user.
+// The unchanged values of the immutable fields are added to the expected ones, so the update fails with precondition
+// failed if they are changed concurrently after the read. The values are compared by the storage as they can be
+// stored transformed e.g. the hashed emails.
+func (s Service) guardImmutableFields(stored, user model.User, expected model.ExpectedFields) (model.ExpectedFields, error) {
+	if len(s.immutableFields) == 0 {
+		return expected, nil
+	}
+
+	immutable := model.ExpectedFieldsOf(user, s.immutableFields...)
+	if user.Email == "" {
+		// the omitted email is kept by the storage, so it is not changed
+		delete(immutable, "email")
+	}
+	for _, field := range s.immutableFields {
+		if _, ok := immutable[field]; !ok {
+			continue
+		}
+		if !s.storage.MatchesExpected(stored, model.ExpectedFields{field: immutable[field]}) {
+			return nil, custom_err.NewConflictError(fmt.Sprintf("%s cannot be changed by update, it has to be changed by its dedicated flow", field))
+		}
+	}
+
+	guarded := make(model.ExpectedFields, len(expected)+len(immutable))
+	for field, value := range immutable {
+		guarded[field] = value
+	}
+	// the values expected by the client are kept, so their mismatch still fails the update
+	for field, value := range expected {
+		guarded[field] = value
+	}
+	return guarded, nil
+}
+
+// dryRunDelete checks the user exists, capturing the event the deletion would produce.
+func (s Service) dryRunDelete(ctx context.Context, id uuid.UUID) error {
+	exists, err := s.storage.Exists(ctx, id)
 	if err != nil {
-		// just log but return no error as this is just internal action that does not interest the caller of the func.
 		logrus.WithError(err).
 			WithField("user_id", id).
-			Error("failed to produce delete user event")
+			Error("failed to check user existence")
+		return err
+	}
+	if !exists {
+		return custom_err.NotFoundError
 	}
 
+	model.CaptureEvent(ctx, model.NewUserDeletedEvent(id))
 	return nil
 }
+
+func (s Service) produceEvent(ctx context.Context, event model.UserEvent, userID uuid.UUID, failureMsg string) {
+	model.CaptureEvent(ctx, event)
+	err := s.eventsProducer.Produce(event)
+	if err != nil {
+		// just log but return no error as this is just internal action that does not interest the caller of the func.
+		logrus.WithError(err).
+			WithField("user_id", userID).
+			Error(failureMsg)
+	}
+}
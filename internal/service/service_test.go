@@ -7,6 +7,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
+	"user-service/internal/auth"
+	custom_err "user-service/internal/errors"
 	"user-service/internal/model"
 )
 
@@ -94,6 +97,491 @@ func Test_CreateUser(t *testing.T) {
 	}
 }
 
+func Test_DeleteUser(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name                   string
+		ordering               EventsOrdering
+		userExists             bool
+		wantError              error
+		wantEventPublishCalled bool
+	}{
+		{
+			name:                   "after commit - deleted user produces event",
+			ordering:               EventsAfterCommit,
+			userExists:             true,
+			wantEventPublishCalled: true,
+		},
+		{
+			name:      "after commit - no delete, no event",
+			ordering:  EventsAfterCommit,
+			wantError: custom_err.NotFoundError,
+		},
+		{
+			name:                   "before commit - deleted user produces event",
+			ordering:               EventsBeforeCommit,
+			userExists:             true,
+			wantEventPublishCalled: true,
+		},
+		{
+			name:      "before commit - no delete, no event",
+			ordering:  EventsBeforeCommit,
+			wantError: custom_err.NotFoundError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+
+			ctx := context.Background()
+			svc := New(storageMock, eventsMock, WithEventsOrdering(tt.ordering))
+
+			if tt.userExists {
+				if tt.ordering == EventsBeforeCommit {
+					storageMock.On("Exists", ctx, userID).Return(true, nil)
+				}
+				storageMock.On("DeleteUser", ctx, userID).Return(nil)
+			} else {
+				if tt.ordering == EventsBeforeCommit {
+					storageMock.On("Exists", ctx, userID).Return(false, nil)
+				} else {
+					storageMock.On("DeleteUser", ctx, userID).Return(custom_err.NotFoundError)
+				}
+			}
+			if tt.wantEventPublishCalled {
+				eventsMock.On("Produce", model.NewUserDeletedEvent(userID)).Return(nil)
+			}
+
+			err := svc.DeleteUser(ctx, userID)
+
+			assert.ErrorIs(t, err, tt.wantError)
+			storageMock.AssertExpectations(t)
+			eventsMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_CreateUser_EventsOrdering(t *testing.T) {
+	user := model.User{
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+	}
+
+	tests := []struct {
+		name      string
+		ordering  EventsOrdering
+		dbError   error
+		wantCalls []string
+	}{
+		{
+			name:      "after commit",
+			ordering:  EventsAfterCommit,
+			wantCalls: []string{"CreateUser", "Produce"},
+		},
+		{
+			name:      "after commit - DB failure produces no event",
+			ordering:  EventsAfterCommit,
+			dbError:   errors.New("DB error"),
+			wantCalls: []string{"CreateUser"},
+		},
+		{
+			name:      "before commit",
+			ordering:  EventsBeforeCommit,
+			wantCalls: []string{"Produce", "CreateUser"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+
+			ctx := context.Background()
+			svc := New(storageMock, eventsMock, WithEventsOrdering(tt.ordering))
+
+			var calls []string
+			storageMock.On("CreateUser", ctx, mock.MatchedBy(userCreationMatchFunc(user))).
+				Run(func(_ mock.Arguments) { calls = append(calls, "CreateUser") }).
+				Return(tt.dbError)
+			eventsMock.On("Produce", mock.MatchedBy(userCreationEventMatchFunc(user))).
+				Run(func(_ mock.Arguments) { calls = append(calls, "Produce") }).
+				Return(nil).Maybe()
+
+			_, err := svc.CreateUser(ctx, user)
+
+			assert.Equal(t, tt.dbError, err)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func Test_Attribution(t *testing.T) {
+	userID := uuid.New()
+	user := model.User{
+		ID:        userID,
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+		// client provided values have to be ignored
+		CreatedBy: "client",
+		UpdatedBy: "client",
+	}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		wantCreatedBy string
+		wantUpdatedBy string
+	}{
+		{
+			name:          "subject in context",
+			ctx:           auth.ContextWithSubject(context.Background(), "admin"),
+			wantCreatedBy: "admin",
+			wantUpdatedBy: "admin",
+		},
+		{
+			name: "no subject in context",
+			ctx:  context.Background(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" - create", func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock)
+
+			storageMock.On("CreateUser", tt.ctx, mock.MatchedBy(func(u model.User) bool {
+				return u.CreatedBy == tt.wantCreatedBy && u.UpdatedBy == tt.wantUpdatedBy
+			})).Return(nil)
+			eventsMock.On("Produce", mock.Anything).Return(nil)
+
+			got, err := svc.CreateUser(tt.ctx, user)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCreatedBy, got.CreatedBy)
+			assert.Equal(t, tt.wantUpdatedBy, got.UpdatedBy)
+			storageMock.AssertExpectations(t)
+		})
+		t.Run(tt.name+" - update", func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock)
+
+			storageMock.On("UpdateUser", tt.ctx, mock.MatchedBy(func(u model.User) bool {
+				return u.CreatedBy == "" && u.UpdatedBy == tt.wantUpdatedBy
+			}), model.ExpectedFields(nil)).Return(&user, nil)
+			eventsMock.On("Produce", mock.Anything).Return(nil)
+
+			err := svc.UpdateUser(tt.ctx, user, nil)
+
+			assert.NoError(t, err)
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func Test_Clock(t *testing.T) {
+	now := time.Date(2024, 7, 13, 9, 19, 54, 625_123_456, time.UTC)
+	// db precision is in millis
+	wantTime := time.Date(2024, 7, 13, 9, 19, 54, 625_000_000, time.UTC)
+	user := model.User{
+		ID:        uuid.New(),
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+	}
+
+	t.Run("create", func(t *testing.T) {
+		storageMock := new(StorageMock)
+		eventsMock := new(EventsProducerMock)
+		svc := New(storageMock, eventsMock, WithClock(fixedClock(now)))
+
+		storageMock.On("CreateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+			return u.CreatedAt.Equal(wantTime) && u.UpdatedAt.Equal(wantTime)
+		})).Return(nil)
+		eventsMock.On("Produce", mock.MatchedBy(func(event any) bool {
+			e := event.(model.UserEvent)
+			u := e.UserData.(model.User)
+			return u.CreatedAt.Equal(wantTime) && u.UpdatedAt.Equal(wantTime)
+		})).Return(nil)
+
+		got, err := svc.CreateUser(context.Background(), user)
+
+		assert.NoError(t, err)
+		assert.Equal(t, wantTime, got.CreatedAt)
+		assert.Equal(t, wantTime, got.UpdatedAt)
+		storageMock.AssertExpectations(t)
+		eventsMock.AssertExpectations(t)
+	})
+	t.Run("update", func(t *testing.T) {
+		storageMock := new(StorageMock)
+		eventsMock := new(EventsProducerMock)
+		svc := New(storageMock, eventsMock, WithClock(fixedClock(now)))
+
+		storageMock.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+			return u.UpdatedAt.Equal(wantTime)
+		}), model.ExpectedFields(nil)).Return(&user, nil)
+		eventsMock.On("Produce", mock.Anything).Return(nil)
+
+		err := svc.UpdateUser(context.Background(), user, nil)
+
+		assert.NoError(t, err)
+		storageMock.AssertExpectations(t)
+	})
+}
+
+func Test_TimestampPrecision(t *testing.T) {
+	now := time.Date(2024, 7, 13, 9, 19, 54, 625_123_456, time.UTC)
+	user := model.User{
+		ID:        uuid.New(),
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Opt
+		wantTime time.Time
+	}{
+		{
+			name:     "millis by default",
+			wantTime: time.Date(2024, 7, 13, 9, 19, 54, 625_000_000, time.UTC),
+		},
+		{
+			name:     "nanos",
+			opts:     []Opt{WithTimestampPrecision(time.Nanosecond)},
+			wantTime: now,
+		},
+		{
+			name:     "seconds",
+			opts:     []Opt{WithTimestampPrecision(time.Second)},
+			wantTime: time.Date(2024, 7, 13, 9, 19, 54, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" create", func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock, append(tt.opts, WithClock(fixedClock(now)))...)
+
+			storageMock.On("CreateUser", mock.Anything, mock.Anything).Return(nil)
+			eventsMock.On("Produce", mock.Anything).Return(nil)
+
+			got, err := svc.CreateUser(context.Background(), user)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTime, got.CreatedAt)
+			assert.Equal(t, tt.wantTime, got.UpdatedAt)
+		})
+		t.Run(tt.name+" update", func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock, append(tt.opts, WithClock(fixedClock(now)))...)
+
+			storageMock.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+				return u.UpdatedAt == tt.wantTime
+			}), model.ExpectedFields(nil)).Return(&user, nil)
+			eventsMock.On("Produce", mock.Anything).Return(nil)
+
+			err := svc.UpdateUser(context.Background(), user, nil)
+
+			assert.NoError(t, err)
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_Clock_UTC(t *testing.T) {
+	// the server time zone must not leak to the stored and emitted timestamps
+	now := time.Date(2024, 7, 13, 11, 19, 54, 0, time.FixedZone("CEST", 2*60*60))
+	user := model.User{
+		ID:        uuid.New(),
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+	}
+
+	t.Run("create", func(t *testing.T) {
+		storageMock := new(StorageMock)
+		eventsMock := new(EventsProducerMock)
+		svc := New(storageMock, eventsMock, WithClock(fixedClock(now)))
+
+		storageMock.On("CreateUser", mock.Anything, mock.Anything).Return(nil)
+		eventsMock.On("Produce", mock.Anything).Return(nil)
+
+		got, err := svc.CreateUser(context.Background(), user)
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.UTC, got.CreatedAt.Location())
+		assert.Equal(t, time.UTC, got.UpdatedAt.Location())
+		assert.True(t, got.CreatedAt.Equal(now))
+	})
+	t.Run("update", func(t *testing.T) {
+		storageMock := new(StorageMock)
+		eventsMock := new(EventsProducerMock)
+		svc := New(storageMock, eventsMock, WithClock(fixedClock(now)))
+
+		storageMock.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+			return u.UpdatedAt.Location() == time.UTC && u.UpdatedAt.Equal(now)
+		}), model.ExpectedFields(nil)).Return(&user, nil)
+		eventsMock.On("Produce", mock.Anything).Return(nil)
+
+		err := svc.UpdateUser(context.Background(), user, nil)
+
+		assert.NoError(t, err)
+		storageMock.AssertExpectations(t)
+	})
+}
+
+func Test_CreateUser_ClientTimestamps(t *testing.T) {
+	now := time.Date(2024, 7, 13, 9, 0, 0, 0, time.UTC)
+	imported := time.Date(2020, 1, 2, 3, 4, 5, 6_000_007, time.UTC)
+	user := model.User{
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+		CreatedAt: imported,
+		UpdatedAt: imported,
+	}
+	withoutTimestamps := user
+	withoutTimestamps.CreatedAt = time.Time{}
+	withoutTimestamps.UpdatedAt = time.Time{}
+
+	tests := []struct {
+		name     string
+		opts     []Opt
+		user     model.User
+		wantTime time.Time
+	}{
+		{
+			name:     "ignored by default",
+			user:     user,
+			wantTime: now,
+		},
+		{
+			name:     "kept when allowed",
+			opts:     []Opt{WithClientTimestamps()},
+			user:     user,
+			wantTime: imported.Truncate(time.Millisecond),
+		},
+		{
+			name:     "set when allowed but not provided",
+			opts:     []Opt{WithClientTimestamps()},
+			user:     withoutTimestamps,
+			wantTime: now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock, append(tt.opts, WithClock(fixedClock(now)))...)
+
+			storageMock.On("CreateUser", mock.Anything, mock.Anything).Return(nil)
+			eventsMock.On("Produce", mock.Anything).Return(nil)
+
+			got, err := svc.CreateUser(context.Background(), tt.user)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTime, got.CreatedAt)
+			assert.Equal(t, tt.wantTime, got.UpdatedAt)
+		})
+	}
+}
+
+func Test_CreateUser_ReadAfterCreate(t *testing.T) {
+	user := model.User{
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "Valid@gmail.com",
+	}
+	// e.g. normalized by DB
+	stored := user
+	stored.Email = "valid@gmail.com"
+
+	tests := []struct {
+		name      string
+		opts      []Opt
+		readErr   error
+		wantRead  bool
+		wantEmail string
+	}{
+		{
+			name:      "no read by default",
+			wantEmail: "Valid@gmail.com",
+		},
+		{
+			name:      "read after create",
+			opts:      []Opt{WithReadAfterCreate()},
+			wantRead:  true,
+			wantEmail: "valid@gmail.com",
+		},
+		{
+			name:      "read failure falls back to the created user",
+			opts:      []Opt{WithReadAfterCreate()},
+			readErr:   errors.New("DB error"),
+			wantRead:  true,
+			wantEmail: "Valid@gmail.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock, tt.opts...)
+
+			storageMock.On("CreateUser", mock.Anything, mock.Anything).Return(nil)
+			if tt.wantRead {
+				var readUser *model.User
+				if tt.readErr == nil {
+					readUser = &stored
+				}
+				storageMock.On("GetUserByID", mock.Anything, mock.Anything).Return(readUser, tt.readErr)
+			}
+			eventsMock.On("Produce", mock.MatchedBy(func(event any) bool {
+				return event.(model.UserEvent).UserData.(model.User).Email == tt.wantEmail
+			})).Return(nil)
+
+			got, err := svc.CreateUser(context.Background(), user)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantEmail, got.Email)
+			storageMock.AssertExpectations(t)
+			eventsMock.AssertExpectations(t)
+		})
+	}
+}
+
 // userCreationMatchFunc matches user from CREATE request with the created one.
 func userCreationMatchFunc(userToCreate model.User) func(gotUser model.User) bool {
 	return func(gotUser model.User) bool {
@@ -123,3 +611,312 @@ func userCreationEventMatchFunc(userToCreate model.User) func(event any) bool {
 		return userCreationMatchFunc(userToCreate)(gotUser)
 	}
 }
+
+func Test_UpdateUser_ResponseUnmarshallError(t *testing.T) {
+	user := model.User{
+		ID:        uuid.New(),
+		FirstName: "valid",
+		LastName:  "valid",
+		Nickname:  "valid",
+		Password:  "valid",
+		Country:   "valid",
+		Email:     "valid@gmail.com",
+	}
+	storageMock := new(StorageMock)
+	eventsMock := new(EventsProducerMock)
+	svc := New(storageMock, eventsMock)
+
+	// the user is updated in the DB, only the response can't be read
+	storageMock.On("UpdateUser", mock.Anything, mock.Anything, model.ExpectedFields(nil)).
+		Return((*model.User)(nil), custom_err.NewResponseUnmarshallError(errors.New("bad bson")))
+	eventsMock.On("Produce", mock.MatchedBy(func(event any) bool {
+		u := event.(model.UserEvent).UserData.(model.User)
+		return u.ID == user.ID && u.FirstName == user.FirstName
+	})).Return(nil)
+
+	err := svc.UpdateUser(context.Background(), user, nil)
+
+	assert.NoError(t, err)
+	storageMock.AssertExpectations(t)
+	eventsMock.AssertExpectations(t)
+}
+
+func Test_UpdateUser_EventsBeforeCommitPreconditionFailed(t *testing.T) {
+	stored := model.User{
+		ID:        uuid.New(),
+		FirstName: "anna",
+		LastName:  "smith",
+		Nickname:  "ann",
+		Password:  "pwd",
+		Country:   "UK",
+		Email:     "ann@gmail.com",
+	}
+	storageMock := new(StorageMock)
+	eventsMock := new(EventsProducerMock)
+	svc := New(storageMock, eventsMock, WithEventsOrdering(EventsBeforeCommit))
+	storageMock.On("GetUserByID", mock.Anything, stored.ID).Return(&stored, nil)
+	user := stored
+	user.Country = "GB"
+
+	err := svc.UpdateUser(context.Background(), user, model.ExpectedFields{"country": "DE"})
+
+	assert.ErrorIs(t, err, custom_err.PreconditionFailedError)
+	storageMock.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	eventsMock.AssertNotCalled(t, "Produce", mock.Anything)
+}
+
+func Test_UpdateUser_ImmutableFields(t *testing.T) {
+	stored := model.User{
+		ID:        uuid.New(),
+		FirstName: "anna",
+		LastName:  "smith",
+		Nickname:  "ann",
+		Password:  "pwd",
+		Country:   "UK",
+		Email:     "ann@gmail.com",
+	}
+
+	tests := []struct {
+		name         string
+		update       func(u *model.User)
+		expected     model.ExpectedFields
+		wantExpected model.ExpectedFields
+		wantErr      string
+	}{
+		{
+			name:    "email change is blocked",
+			update:  func(u *model.User) { u.Email = "anna@gmail.com" },
+			wantErr: "email cannot be changed by update, it has to be changed by its dedicated flow",
+		},
+		{
+			name:         "other changes are allowed and guarded against concurrent email change",
+			update:       func(u *model.User) { u.FirstName, u.Country = "annie", "GB" },
+			wantExpected: model.ExpectedFields{"email": "ann@gmail.com"},
+		},
+		{
+			name:         "client expected fields are kept",
+			update:       func(u *model.User) { u.Nickname = "annie" },
+			expected:     model.ExpectedFields{"email": "other@gmail.com", "country": "UK"},
+			wantExpected: model.ExpectedFields{"email": "other@gmail.com", "country": "UK"},
+		},
+		{
+			name:         "omitted email is kept",
+			update:       func(u *model.User) { u.Email, u.Country = "", "GB" },
+			wantExpected: model.ExpectedFields{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock, WithImmutableFields("email"))
+			user := stored
+			tt.update(&user)
+
+			storageMock.On("GetUserByID", mock.Anything, stored.ID).Return(&stored, nil)
+			if tt.wantErr == "" {
+				storageMock.On("UpdateUser", mock.Anything, mock.Anything, tt.wantExpected).Return(&user, nil)
+				eventsMock.On("Produce", mock.Anything).Return(nil)
+			}
+
+			err := svc.UpdateUser(context.Background(), user, tt.expected)
+
+			if tt.wantErr != "" {
+				var conflictErr *custom_err.ConflictError
+				assert.ErrorAs(t, err, &conflictErr)
+				assert.EqualError(t, err, tt.wantErr)
+				storageMock.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+			}
+			storageMock.AssertExpectations(t)
+			eventsMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_BulkUpdateUsers(t *testing.T) {
+	now := time.Date(2024, 7, 13, 9, 19, 54, 625_000_000, time.UTC)
+	update := model.BulkUpdate{
+		Filter: model.FilterFields{Country: model.Ptr("UK")},
+		Set:    map[string]string{"country": "GB"},
+	}
+	wantSet := map[string]any{
+		"country":    "GB",
+		"updated_at": now,
+		"updated_by": "admin",
+	}
+
+	tests := []struct {
+		name         string
+		modified     int64
+		storageError error
+		wantEvent    bool
+	}{
+		{
+			name:      "modified users produce single event",
+			modified:  2,
+			wantEvent: true,
+		},
+		{
+			name: "no modified user, no event",
+		},
+		{
+			name:         "storage failure, no event",
+			storageError: errors.New("db down"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+
+			ctx := auth.ContextWithSubject(context.Background(), "admin")
+			svc := New(storageMock, eventsMock, WithClock(fixedClock(now)))
+
+			storageMock.On("UpdateMany", ctx, update.Filter, wantSet).Return(tt.modified, tt.storageError)
+			if tt.wantEvent {
+				eventsMock.On("Produce", model.NewUsersBulkUpdatedEvent(update, tt.modified)).Return(nil)
+			}
+
+			modified, err := svc.BulkUpdateUsers(ctx, update)
+
+			assert.ErrorIs(t, err, tt.storageError)
+			assert.Equal(t, tt.modified, modified)
+			storageMock.AssertExpectations(t)
+			eventsMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_CreateUsers(t *testing.T) {
+	now := time.Date(2024, 7, 13, 9, 19, 54, 625_000_000, time.UTC)
+	users := []model.User{{Nickname: "anna"}, {Nickname: "bob"}, {Nickname: "cyril"}}
+
+	tests := []struct {
+		name          string
+		ordering      EventsOrdering
+		failures      []custom_err.BatchItemError
+		storageError  error
+		wantEventsFor []string
+	}{
+		{
+			name:          "all created",
+			ordering:      EventsAfterCommit,
+			wantEventsFor: []string{"anna", "bob", "cyril"},
+		},
+		{
+			name:     "no event for the failed users after commit",
+			ordering: EventsAfterCommit,
+			failures: []custom_err.BatchItemError{
+				{Index: 1, Err: custom_err.NewConflictError("user already exists")},
+				{Index: 2, Err: custom_err.NotAttemptedError},
+			},
+			wantEventsFor: []string{"anna"},
+		},
+		{
+			name:     "events for all the users before commit",
+			ordering: EventsBeforeCommit,
+			failures: []custom_err.BatchItemError{
+				{Index: 1, Err: custom_err.NewConflictError("user already exists")},
+			},
+			wantEventsFor: []string{"anna", "bob", "cyril"},
+		},
+		{
+			name:         "storage failure, no event",
+			ordering:     EventsAfterCommit,
+			storageError: errors.New("db down"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(StorageMock)
+			eventsMock := new(EventsProducerMock)
+			svc := New(storageMock, eventsMock, WithClock(fixedClock(now)), WithEventsOrdering(tt.ordering))
+
+			storageMock.On("CreateUsers", context.Background(), mock.MatchedBy(func(created []model.User) bool {
+				for i, u := range created {
+					if u.ID == uuid.Nil || !u.CreatedAt.Equal(now) || u.Nickname != users[i].Nickname {
+						return false
+					}
+				}
+				return len(created) == len(users)
+			}), true).Return(tt.failures, tt.storageError)
+			var produced []string
+			eventsMock.On("Produce", mock.Anything).Run(func(args mock.Arguments) {
+				produced = append(produced, args.Get(0).(model.UserEvent).UserData.(model.User).Nickname)
+			}).Return(nil)
+
+			created, failures, err := svc.CreateUsers(context.Background(), users, true)
+
+			assert.ErrorIs(t, err, tt.storageError)
+			assert.Equal(t, tt.failures, failures)
+			assert.Equal(t, tt.wantEventsFor, produced)
+			if err == nil {
+				assert.Len(t, created, len(users))
+			}
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_DryRun(t *testing.T) {
+	stored := model.User{ID: uuid.New(), FirstName: "anna", Country: "UK", CreatedAt: time.Now().UTC(), CreatedBy: "admin"}
+	missingID := uuid.New()
+
+	// the mocks fail the test on any write or produced event as none is expected
+	storageMock := new(StorageMock)
+	storageMock.On("GetUserByID", mock.Anything, stored.ID).Return(&stored, nil)
+	storageMock.On("GetUserByID", mock.Anything, missingID).Return((*model.User)(nil), custom_err.NotFoundError)
+	storageMock.On("Exists", mock.Anything, stored.ID).Return(true, nil)
+	storageMock.On("Exists", mock.Anything, missingID).Return(false, nil)
+	eventsMock := new(EventsProducerMock)
+	svc := New(storageMock, eventsMock)
+	dryRun := func() (context.Context, *model.EventCapture) {
+		return model.ContextWithEventCapture(model.ContextWithDryRun(context.Background()))
+	}
+
+	t.Run("create returns the user to be created", func(t *testing.T) {
+		ctx, capture := dryRun()
+
+		created, err := svc.CreateUser(ctx, model.User{FirstName: "bob"})
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, uuid.Nil, created.ID)
+		assert.Equal(t, []model.UserEvent{model.NewUserCreatedEvent(*created)}, capture.Events())
+	})
+
+	t.Run("update checks the existence and the expected fields", func(t *testing.T) {
+		ctx, capture := dryRun()
+		err := svc.UpdateUser(ctx, model.User{ID: stored.ID, FirstName: "hanna"}, model.ExpectedFields{"first_name": "anna"})
+		assert.NoError(t, err)
+		events := capture.Events()
+		assert.Len(t, events, 1)
+		updated := events[0].UserData.(model.User)
+		assert.Equal(t, "hanna", updated.FirstName)
+		assert.Equal(t, stored.CreatedBy, updated.CreatedBy)
+
+		ctx, capture = dryRun()
+		err = svc.UpdateUser(ctx, model.User{ID: stored.ID, FirstName: "hanna"}, model.ExpectedFields{"first_name": "bob"})
+		assert.ErrorIs(t, err, custom_err.PreconditionFailedError)
+		assert.Empty(t, capture.Events())
+
+		ctx, _ = dryRun()
+		err = svc.UpdateUser(ctx, model.User{ID: missingID, FirstName: "hanna"}, nil)
+		assert.ErrorIs(t, err, custom_err.NotFoundError)
+	})
+
+	t.Run("delete checks the existence", func(t *testing.T) {
+		ctx, capture := dryRun()
+		assert.NoError(t, svc.DeleteUser(ctx, stored.ID))
+		assert.Equal(t, []model.UserEvent{model.NewUserDeletedEvent(stored.ID)}, capture.Events())
+
+		ctx, _ = dryRun()
+		assert.ErrorIs(t, svc.DeleteUser(ctx, missingID), custom_err.NotFoundError)
+	})
+
+	storageMock.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+	storageMock.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	storageMock.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+	eventsMock.AssertNotCalled(t, "Produce", mock.Anything)
+}
@@ -0,0 +1,158 @@
+package test_helpers
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
+	custom_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+// MemoryStorage keeps the users in memory to test and measure the service without the DB.
+// The users are listed ordered by ID, the filters and the sorting are not applied.
+type MemoryStorage struct {
+	mu          sync.Mutex
+	users       map[uuid.UUID]model.User
+	batchWrites int
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{users: map[uuid.UUID]model.User{}}
+}
+
+// Users returns the stored users.
+func (m *MemoryStorage) Users() []model.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := make([]model.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID.String() < users[j].ID.String()
+	})
+	return users
+}
+
+// BatchWrites returns the number of the CreateUsers calls.
+func (m *MemoryStorage) BatchWrites() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.batchWrites
+}
+
+func (m *MemoryStorage) CreateUser(_ context.Context, user model.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.ID]; ok {
+		return custom_err.NewConflictError("user already exists")
+	}
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *MemoryStorage) CreateUsers(ctx context.Context, users []model.User, _ bool) ([]custom_err.BatchItemError, error) {
+	m.mu.Lock()
+	m.batchWrites++
+	m.mu.Unlock()
+
+	var failures []custom_err.BatchItemError
+	for i, user := range users {
+		if err := m.CreateUser(ctx, user); err != nil {
+			failures = append(failures, custom_err.BatchItemError{Index: i, Err: err})
+		}
+	}
+	return failures, nil
+}
+
+func (m *MemoryStorage) GetUserByID(_ context.Context, id uuid.UUID) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, custom_err.NotFoundError
+	}
+	// the storage doesn't read the password
+	user.Password = ""
+	return &user, nil
+}
+
+func (m *MemoryStorage) GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return m.GetUserByID(ctx, id)
+}
+
+func (m *MemoryStorage) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
+	_, err := m.GetUserByID(ctx, id)
+	return err == nil, nil
+}
+
+func (m *MemoryStorage) GetUsers(_ context.Context, params model.GetUsersParams) ([]model.User, error) {
+	users := m.Users()
+	from := min(params.Page*params.PageSize, len(users))
+	to := min(from+params.PageSize, len(users))
+	if params.PeekNext {
+		to = min(to+1, len(users))
+	}
+	for i := range users {
+		users[i].Password = ""
+	}
+	return users[from:to], nil
+}
+
+func (m *MemoryStorage) StreamUsers(context.Context, model.GetUsersParams, func(model.User) error) error {
+	return nil
+}
+
+func (m *MemoryStorage) ExportUsers(context.Context, int, bool, func(model.User) error) (bool, error) {
+	return false, nil
+}
+
+func (m *MemoryStorage) UpdateUser(_ context.Context, user model.User, _ model.ExpectedFields) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.ID]; !ok {
+		return nil, custom_err.NotFoundError
+	}
+	m.users[user.ID] = user
+	return &user, nil
+}
+
+func (m *MemoryStorage) TouchUser(_ context.Context, id uuid.UUID, updatedAt time.Time, updatedBy string) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, custom_err.NotFoundError
+	}
+	user.UpdatedAt = updatedAt
+	user.UpdatedBy = updatedBy
+	m.users[id] = user
+	return &user, nil
+}
+
+func (m *MemoryStorage) UpdateMany(context.Context, model.FilterFields, map[string]any) (int64, error) {
+	return 0, nil
+}
+
+func (m *MemoryStorage) DeleteUser(_ context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[id]; !ok {
+		return custom_err.NotFoundError
+	}
+	delete(m.users, id)
+	return nil
+}
+
+func (m *MemoryStorage) MatchesExpected(user model.User, expected model.ExpectedFields) bool {
+	return expected.Match(user)
+}
+
+// NoopEventsProducer drops the produced events.
+type NoopEventsProducer struct{}
+
+func (NoopEventsProducer) Produce(any) error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package test_helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	custom_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+// UsersCreator creates the users in batches e.g. the service.
+type UsersCreator interface {
+	CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]model.User, []custom_err.BatchItemError, error)
+}
+
+// SeedUsers creates n synthetic users in unordered batches of batchSize e.g. to prepare data for load testing.
+// The users of each call are unique, so the seeding can be repeated against the same DB.
+// Returns the number of created users, the failed batch items are skipped.
+func SeedUsers(ctx context.Context, creator UsersCreator, n, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		return 0, errors.New("batch size has to be positive")
+	}
+
+	run := uuid.NewString()[:8]
+	created := 0
+	for from := 0; from < n; from += batchSize {
+		users, failures, err := creator.CreateUsers(ctx, SyntheticUsers(run, from, min(batchSize, n-from)), false)
+		if err != nil {
+			return created, err
+		}
+		created += len(users) - len(failures)
+	}
+
+	return created, nil
+}
+
+// SyntheticUsers returns n valid users with nicknames and emails unique within the seeding run.
+func SyntheticUsers(run string, from, n int) []model.User {
+	users := make([]model.User, n)
+	for i := range users {
+		nickname := fmt.Sprintf("seed-%s-%d", run, from+i)
+		users[i] = model.User{
+			FirstName: "Seed",
+			LastName:  "User",
+			Nickname:  nickname,
+			Password:  "seed-password",
+			Email:     nickname + "@example.com",
+			Country:   "UK",
+		}
+	}
+	return users
+}
@@ -0,0 +1,39 @@
+package test_helpers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"user-service/internal/service"
+)
+
+func Test_SeedUsers(t *testing.T) {
+	storage := NewMemoryStorage()
+	svc := service.New(storage, NoopEventsProducer{})
+
+	created, err := SeedUsers(context.Background(), svc, 25, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 25, created)
+	assert.Equal(t, 3, storage.BatchWrites())
+	nicknames := map[string]struct{}{}
+	for _, u := range storage.Users() {
+		nicknames[u.Nickname] = struct{}{}
+	}
+	assert.Len(t, nicknames, 25)
+
+	// repeated seeding creates other users
+	created, err = SeedUsers(context.Background(), svc, 5, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, created)
+	assert.Len(t, storage.Users(), 30)
+}
+
+func Test_SeedUsers_InvalidBatchSize(t *testing.T) {
+	svc := service.New(NewMemoryStorage(), NoopEventsProducer{})
+
+	_, err := SeedUsers(context.Background(), svc, 5, 0)
+
+	assert.Error(t, err)
+}
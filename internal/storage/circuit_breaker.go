@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+	"time"
+	custom_err "user-service/internal/errors"
+	"user-service/internal/model"
+	"user-service/internal/service"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreakerStorage fast-fails the storage operations with CircuitOpenError after failureThreshold
+// consecutive DB failures, so requests don't pile up on a failing DB. After the cooldown a single probe
+// operation is let through, its success closes the breaker again and its failure reopens it.
+// Only the DB unavailability (timeouts and network errors) counts as failure, e.g. not found users don't.
+// Neither do the operations the caller gave up on e.g. the exports cancelled by their deadline.
+type CircuitBreakerStorage struct {
+	storage          service.UsersStorage
+	failureThreshold int
+	cooldown         time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreakerStorage wraps the storage with the circuit breaker.
+func NewCircuitBreakerStorage(storage service.UsersStorage, failureThreshold int, cooldown time.Duration) *CircuitBreakerStorage {
+	return &CircuitBreakerStorage{
+		storage:          storage,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		now:              time.Now,
+	}
+}
+
+func (b *CircuitBreakerStorage) CreateUser(ctx context.Context, user model.User) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := b.storage.CreateUser(ctx, user)
+	b.done(ctx, err)
+	return err
+}
+
+func (b *CircuitBreakerStorage) GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	user, err := b.storage.GetUserProfile(ctx, id)
+	b.done(ctx, err)
+	return user, err
+}
+
+func (b *CircuitBreakerStorage) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	user, err := b.storage.GetUserByID(ctx, id)
+	b.done(ctx, err)
+	return user, err
+}
+
+func (b *CircuitBreakerStorage) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
+	if err := b.allow(); err != nil {
+		return false, err
+	}
+	exists, err := b.storage.Exists(ctx, id)
+	b.done(ctx, err)
+	return exists, err
+}
+
+func (b *CircuitBreakerStorage) GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	users, err := b.storage.GetUsers(ctx, params)
+	b.done(ctx, err)
+	return users, err
+}
+
+func (b *CircuitBreakerStorage) StreamUsers(ctx context.Context, params model.GetUsersParams, stream func(model.User) error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := b.storage.StreamUsers(ctx, params, stream)
+	b.done(ctx, err)
+	return err
+}
+
+func (b *CircuitBreakerStorage) ExportUsers(ctx context.Context, maxUsers int, includeHidden bool, export func(model.User) error) (bool, error) {
+	if err := b.allow(); err != nil {
+		return false, err
+	}
+	truncated, err := b.storage.ExportUsers(ctx, maxUsers, includeHidden, export)
+	b.done(ctx, err)
+	return truncated, err
+}
+
+func (b *CircuitBreakerStorage) UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) (*model.User, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	updated, err := b.storage.UpdateUser(ctx, user, expected)
+	b.done(ctx, err)
+	return updated, err
+}
+
+func (b *CircuitBreakerStorage) TouchUser(ctx context.Context, id uuid.UUID, updatedAt time.Time, updatedBy string) (*model.User, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	touched, err := b.storage.TouchUser(ctx, id, updatedAt, updatedBy)
+	b.done(ctx, err)
+	return touched, err
+}
+
+func (b *CircuitBreakerStorage) CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]custom_err.BatchItemError, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	failures, err := b.storage.CreateUsers(ctx, users, ordered)
+	b.done(ctx, err)
+	return failures, err
+}
+
+func (b *CircuitBreakerStorage) UpdateMany(ctx context.Context, filter model.FilterFields, set map[string]any) (int64, error) {
+	if err := b.allow(); err != nil {
+		return 0, err
+	}
+	modified, err := b.storage.UpdateMany(ctx, filter, set)
+	b.done(ctx, err)
+	return modified, err
+}
+
+func (b *CircuitBreakerStorage) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := b.storage.DeleteUser(ctx, id)
+	b.done(ctx, err)
+	return err
+}
+
+// MatchesExpected doesn't touch the DB, so it's not guarded.
+func (b *CircuitBreakerStorage) MatchesExpected(user model.User, expected model.ExpectedFields) bool {
+	return b.storage.MatchesExpected(user, expected)
+}
+
+// allow returns CircuitOpenError if the operation is not let through.
+func (b *CircuitBreakerStorage) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return custom_err.CircuitOpenError
+		}
+		// the operation is the probe, others fast-fail until it's done
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		return custom_err.CircuitOpenError
+	default:
+		return nil
+	}
+}
+
+// done records the result of the let through operation.
+func (b *CircuitBreakerStorage) done(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil && ctx.Err() != nil {
+		// the caller's context ended, the failure says nothing about the DB
+		if b.state == breakerHalfOpen {
+			// the probe is inconclusive, the next operation probes again
+			b.state = breakerOpen
+		}
+		return
+	}
+
+	if !isDBFailure(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.failureThreshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+func isDBFailure(err error) bool {
+	return err != nil && (mongo.IsTimeout(err) || mongo.IsNetworkError(err))
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+	custom_err "user-service/internal/errors"
+	"user-service/internal/model"
+)
+
+// storageStub returns the configured error from all the operations and counts the calls.
+type storageStub struct {
+	err   error
+	calls int
+}
+
+func (s *storageStub) CreateUser(context.Context, model.User) error {
+	s.calls++
+	return s.err
+}
+
+func (s *storageStub) CreateUsers(context.Context, []model.User, bool) ([]custom_err.BatchItemError, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *storageStub) GetUserByID(context.Context, uuid.UUID) (*model.User, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *storageStub) GetUserProfile(context.Context, uuid.UUID) (*model.User, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *storageStub) Exists(context.Context, uuid.UUID) (bool, error) {
+	s.calls++
+	return false, s.err
+}
+
+func (s *storageStub) GetUsers(context.Context, model.GetUsersParams) ([]model.User, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *storageStub) StreamUsers(context.Context, model.GetUsersParams, func(model.User) error) error {
+	s.calls++
+	return s.err
+}
+
+func (s *storageStub) ExportUsers(context.Context, int, bool, func(model.User) error) (bool, error) {
+	s.calls++
+	return false, s.err
+}
+
+func (s *storageStub) UpdateUser(context.Context, model.User, model.ExpectedFields) (*model.User, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *storageStub) TouchUser(context.Context, uuid.UUID, time.Time, string) (*model.User, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *storageStub) UpdateMany(context.Context, model.FilterFields, map[string]any) (int64, error) {
+	s.calls++
+	return 0, s.err
+}
+
+func (s *storageStub) DeleteUser(context.Context, uuid.UUID) error {
+	s.calls++
+	return s.err
+}
+
+func (s *storageStub) MatchesExpected(user model.User, expected model.ExpectedFields) bool {
+	return expected.Match(user)
+}
+
+func Test_CircuitBreakerStorage(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	now := time.Date(2024, 7, 13, 9, 0, 0, 0, time.UTC)
+	stub := &storageStub{err: context.DeadlineExceeded}
+	breaker := NewCircuitBreakerStorage(stub, 3, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	// failures under the threshold are passed through
+	for i := 0; i < 3; i++ {
+		err := breaker.DeleteUser(ctx, id)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	assert.Equal(t, 3, stub.calls)
+
+	// the threshold is reached - fast-fail without calling the DB
+	err := breaker.DeleteUser(ctx, id)
+	assert.Equal(t, custom_err.CircuitOpenError, err)
+	_, err = breaker.GetUserByID(ctx, id)
+	assert.Equal(t, custom_err.CircuitOpenError, err)
+	assert.Equal(t, 3, stub.calls)
+
+	// the failed probe after the cooldown opens the breaker again
+	now = now.Add(10 * time.Second)
+	err = breaker.DeleteUser(ctx, id)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	err = breaker.DeleteUser(ctx, id)
+	assert.Equal(t, custom_err.CircuitOpenError, err)
+	assert.Equal(t, 4, stub.calls)
+
+	// the successful probe after the cooldown closes the breaker
+	now = now.Add(10 * time.Second)
+	stub.err = nil
+	err = breaker.DeleteUser(ctx, id)
+	assert.Equal(t, nil, err)
+	err = breaker.DeleteUser(ctx, id)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 6, stub.calls)
+}
+
+func Test_CircuitBreakerStorage_CallerContextEnded(t *testing.T) {
+	id := uuid.New()
+	now := time.Date(2024, 7, 13, 9, 0, 0, 0, time.UTC)
+	stub := &storageStub{err: context.DeadlineExceeded}
+	breaker := NewCircuitBreakerStorage(stub, 1, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+	ended, cancel := context.WithDeadline(context.Background(), now)
+	cancel()
+
+	// the operations timed out by the caller's deadline e.g. the long exports don't open the breaker
+	for i := 0; i < 3; i++ {
+		_, err := breaker.ExportUsers(ended, 100, false, func(model.User) error { return nil })
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	assert.Equal(t, 3, stub.calls)
+
+	// the DB timeout opens it
+	err := breaker.DeleteUser(context.Background(), id)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	err = breaker.DeleteUser(context.Background(), id)
+	assert.Equal(t, custom_err.CircuitOpenError, err)
+
+	// the probe timed out by the caller doesn't keep the breaker half open, the next operation probes again
+	now = now.Add(10 * time.Second)
+	err = breaker.DeleteUser(ended, id)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	stub.err = nil
+	err = breaker.DeleteUser(context.Background(), id)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 6, stub.calls)
+}
+
+func Test_CircuitBreakerStorage_NonDBFailures(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "not found",
+			err:  custom_err.NotFoundError,
+		},
+		{
+			name: "conflict",
+			err:  custom_err.NewConflictError("user already exists"),
+		},
+		{
+			name: "other error",
+			err:  errors.New("sort field is required"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &storageStub{err: tt.err}
+			breaker := NewCircuitBreakerStorage(stub, 1, time.Minute)
+
+			for i := 0; i < 3; i++ {
+				_, err := breaker.GetUsers(ctx, model.GetUsersParams{})
+				assert.Equal(t, tt.err, err)
+			}
+			assert.Equal(t, 3, stub.calls)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"user-service/internal/model"
+)
+
+// hashEmail returns the deterministic keyed hash of the email, so the same email can be looked up without storing it in plaintext.
+// The email is normalized first, as the emails differing only in the case or surrounding spaces are the same email.
+func hashEmail(key []byte, email string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// storedEmail returns the email as it is stored in the DB - hashed if the email hashing is enabled.
+func (m MongoUsersStorage) storedEmail(email string) string {
+	if m.emailHashKey == nil {
+		return email
+	}
+	return hashEmail(m.emailHashKey, email)
+}
+
+// storedExpected returns the expected field values as they are stored in the DB - the email hashed if the email hashing is enabled.
+func (m MongoUsersStorage) storedExpected(expected model.ExpectedFields) model.ExpectedFields {
+	stored := make(model.ExpectedFields, len(expected))
+	for field, value := range expected {
+		if field == "email" {
+			value = m.storedEmail(value)
+		}
+		stored[field] = value
+	}
+	return stored
+}
+
+// MatchesExpected returns true if the user read from the storage matches all the expected field values. The read users
+// carry the emails as they are stored, so the expected email is hashed the same way if the email hashing is enabled.
+func (m MongoUsersStorage) MatchesExpected(user model.User, expected model.ExpectedFields) bool {
+	return m.storedExpected(expected).Match(user)
+}
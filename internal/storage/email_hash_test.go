@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"user-service/internal/model"
+)
+
+func Test_storedEmail(t *testing.T) {
+	plain := MongoUsersStorage{}
+	hashing := MongoUsersStorage{emailHashKey: []byte("secret")}
+	otherKey := MongoUsersStorage{emailHashKey: []byte("other")}
+
+	assert.Equal(t, "ann@gmail.com", plain.storedEmail("ann@gmail.com"))
+	assert.Equal(t, hashing.storedEmail("ann@gmail.com"), hashing.storedEmail("ann@gmail.com"))
+	assert.NotEqual(t, "ann@gmail.com", hashing.storedEmail("ann@gmail.com"))
+	assert.NotEqual(t, hashing.storedEmail("ann@gmail.com"), hashing.storedEmail("bet@gmail.com"))
+	assert.NotEqual(t, hashing.storedEmail("ann@gmail.com"), otherKey.storedEmail("ann@gmail.com"))
+	assert.Equal(t, hashing.storedEmail("ann@gmail.com"), hashing.storedEmail(" Ann@Gmail.COM "))
+	assert.Equal(t, "Ann@Gmail.COM", plain.storedEmail("Ann@Gmail.COM"))
+}
+
+func Test_MatchesExpected(t *testing.T) {
+	plain := MongoUsersStorage{}
+	hashing := MongoUsersStorage{emailHashKey: []byte("secret")}
+	readPlain := model.User{Email: "ann@gmail.com", Country: "UK"}
+	readHashed := model.User{Email: hashing.storedEmail("ann@gmail.com"), Country: "UK"}
+
+	assert.Equal(t, true, plain.MatchesExpected(readPlain, model.ExpectedFields{"email": "ann@gmail.com", "country": "UK"}))
+	assert.Equal(t, false, plain.MatchesExpected(readPlain, model.ExpectedFields{"email": "bet@gmail.com"}))
+	assert.Equal(t, true, hashing.MatchesExpected(readHashed, model.ExpectedFields{"email": "ann@gmail.com", "country": "UK"}))
+	assert.Equal(t, false, hashing.MatchesExpected(readHashed, model.ExpectedFields{"email": "bet@gmail.com"}))
+	assert.Equal(t, false, hashing.MatchesExpected(readHashed, model.ExpectedFields{"email": readHashed.Email}))
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"sort"
+	"strings"
+	"user-service/internal/model"
+)
+
+// userDocumentFields are the fields of the user documents by the bson tags of the model, mapped to whether they are required.
+var userDocumentFields = documentFields(reflect.TypeOf(model.User{}))
+
+func documentFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("bson"), ",")
+		fields[name] = !strings.Contains(opts, "omitempty")
+	}
+	return fields
+}
+
+// schemaDrift returns the required fields missing in the user document and the document fields unknown to the model.
+// The fields excluded by the projection are not reported as missing.
+func schemaDrift(doc bson.Raw, projection bson.M) (missing []string, unexpected []string) {
+	present := map[string]struct{}{}
+	elements, _ := doc.Elements()
+	for _, e := range elements {
+		present[e.Key()] = struct{}{}
+		if _, known := userDocumentFields[e.Key()]; !known {
+			unexpected = append(unexpected, e.Key())
+		}
+	}
+
+	for field, required := range userDocumentFields {
+		if _, excluded := projection[field]; excluded || !required {
+			continue
+		}
+		if _, ok := present[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing, unexpected
+}
+
+// warnSchemaDrift logs a warning if the read user document doesn't match the model, e.g. when a field was renamed
+// without migrating the old documents. It does nothing unless WithSchemaDriftWarnings is set.
+func (m MongoUsersStorage) warnSchemaDrift(doc bson.Raw) {
+	if !m.schemaDriftWarnings {
+		return
+	}
+
+	missing, unexpected := schemaDrift(doc, projection())
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return
+	}
+	logrus.WithField("user_id", doc.Lookup("_id").String()).
+		WithField("missing_fields", missing).
+		WithField("unexpected_fields", unexpected).
+		Warn("user document doesn't match the user model")
+}
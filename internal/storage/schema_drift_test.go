@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func Test_schemaDrift(t *testing.T) {
+	user := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	userDoc, err := bson.Marshal(user)
+	assert.Equal(t, nil, err)
+
+	tests := []struct {
+		name           string
+		doc            bson.M
+		projection     bson.M
+		wantMissing    []string
+		wantUnexpected []string
+	}{
+		{
+			name: "matching document",
+		},
+		{
+			name:       "projected out field",
+			doc:        bson.M{"password": nil},
+			projection: bson.M{"password": 0},
+		},
+		{
+			name:        "missing required field",
+			doc:         bson.M{"password": nil, "country": nil},
+			projection:  bson.M{},
+			wantMissing: []string{"country", "password"},
+		},
+		{
+			name:           "renamed field",
+			doc:            bson.M{"nickname": nil, "nick": "anna"},
+			wantMissing:    []string{"nickname"},
+			wantUnexpected: []string{"nick"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc bson.M
+			assert.Equal(t, nil, bson.Unmarshal(userDoc, &doc))
+			// nil values remove the fields
+			for k, v := range tt.doc {
+				if v == nil {
+					delete(doc, k)
+				} else {
+					doc[k] = v
+				}
+			}
+			raw, err := bson.Marshal(doc)
+			assert.Equal(t, nil, err)
+
+			missing, unexpected := schemaDrift(raw, tt.projection)
+
+			assert.Equal(t, tt.wantMissing, missing)
+			assert.Equal(t, tt.wantUnexpected, unexpected)
+		})
+	}
+}
+
+func Test_warnSchemaDrift(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	docs := []interface{}{
+		bson.M{"_id": uuid.New(), "first_name": "anna", "last_name": "alakava", "nickname": "anna", "email": "ann@gmail.com",
+			"country": "Austria", "created_at": time.Now(), "updated_at": time.Now(), "legacy_field": "x"},
+	}
+
+	for _, storage := range []MongoUsersStorage{{}, {schemaDriftWarnings: true}} {
+		cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+		assert.Equal(t, nil, err)
+		_, err = storage.exportFromCursor(context.Background(), cursor, 10, func(model.User) error { return nil })
+		assert.Equal(t, nil, err)
+	}
+
+	// logged only by the storage with the warnings enabled
+	assert.Equal(t, 1, len(hook.AllEntries()))
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, []string(nil), hook.LastEntry().Data["missing_fields"])
+	assert.Equal(t, []string{"legacy_field"}, hook.LastEntry().Data["unexpected_fields"])
+}
@@ -2,36 +2,142 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 	custom_err "user-service/internal/errors"
 	"user-service/internal/model"
 )
 
-const defaultDBTimeout = 1 * time.Second
+const (
+	// documentValidationFailureCode is the Mongo error code of the writes failing the collection schema validation
+	documentValidationFailureCode = 121
+	defaultDBTimeout              = 1 * time.Second
+	defaultMaxPageSize            = 100
+	// defaultIncrementalDecodePageSize is the page size from which the read users are decoded incrementally
+	defaultIncrementalDecodePageSize = 50
+
+	nicknamePerCountryIndexName = "unique_nickname_per_country"
+	caseInsensitiveIndexSuffix  = "_case_insensitive"
+)
+
+// caseInsensitiveCollation compares the strings ignoring the case, but not the diacritics.
+var caseInsensitiveCollation = &options.Collation{Locale: "en", Strength: 2}
 
 type Opt func(*MongoUsersStorage)
 
+// WithTimeout sets the timeout of the DB calls. Non-positive timeouts would fail every call, the default is kept for them.
 func WithTimeout(timeout time.Duration) Opt {
 	return func(s *MongoUsersStorage) {
+		if timeout <= 0 {
+			logrus.WithField("timeout", timeout).
+				Warnf("ignoring non-positive DB timeout, using the default %s", defaultDBTimeout)
+			return
+		}
 		s.dbTimeout = timeout
 	}
 }
 
+// WithMaxPageSize sets the maximum number of users GetUsers returns regardless of the requested page size.
+func WithMaxPageSize(size int) Opt {
+	return func(s *MongoUsersStorage) {
+		s.maxPageSize = size
+	}
+}
+
+// WithStrictSortType makes GetUsers fail on unknown sort types instead of falling back to ascending sorting.
+func WithStrictSortType() Opt {
+	return func(s *MongoUsersStorage) {
+		s.strictSortType = true
+	}
+}
+
+// WithNicknameUniquePerCountry makes EnsureIndexes create a unique index on country & nickname, so nicknames
+// are unique within a country but can be reused across countries.
+func WithNicknameUniquePerCountry() Opt {
+	return func(s *MongoUsersStorage) {
+		s.nicknameUniquePerCountry = true
+	}
+}
+
+// WithCaseInsensitiveIndexes makes EnsureIndexes create an index with case-insensitive collation on each of the fields,
+// so the case-insensitive exact filters on them are backed by an index.
+func WithCaseInsensitiveIndexes(fields ...string) Opt {
+	return func(s *MongoUsersStorage) {
+		s.caseInsensitiveIndexFields = fields
+	}
+}
+
+// WithEmailHashing stores the HMAC-SHA256 of the emails keyed by the secret instead of the plaintext emails.
+// The emails are lowercased and trimmed before hashing, so they stay unique and can be looked up regardless of the case.
+// Exact email lookups keep working as the queried email is hashed the same way, but the reads return the hashes
+// and the email domain filter is not supported.
+func WithEmailHashing(secret string) Opt {
+	return func(s *MongoUsersStorage) {
+		s.emailHashKey = []byte(secret)
+	}
+}
+
+// WithSchemaDriftWarnings logs a warning for each read user document that misses some of the model fields
+// or has fields unknown to the model. Meant to aid the migrations, it costs an extra pass over the read documents.
+func WithSchemaDriftWarnings() Opt {
+	return func(s *MongoUsersStorage) {
+		s.schemaDriftWarnings = true
+	}
+}
+
+// WithIncrementalDecodePageSize sets the page size from which GetUsers decodes the users one by one into a slice
+// allocated for the whole page instead of reading them by cursor.All, which reallocates the slice as it grows.
+// Smaller pages are read by cursor.All. The users are always decoded one by one with WithSchemaDriftWarnings.
+func WithIncrementalDecodePageSize(size int) Opt {
+	return func(s *MongoUsersStorage) {
+		s.incrementalDecodePageSize = size
+	}
+}
+
+// WithHiddenUsers hides the users whose field equals the value from the users list unless the hidden users are requested,
+// e.g. the service accounts stored alongside the users with role field.
+func WithHiddenUsers(field, value string) Opt {
+	return func(s *MongoUsersStorage) {
+		s.hiddenUsersField = field
+		s.hiddenUsersValue = value
+	}
+}
+
 type MongoUsersStorage struct {
-	users     *mongo.Collection
-	dbTimeout time.Duration
+	users                    *mongo.Collection
+	dbTimeout                time.Duration
+	maxPageSize              int
+	strictSortType           bool
+	nicknameUniquePerCountry bool
+	// caseInsensitiveIndexFields are the fields indexed with the case-insensitive collation
+	caseInsensitiveIndexFields []string
+	emailHashKey               []byte
+	schemaDriftWarnings        bool
+	// incrementalDecodePageSize is the page size from which the users are decoded one by one into a pre-sized slice
+	incrementalDecodePageSize int
+	// the users with hiddenUsersField equal to hiddenUsersValue are not listed by default, none is hidden if the field is empty
+	hiddenUsersField string
+	hiddenUsersValue string
 }
 
 // NewMongoUsersStorage creates new storage that manages "users" collection in the given db.
 func NewMongoUsersStorage(db *mongo.Database, opts ...Opt) *MongoUsersStorage {
 	m := &MongoUsersStorage{
-		users:     db.Collection("users"),
-		dbTimeout: defaultDBTimeout,
+		users:                     db.Collection("users"),
+		dbTimeout:                 defaultDBTimeout,
+		maxPageSize:               defaultMaxPageSize,
+		incrementalDecodePageSize: defaultIncrementalDecodePageSize,
 	}
 
 	for _, opt := range opts {
@@ -41,27 +147,126 @@ func NewMongoUsersStorage(db *mongo.Database, opts ...Opt) *MongoUsersStorage {
 	return m
 }
 
-// CreateUser creates the user in the DB. If DB operation fails the unchanged error is returned.
+// EnsureIndexes creates the configured indexes of the users collection. Already existing indexes are left untouched.
+// If DB operation fails the unchanged error is returned.
+func (m MongoUsersStorage) EnsureIndexes(ctx context.Context) error {
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	var indexes []mongo.IndexModel
+	if m.nicknameUniquePerCountry {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "country", Value: 1}, {Key: "nickname", Value: 1}},
+			Options: options.Index().SetName(nicknamePerCountryIndexName).SetUnique(true),
+		})
+	}
+	for _, field := range m.caseInsensitiveIndexFields {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetName(field + caseInsensitiveIndexSuffix).SetCollation(caseInsensitiveCollation),
+		})
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	_, err := m.users.Indexes().CreateMany(dbCtx, indexes)
+	return err
+}
+
+// Indexes lists the indexes of the users collection. If DB operation fails the unchanged error is returned.
+func (m MongoUsersStorage) Indexes(ctx context.Context) ([]model.Index, error) {
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	cursor, err := m.users.Indexes().List(dbCtx)
+	if err != nil {
+		return nil, err
+	}
+	var specs []struct {
+		Name      string `bson:"name"`
+		Key       bson.D `bson:"key"`
+		Unique    bool   `bson:"unique"`
+		Collation *struct {
+			Strength int `bson:"strength"`
+		} `bson:"collation"`
+	}
+	if err := cursor.All(dbCtx, &specs); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]model.Index, 0, len(specs))
+	for _, spec := range specs {
+		keys := make([]string, 0, len(spec.Key))
+		for _, k := range spec.Key {
+			keys = append(keys, k.Key)
+		}
+		caseInsensitive := spec.Collation != nil && spec.Collation.Strength <= caseInsensitiveCollation.Strength
+		indexes = append(indexes, model.Index{Name: spec.Name, Keys: keys, Unique: spec.Unique, CaseInsensitive: caseInsensitive})
+	}
+	return indexes, nil
+}
+
+// CreateUser creates the user in the DB. If the user collides with unique index ConflictError is returned.
+// If DB operation fails the unchanged error is returned.
 func (m MongoUsersStorage) CreateUser(ctx context.Context, user model.User) error {
 	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
 	defer cancel()
 
+	user.Email = m.storedEmail(user.Email)
 	_, err := m.users.InsertOne(dbCtx, user)
 	if err != nil {
-		return err
+		return mapWriteError(err)
 	}
 
 	return nil
 }
 
+// CreateUsers inserts the users in a single batch. Ordered insertion stops at the first failing user, otherwise all the users
+// that can be inserted are. The failures of the single users are returned by their batch index - the unique index collisions
+// as ConflictError, the schema validation failures as ValidationError and the users skipped by the ordered insertion
+// as NotAttemptedError. All the other users are inserted. If the DB operation fails as whole the unchanged error is returned.
+func (m MongoUsersStorage) CreateUsers(ctx context.Context, users []model.User, ordered bool) ([]custom_err.BatchItemError, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	docs := make([]any, 0, len(users))
+	for _, user := range users {
+		user.Email = m.storedEmail(user.Email)
+		docs = append(docs, user)
+	}
+	_, err := m.users.InsertMany(dbCtx, docs, options.InsertMany().SetOrdered(ordered))
+	if err != nil {
+		return mapBatchWriteError(err, len(users), ordered)
+	}
+
+	return nil, nil
+}
+
 // GetUserByID gets the user from the DB based on the provided id. If no user is found NotFoundError error is returned.
+// Sensitive fields are never read.
 // If DB operation fails the unchanged error is returned.
 func (m MongoUsersStorage) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return m.findUserByID(ctx, id)
+}
+
+// GetUserProfile gets the user from the DB based on the provided id, never reading the password.
+// If no user is found NotFoundError error is returned.
+// If DB operation fails the unchanged error is returned.
+func (m MongoUsersStorage) GetUserProfile(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return m.findUserByID(ctx, id)
+}
+
+func (m MongoUsersStorage) findUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
 	defer cancel()
 
 	filter := bson.M{"_id": bson.M{"$eq": id}}
-	result := m.users.FindOne(dbCtx, filter)
+	result := m.users.FindOne(dbCtx, filter, options.FindOne().SetProjection(projection()))
 	if err := result.Err(); err != nil {
 		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
 			return nil, custom_err.NotFoundError
@@ -69,6 +274,9 @@ func (m MongoUsersStorage) GetUserByID(ctx context.Context, id uuid.UUID) (*mode
 		return nil, err
 	}
 
+	if raw, err := result.Raw(); err == nil {
+		m.warnSchemaDrift(raw)
+	}
 	var user model.User
 	err := result.Decode(&user)
 	if err != nil {
@@ -78,58 +286,240 @@ func (m MongoUsersStorage) GetUserByID(ctx context.Context, id uuid.UUID) (*mode
 	return &user, nil
 }
 
+// Exists checks whether the user with given id exists. Only the id of the user is read from the DB.
+// If DB operation fails the unchanged error is returned.
+func (m MongoUsersStorage) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	filter := bson.M{"_id": bson.M{"$eq": id}}
+	err := m.users.FindOne(dbCtx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Stats are the statistics of the users collection.
+type Stats struct {
+	// Users is the estimated number of the user documents.
+	Users int64
+}
+
+// Stats returns the statistics of the users collection. The error tells the collection is not healthy,
+// so the health checks and the metrics share the same DB call.
+// If DB operation fails the unchanged error is returned.
+func (m MongoUsersStorage) Stats(ctx context.Context) (Stats, error) {
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	// from the collection metadata, so it's cheap enough for frequent health checks
+	count, err := m.users.EstimatedDocumentCount(dbCtx)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{Users: count}, nil
+}
+
 // GetUsers fetches User slice from the DB. Sort field has to be set in the given params.
+// At most maxPageSize users are returned, also when the page size is not set.
+// Sensitive fields are never read.
 // If DB operation fails the unchanged error is returned.
 func (m MongoUsersStorage) GetUsers(ctx context.Context, params model.GetUsersParams) ([]model.User, error) {
 	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
 	defer cancel()
 
-	opts, err := createGetUsersOpts(params)
+	cursor, limit, err := m.findUsers(dbCtx, params)
 	if err != nil {
 		return nil, err
 	}
-	filter := createGetUsersFilter(params)
+	defer cursor.Close(context.Background())
+
+	// the schema drift is checked on the raw documents, which are not kept by cursor.All
+	if m.schemaDriftWarnings || limit >= m.incrementalDecodePageSize {
+		return m.decodeIncrementally(dbCtx, cursor, limit)
+	}
+	return decodeAll(dbCtx, cursor)
+}
 
-	cursor, err := m.users.Find(dbCtx, filter, opts)
+// StreamUsers passes the users GetUsers would return to the stream function as they are read from the DB cursor.
+// If DB operation or the stream function fails the unchanged error is returned.
+func (m MongoUsersStorage) StreamUsers(ctx context.Context, params model.GetUsersParams, stream func(model.User) error) error {
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	cursor, _, err := m.findUsers(dbCtx, params)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(dbCtx) {
+		m.warnSchemaDrift(cursor.Current)
+		var user model.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		if err := stream(user); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// findUsers opens the cursor over the users matching the params. Returns also the maximum number of the users it can read.
+func (m MongoUsersStorage) findUsers(ctx context.Context, params model.GetUsersParams) (*mongo.Cursor, int, error) {
+	opts, err := m.createGetUsersOpts(params)
+	if err != nil {
+		return nil, 0, err
 	}
+	filter, err := m.createFilter(params.FilterFields)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter = m.hideUsers(filter, params.IncludeHidden)
+
+	cursor, err := m.users.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return cursor, int(*opts.Limit), nil
+}
 
+// decodeAll reads all the users from the cursor at once, the slice grows as the users are read.
+func decodeAll(ctx context.Context, cursor *mongo.Cursor) ([]model.User, error) {
 	var users []model.User
-	if err = cursor.All(dbCtx, &users); err != nil {
+	if err := cursor.All(ctx, &users); err != nil {
 		return nil, err
 	}
+	return users, nil
+}
+
+// decodeIncrementally reads the users from the cursor one by one into a slice allocated for the expected number of them.
+func (m MongoUsersStorage) decodeIncrementally(ctx context.Context, cursor *mongo.Cursor, expected int) ([]model.User, error) {
+	users := make([]model.User, 0, expected)
+	for cursor.Next(ctx) {
+		m.warnSchemaDrift(cursor.Current)
+		var user model.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		// same as cursor.All
+		return nil, nil
+	}
 
 	return users, nil
 }
 
+// ExportUsers passes all users ordered by ID to the export function, but at most maxUsers of them.
+// The hidden users are exported only if includeHidden is set. Returns true if the export was truncated because there are more users. The export is not limited
+// by the operation timeout, only by the context. Sensitive fields are never read.
+// If DB operation or the export function fails the unchanged error is returned.
+func (m MongoUsersStorage) ExportUsers(ctx context.Context, maxUsers int, includeHidden bool, export func(model.User) error) (bool, error) {
+	opts := options.Find().
+		SetProjection(projection()).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		// one more to find out whether there are users over the limit
+		SetLimit(int64(maxUsers) + 1)
+
+	cursor, err := m.users.Find(ctx, m.hideUsers(bson.M{}, includeHidden), opts)
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close(context.Background())
+
+	return m.exportFromCursor(ctx, cursor, maxUsers, export)
+}
+
+func (m MongoUsersStorage) exportFromCursor(ctx context.Context, cursor *mongo.Cursor, maxUsers int, export func(model.User) error) (bool, error) {
+	exported := 0
+	for cursor.Next(ctx) {
+		if exported == maxUsers {
+			return true, nil
+		}
+
+		m.warnSchemaDrift(cursor.Current)
+		var user model.User
+		if err := cursor.Decode(&user); err != nil {
+			return false, custom_err.NewResponseUnmarshallError(err)
+		}
+		if err := export(user); err != nil {
+			return false, err
+		}
+		exported++
+	}
+
+	return false, cursor.Err()
+}
+
 // UpdateUser updates the user in the DB while ignoring the created_at field. Returns the updated user.
+// The omitted email keeps the stored one.
+// The user is updated only if its current field values match the expected ones, otherwise PreconditionFailedError is returned.
 // If the user is not found NotFoundError is returned.
+// If the updated user collides with unique index ConflictError is returned.
 // If the DB response data fails to be unmarshalled ResponseUnmarshallError is returned.
 // If DB operation fails the unchanged error is returned.
-func (m MongoUsersStorage) UpdateUser(ctx context.Context, user model.User) (*model.User, error) {
+func (m MongoUsersStorage) UpdateUser(ctx context.Context, user model.User, expected model.ExpectedFields) (*model.User, error) {
 	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
 	defer cancel()
 
+	if err := expected.Validate(); err != nil {
+		return nil, err
+	}
 	filter := bson.M{"_id": bson.M{"$eq": user.ID}}
-	update := bson.M{
-		"$set": bson.M{
-			"first_name": user.FirstName,
-			"last_name":  user.LastName,
-			"nickname":   user.Nickname,
-			"password":   user.Password,
-			"email":      user.Email,
-			"country":    user.Country,
-			"updated_at": user.UpdatedAt,
-		},
+	for field, value := range m.storedExpected(expected) {
+		filter[field] = bson.M{"$eq": value}
+	}
+	set := bson.M{
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"nickname":   user.Nickname,
+		"password":   user.Password,
+		"country":    user.Country,
+		"updated_at": user.UpdatedAt,
+		"updated_by": user.UpdatedBy,
+	}
+	// the hashed emails can't be sent back by the clients, so the omitted email keeps the stored one
+	if user.Email != "" {
+		set["email"] = m.storedEmail(user.Email)
+	}
+	update := bson.M{"$set": set}
+	if user.Phone != "" {
+		set["phone"] = user.Phone
+	} else {
+		// the phone is optional - not sent means removed
+		update["$unset"] = bson.M{"phone": ""}
 	}
 
 	result := m.users.FindOneAndUpdate(dbCtx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
 	if err := result.Err(); err != nil {
 		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			if len(expected) == 0 {
+				return nil, custom_err.NotFoundError
+			}
+			// find out whether the user is missing or doesn't match the expectations
+			exists, err := m.Exists(ctx, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				return nil, custom_err.PreconditionFailedError
+			}
 			return nil, custom_err.NotFoundError
 		}
-		return nil, err
+		return nil, mapWriteError(err)
 	}
 
 	var updated model.User
@@ -141,6 +531,62 @@ func (m MongoUsersStorage) UpdateUser(ctx context.Context, user model.User) (*mo
 	return &updated, nil
 }
 
+// TouchUser sets the updated_at and updated_by of the user without changing its data. Returns the touched user.
+// If the user is not found NotFoundError is returned.
+// If the DB response data fails to be unmarshalled ResponseUnmarshallError is returned.
+// If DB operation fails the unchanged error is returned.
+func (m MongoUsersStorage) TouchUser(ctx context.Context, id uuid.UUID, updatedAt time.Time, updatedBy string) (*model.User, error) {
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	filter := bson.M{"_id": bson.M{"$eq": id}}
+	update := bson.M{"$set": bson.M{
+		"updated_at": updatedAt,
+		"updated_by": updatedBy,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(projection())
+
+	result := m.users.FindOneAndUpdate(dbCtx, filter, update, opts)
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, custom_err.NotFoundError
+		}
+		return nil, err
+	}
+
+	var touched model.User
+	if err := result.Decode(&touched); err != nil {
+		return nil, custom_err.NewResponseUnmarshallError(err)
+	}
+
+	return &touched, nil
+}
+
+// UpdateMany sets the fields of all the users matching the non-empty filter to the values and returns the number of
+// modified users. The filter is applied the same way as by GetUsers.
+// If DB operation fails the unchanged error is returned.
+func (m MongoUsersStorage) UpdateMany(ctx context.Context, filterFields model.FilterFields, set map[string]any) (int64, error) {
+	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
+	defer cancel()
+
+	if filterFields.IsEmpty() {
+		return 0, errors.New("filter is required")
+	}
+	filter, err := m.createFilter(filterFields)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := m.users.UpdateMany(dbCtx, filter, bson.M{"$set": set})
+	if err != nil {
+		return 0, mapWriteError(err)
+	}
+
+	return result.ModifiedCount, nil
+}
+
 // DeleteUser deletes the user with given id. If DB operation fails the unchanged error is returned.
 func (m MongoUsersStorage) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	var dbCtx, cancel = context.WithTimeout(ctx, m.dbTimeout)
@@ -159,46 +605,205 @@ func (m MongoUsersStorage) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// projection returns the projection of the read users documents, that excludes the sensitive fields,
+// so they are never read into memory.
+func projection() bson.M {
+	return bson.M{"password": 0}
+}
+
+// mapWriteError maps the unique index collisions to ConflictError and the schema validation failures to ValidationError,
+// other errors are returned unchanged.
+func mapWriteError(err error) error {
+	if validationErr := mapValidationError(err); validationErr != nil {
+		return validationErr
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	if strings.Contains(err.Error(), nicknamePerCountryIndexName) {
+		return custom_err.NewConflictError("nickname is already taken in the country")
+	}
+	return custom_err.NewConflictError("user already exists")
+}
+
+// mapBatchWriteError maps the failures of the single batch items the same way as mapWriteError. The items after
+// the failed one are reported as not attempted for the ordered batch. Other errors are returned unchanged.
+func mapBatchWriteError(err error, batchSize int, ordered bool) ([]custom_err.BatchItemError, error) {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return nil, err
+	}
+
+	failures := make([]custom_err.BatchItemError, 0, len(bulkErr.WriteErrors))
+	for _, we := range bulkErr.WriteErrors {
+		failures = append(failures, custom_err.BatchItemError{
+			Index: we.Index,
+			Err:   mapWriteError(mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}}),
+		})
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Index < failures[j].Index })
+	if ordered {
+		for i := failures[len(failures)-1].Index + 1; i < batchSize; i++ {
+			failures = append(failures, custom_err.BatchItemError{Index: i, Err: custom_err.NotAttemptedError})
+		}
+	}
+	return failures, nil
+}
+
+// mapValidationError returns ValidationError if the error is the collection schema validation failure, nil otherwise.
+func mapValidationError(err error) *custom_err.ValidationError {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, we := range writeErr.WriteErrors {
+			if we.Code == documentValidationFailureCode {
+				return custom_err.NewValidationError("user failed the DB validation", validationDetails(we.Details))
+			}
+		}
+	}
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == documentValidationFailureCode {
+		// e.g. findAndModify reports the failure as a command error with the details in errInfo
+		details, _ := cmdErr.Raw.Lookup("errInfo").DocumentOK()
+		return custom_err.NewValidationError("user failed the DB validation", validationDetails(details))
+	}
+	return nil
+}
+
+func validationDetails(raw bson.Raw) map[string]any {
+	if len(raw) == 0 {
+		return nil
+	}
+	// through the relaxed extended JSON, so the nested documents are maps and the values are JSON friendly
+	extJSON, err := bson.MarshalExtJSON(raw, false, false)
+	if err != nil {
+		return nil
+	}
+	var details map[string]any
+	if err := json.Unmarshal(extJSON, &details); err != nil {
+		return nil
+	}
+	return details
+}
+
+// createFilter creates the users filter, the emails are hashed if the hashing is enabled.
+func (m MongoUsersStorage) createFilter(filterFields model.FilterFields) (bson.M, error) {
+	filter := createGetUsersFilter(model.GetUsersParams{FilterFields: filterFields})
+	if m.emailHashKey != nil {
+		if filterFields.EmailDomain != nil {
+			return nil, custom_err.NewInvalidParameterError("email_domain", "email domain filter is not supported with hashed emails")
+		}
+		if filterFields.Email != nil {
+			filter["email"] = m.storedEmail(*filterFields.Email)
+		}
+	}
+	return filter, nil
+}
+
+// hideUsers adds the exclusion of the hidden users to the filter unless they are included. The users missing
+// the hidden users field are not hidden.
+func (m MongoUsersStorage) hideUsers(filter bson.M, includeHidden bool) bson.M {
+	if m.hiddenUsersField == "" || includeHidden {
+		return filter
+	}
+	hidden := bson.M{m.hiddenUsersField: bson.M{"$ne": m.hiddenUsersValue}}
+	if len(filter) == 0 {
+		return hidden
+	}
+	// the user filter can use the same field
+	return bson.M{"$and": bson.A{filter, hidden}}
+}
+
+// createGetUsersFilter creates the users filter from the set filter fields, an empty filter field matches the empty value.
 func createGetUsersFilter(params model.GetUsersParams) bson.M {
 	filter := bson.M{}
-	if params.FilterFields.FirstName != "" {
-		filter["first_name"] = params.FilterFields.FirstName
+	fields := params.FilterFields
+	if fields.FirstName != nil {
+		filter["first_name"] = *fields.FirstName
 	}
-	if params.FilterFields.LastName != "" {
-		filter["last_name"] = params.FilterFields.LastName
+	if fields.LastName != nil {
+		filter["last_name"] = *fields.LastName
 	}
-	if params.FilterFields.Nickname != "" {
-		filter["nickname"] = params.FilterFields.Nickname
+	if fields.Nickname != nil {
+		filter["nickname"] = *fields.Nickname
 	}
-	if params.FilterFields.Email != "" {
-		filter["email"] = params.FilterFields.Email
+	if fields.Email != nil && fields.EmailDomain != nil {
+		filter["email"] = bson.M{
+			"$eq":    *fields.Email,
+			"$regex": emailDomainRegex(*fields.EmailDomain),
+		}
+	} else if fields.Email != nil {
+		filter["email"] = *fields.Email
+	} else if fields.EmailDomain != nil {
+		filter["email"] = emailDomainRegex(*fields.EmailDomain)
+	}
+	if fields.Country != nil {
+		filter["country"] = *fields.Country
 	}
-	if params.FilterFields.Country != "" {
-		filter["country"] = params.FilterFields.Country
+	if fields.Phone != nil {
+		filter["phone"] = *fields.Phone
+	}
+	if fields.CreatedBy != nil {
+		filter["created_by"] = *fields.CreatedBy
+		if *fields.CreatedBy == "" {
+			// the creator of unauthenticated callers is not stored
+			filter["created_by"] = nil
+		}
 	}
 	return filter
 }
 
-func createGetUsersOpts(params model.GetUsersParams) (*options.FindOptions, error) {
-	if params.Sort.Field == "" {
-		return nil, errors.New("sort field is required")
+// emailDomainRegex matches emails ending with the domain, domain names are case-insensitive.
+func emailDomainRegex(domain string) primitive.Regex {
+	return primitive.Regex{
+		Pattern: "@" + regexp.QuoteMeta(domain) + "$",
+		Options: "i",
 	}
-	if params.PageSize < 0 {
-		return nil, errors.New("page size cannot be negative number")
+}
+
+func (m MongoUsersStorage) createGetUsersOpts(params model.GetUsersParams) (*options.FindOptions, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
 	}
-	if params.Page < 0 {
-		return nil, errors.New("page cannot be negative number")
+
+	sortDirection, err := mapSortDirection(params.Sort.Type, m.strictSortType)
+	if err != nil {
+		return nil, err
 	}
+	sort := bson.D{{Key: params.Sort.Field, Value: sortDirection}}
 
-	//1 = ascending, -1 = descending
-	sortType := 1
-	if params.Sort.Type == "desc" {
-		sortType = -1
+	// page size 0 means no limit in mongo, so cap it as well
+	limit := params.PageSize
+	if limit == 0 || limit > m.maxPageSize {
+		limit = m.maxPageSize
+	}
+	if params.PeekNext {
+		limit++
 	}
-	sort := bson.D{{params.Sort.Field, sortType}}
 
-	return options.Find().
+	opts := options.Find().
+		SetProjection(projection()).
 		SetSort(sort).
-		SetLimit(int64(params.PageSize)).
-		SetSkip(int64(params.Page * params.PageSize)), nil
+		SetLimit(int64(limit)).
+		SetSkip(int64(params.Page * params.PageSize))
+	if params.CaseInsensitive {
+		// same as the collation of the case-insensitive indexes, so they can be used
+		opts.SetCollation(caseInsensitiveCollation)
+	}
+	return opts, nil
+}
+
+// mapSortDirection maps the sort type to the mongo sort direction - 1 for ascending, -1 for descending.
+// Not set sort type is ascending. Unknown sort types are ascending too, unless strict is set, then an error is returned.
+func mapSortDirection(sortType string, strict bool) (int, error) {
+	switch sortType {
+	case "", "asc":
+		return 1, nil
+	case "desc":
+		return -1, nil
+	}
+
+	if strict {
+		return 0, custom_err.NewInvalidParameterError("sortBy", fmt.Sprintf("unknown sort type %q", sortType))
+	}
+	return 1, nil
 }
@@ -63,6 +63,12 @@ func (suite *MongoTestSuite) TearDownSuite() {
 }
 
 func (suite *MongoTestSuite) BeforeTest(_, _ string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	// start each test with an empty collection so tests don't see each other's data
+	err := suite.db.Collection("users").Drop(ctx)
+	suite.Require().NoError(err, "dropping users collection")
+
 	// UTC & truncate to millis because that is the Mongo timezone & precision, so it can be used in assertions & test data
 	suite.testStart = time.Now().UTC().Truncate(time.Millisecond)
 }
@@ -76,3 +82,16 @@ func (suite *MongoTestSuite) createTestUsers(user ...model.User) {
 		suite.Require().NoError(err, "creating test user")
 	}
 }
+
+// withoutPasswords returns copy of the users without the password, as it is not read from the DB by default.
+func withoutPasswords(users []model.User) []model.User {
+	if users == nil {
+		return nil
+	}
+	res := make([]model.User, 0, len(users))
+	for _, u := range users {
+		u.Password = ""
+		res = append(res, u)
+	}
+	return res
+}
@@ -2,13 +2,21 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/go-playground/assert/v2"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"testing"
 	"time"
+	custom_err "user-service/internal/errors"
 	"user-service/internal/model"
+	"user-service/internal/service"
 )
 
 // Unit tests that cover the functionality of fetching the Users list, as that one is the most complex one from all storage functions.
@@ -74,7 +82,7 @@ func (suite *MongoTestSuite) Test_GetUsers() {
 					Type:  "asc",
 				},
 				FilterFields: model.FilterFields{
-					FirstName: "denn",
+					FirstName: model.Ptr("denn"),
 				},
 			},
 			want: []model.User{userDenn},
@@ -87,7 +95,7 @@ func (suite *MongoTestSuite) Test_GetUsers() {
 					Type:  "asc",
 				},
 				FilterFields: model.FilterFields{
-					Country: "Austria",
+					Country: model.Ptr("Austria"),
 				},
 			},
 			want: []model.User{userAnna, userBeta, userDenn},
@@ -100,7 +108,7 @@ func (suite *MongoTestSuite) Test_GetUsers() {
 					Type:  "asc",
 				},
 				FilterFields: model.FilterFields{
-					Nickname: "nonExisting",
+					Nickname: model.Ptr("nonExisting"),
 				},
 			},
 			want: nil,
@@ -113,8 +121,8 @@ func (suite *MongoTestSuite) Test_GetUsers() {
 					Type:  "asc",
 				},
 				FilterFields: model.FilterFields{
-					Country:  "Austria",
-					Nickname: "same",
+					Country:  model.Ptr("Austria"),
+					Nickname: model.Ptr("same"),
 				},
 			},
 			want: []model.User{userBeta, userDenn},
@@ -177,7 +185,7 @@ func (suite *MongoTestSuite) Test_GetUsers() {
 				Page:     0,
 				PageSize: 2,
 				FilterFields: model.FilterFields{
-					Country: "Austria",
+					Country: model.Ptr("Austria"),
 				},
 			},
 			want: []model.User{userAnna, userBeta},
@@ -191,11 +199,76 @@ func (suite *MongoTestSuite) Test_GetUsers() {
 			got, err := storage.GetUsers(ctx, tt.params)
 
 			suite.Require().Equal(tt.wantErr, err != nil)
-			suite.Assert().Equal(tt.want, got)
+			suite.Assert().Equal(withoutPasswords(tt.want), got)
 		})
 	}
 }
 
+func (suite *MongoTestSuite) Test_GetUsersMaxPageSize() {
+	storage := NewMongoUsersStorage(suite.db, WithMaxPageSize(2))
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userBeta := model.User{ID: uuid.New(), FirstName: "beta", LastName: "brumkaa", Nickname: "beta", Password: "bpwd", Email: "bet@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userDenn := model.User{ID: uuid.New(), FirstName: "denn", LastName: "dobrare", Nickname: "denn", Password: "cpwd", Email: "den@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna, userBeta, userDenn)
+
+	tests := []struct {
+		name     string
+		pageSize int
+		want     []model.User
+	}{
+		{
+			name:     "page size not set - capped",
+			pageSize: 0,
+			want:     []model.User{userAnna, userBeta},
+		},
+		{
+			name:     "page size over max - capped",
+			pageSize: 3,
+			want:     []model.User{userAnna, userBeta},
+		},
+		{
+			name:     "page size under max",
+			pageSize: 1,
+			want:     []model.User{userAnna},
+		},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			params := model.GetUsersParams{
+				Sort:         model.Sort{Field: "first_name", Type: "asc"},
+				PageSize:     tt.pageSize,
+				FilterFields: model.FilterFields{Country: model.Ptr("Austria")},
+			}
+			got, err := storage.GetUsers(ctx, params)
+
+			suite.Require().NoError(err)
+			suite.Assert().Equal(withoutPasswords(tt.want), got)
+		})
+	}
+}
+
+func (suite *MongoTestSuite) Test_SensitiveFieldsProjection() {
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna)
+	params := model.GetUsersParams{Sort: model.Sort{Field: "first_name", Type: "asc"}}
+	want := withoutPasswords([]model.User{userAnna})[0]
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	storage := NewMongoUsersStorage(suite.db)
+
+	gotUser, err := storage.GetUserByID(ctx, userAnna.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(want, *gotUser, "password is never read")
+
+	gotUsers, err := storage.GetUsers(ctx, params)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]model.User{want}, gotUsers, "password is never read")
+}
+
 func (suite *MongoTestSuite) Test_GetUsersDBCallContextCancelled() {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -225,57 +298,114 @@ func Test_createGetUsersFilter(t *testing.T) {
 			filterFields: model.FilterFields{},
 			want:         bson.M{},
 		},
+		{
+			name: "present but empty",
+			filterFields: model.FilterFields{
+				FirstName: model.Ptr(""),
+			},
+			want: bson.M{"first_name": ""},
+		},
 		{
 			name: "first name",
 			filterFields: model.FilterFields{
-				FirstName: "value",
+				FirstName: model.Ptr("value"),
 			},
 			want: bson.M{"first_name": "value"},
 		},
 		{
 			name: "last name",
 			filterFields: model.FilterFields{
-				LastName: "value",
+				LastName: model.Ptr("value"),
 			},
 			want: bson.M{"last_name": "value"},
 		},
 		{
 			name: "nickname",
 			filterFields: model.FilterFields{
-				Nickname: "value",
+				Nickname: model.Ptr("value"),
 			},
 			want: bson.M{"nickname": "value"},
 		},
+		{
+			name: "phone",
+			filterFields: model.FilterFields{
+				Phone: model.Ptr("+442071838750"),
+			},
+			want: bson.M{"phone": "+442071838750"},
+		},
 		{
 			name: "email",
 			filterFields: model.FilterFields{
-				Email: "value",
+				Email: model.Ptr("value"),
 			},
 			want: bson.M{"email": "value"},
 		},
 		{
 			name: "country",
 			filterFields: model.FilterFields{
-				Country: "value",
+				Country: model.Ptr("value"),
 			},
 			want: bson.M{"country": "value"},
 		},
+		{
+			name: "email domain",
+			filterFields: model.FilterFields{
+				EmailDomain: model.Ptr("company.com"),
+			},
+			want: bson.M{"email": primitive.Regex{Pattern: `@company\.com$`, Options: "i"}},
+		},
+		{
+			name: "email domain and country",
+			filterFields: model.FilterFields{
+				EmailDomain: model.Ptr("company.com"),
+				Country:     model.Ptr("UK"),
+			},
+			want: bson.M{
+				"email":   primitive.Regex{Pattern: `@company\.com$`, Options: "i"},
+				"country": "UK",
+			},
+		},
+		{
+			name: "email and email domain",
+			filterFields: model.FilterFields{
+				Email:       model.Ptr("john@company.com"),
+				EmailDomain: model.Ptr("company.com"),
+			},
+			want: bson.M{"email": bson.M{
+				"$eq":    "john@company.com",
+				"$regex": primitive.Regex{Pattern: `@company\.com$`, Options: "i"},
+			}},
+		},
+		{
+			name: "created by",
+			filterFields: model.FilterFields{
+				CreatedBy: model.Ptr("admin"),
+			},
+			want: bson.M{"created_by": "admin"},
+		},
+		{
+			name: "created by unauthenticated caller",
+			filterFields: model.FilterFields{
+				CreatedBy: model.Ptr(""),
+			},
+			want: bson.M{"created_by": nil},
+		},
 		{
 			name: "combination of two",
 			filterFields: model.FilterFields{
-				Country:  "value",
-				Nickname: "value2",
+				Country:  model.Ptr("value"),
+				Nickname: model.Ptr("value2"),
 			},
 			want: bson.M{"country": "value", "nickname": "value2"},
 		},
 		{
 			name: "combination of all",
 			filterFields: model.FilterFields{
-				FirstName: "value1",
-				LastName:  "value2",
-				Nickname:  "value3",
-				Email:     "value4",
-				Country:   "value5",
+				FirstName: model.Ptr("value1"),
+				LastName:  model.Ptr("value2"),
+				Nickname:  model.Ptr("value3"),
+				Email:     model.Ptr("value4"),
+				Country:   model.Ptr("value5"),
 			},
 			want: bson.M{
 				"first_name": "value1",
@@ -298,6 +428,16 @@ func Test_createGetUsersFilter(t *testing.T) {
 	}
 }
 
+func Test_hideUsers(t *testing.T) {
+	storage := MongoUsersStorage{hiddenUsersField: "role", hiddenUsersValue: "service"}
+	hidden := bson.M{"role": bson.M{"$ne": "service"}}
+
+	assert.Equal(t, hidden, storage.hideUsers(bson.M{}, false))
+	assert.Equal(t, bson.M{"$and": bson.A{bson.M{"country": "UK"}, hidden}}, storage.hideUsers(bson.M{"country": "UK"}, false))
+	assert.Equal(t, bson.M{"country": "UK"}, storage.hideUsers(bson.M{"country": "UK"}, true))
+	assert.Equal(t, bson.M{"country": "UK"}, MongoUsersStorage{}.hideUsers(bson.M{"country": "UK"}, false))
+}
+
 func Test_createGetUsersOpts(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -318,8 +458,9 @@ func Test_createGetUsersOpts(t *testing.T) {
 				Sort: model.Sort{Field: "sort_field"},
 			},
 			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
 				SetSort(bson.D{{"sort_field", 1}}).
-				SetLimit(0).
+				SetLimit(10).
 				SetSkip(0),
 		},
 		{
@@ -331,8 +472,9 @@ func Test_createGetUsersOpts(t *testing.T) {
 				},
 			},
 			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
 				SetSort(bson.D{{"sort_field", 1}}).
-				SetLimit(0).
+				SetLimit(10).
 				SetSkip(0),
 		},
 		{
@@ -344,8 +486,9 @@ func Test_createGetUsersOpts(t *testing.T) {
 				},
 			},
 			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
 				SetSort(bson.D{{"sort_field", -1}}).
-				SetLimit(0).
+				SetLimit(10).
 				SetSkip(0),
 		},
 		{
@@ -357,10 +500,24 @@ func Test_createGetUsersOpts(t *testing.T) {
 				},
 			},
 			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
 				SetSort(bson.D{{"sort_field", 1}}).
-				SetLimit(0).
+				SetLimit(10).
 				SetSkip(0),
 		},
+		{
+			name: "case-insensitive",
+			params: model.GetUsersParams{
+				Sort:            model.Sort{Field: "sort_field"},
+				CaseInsensitive: true,
+			},
+			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
+				SetSort(bson.D{{"sort_field", 1}}).
+				SetLimit(10).
+				SetSkip(0).
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
 		{
 			name: "negative page",
 			params: model.GetUsersParams{
@@ -368,7 +525,7 @@ func Test_createGetUsersOpts(t *testing.T) {
 				Page: -1,
 			},
 			wantErr:       true,
-			wantErrString: "page cannot be negative number",
+			wantErrString: "page cannot be a negative number",
 		},
 		{
 			name: "negative page size",
@@ -377,7 +534,7 @@ func Test_createGetUsersOpts(t *testing.T) {
 				PageSize: -1,
 			},
 			wantErr:       true,
-			wantErrString: "page size cannot be negative number",
+			wantErrString: "pageSize cannot be a negative number",
 		},
 		{
 			name: "page set",
@@ -386,8 +543,9 @@ func Test_createGetUsersOpts(t *testing.T) {
 				Page: 5,
 			},
 			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
 				SetSort(bson.D{{"sort_field", 1}}).
-				SetLimit(0).
+				SetLimit(10).
 				SetSkip(0),
 		},
 		{
@@ -397,6 +555,7 @@ func Test_createGetUsersOpts(t *testing.T) {
 				PageSize: 5,
 			},
 			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
 				SetSort(bson.D{{"sort_field", 1}}).
 				SetLimit(5).
 				SetSkip(0),
@@ -409,14 +568,43 @@ func Test_createGetUsersOpts(t *testing.T) {
 				PageSize: 5,
 			},
 			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
 				SetSort(bson.D{{"sort_field", 1}}).
 				SetLimit(5).
 				SetSkip(10),
 		},
+		{
+			name: "page size over max - capped",
+			params: model.GetUsersParams{
+				Sort:     model.Sort{Field: "sort_field"},
+				Page:     1,
+				PageSize: 15,
+			},
+			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
+				SetSort(bson.D{{"sort_field", 1}}).
+				SetLimit(10).
+				SetSkip(15),
+		},
+		{
+			name: "peek next",
+			params: model.GetUsersParams{
+				Sort:     model.Sort{Field: "sort_field"},
+				Page:     2,
+				PageSize: 5,
+				PeekNext: true,
+			},
+			want: options.Find().
+				SetProjection(bson.M{"password": 0}).
+				SetSort(bson.D{{"sort_field", 1}}).
+				SetLimit(6).
+				SetSkip(10),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := createGetUsersOpts(tt.params)
+			storage := MongoUsersStorage{maxPageSize: 10}
+			got, err := storage.createGetUsersOpts(tt.params)
 
 			assert.Equal(t, tt.wantErr, err != nil)
 			if tt.wantErrString != "" {
@@ -426,3 +614,864 @@ func Test_createGetUsersOpts(t *testing.T) {
 		})
 	}
 }
+
+func Test_mapSortDirection(t *testing.T) {
+	tests := []struct {
+		name     string
+		sortType string
+		strict   bool
+		want     int
+		wantErr  bool
+	}{
+		{
+			name:     "asc",
+			sortType: "asc",
+			want:     1,
+		},
+		{
+			name:     "desc",
+			sortType: "desc",
+			want:     -1,
+		},
+		{
+			name:     "not set - asc",
+			sortType: "",
+			want:     1,
+		},
+		{
+			name:     "unknown - lenient defaults to asc",
+			sortType: "unknown",
+			want:     1,
+		},
+		{
+			name:     "desc - strict",
+			sortType: "desc",
+			strict:   true,
+			want:     -1,
+		},
+		{
+			name:     "not set - strict asc",
+			sortType: "",
+			strict:   true,
+			want:     1,
+		},
+		{
+			name:     "unknown - strict fails",
+			sortType: "unknown",
+			strict:   true,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mapSortDirection(tt.sortType, tt.strict)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func (suite *MongoTestSuite) Test_NicknameUniquePerCountry() {
+	storage := NewMongoUsersStorage(suite.db, WithNicknameUniquePerCountry())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	suite.Require().NoError(storage.EnsureIndexes(ctx))
+	// ensuring already existing indexes is a no-op
+	suite.Require().NoError(storage.EnsureIndexes(ctx))
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "same", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.Require().NoError(storage.CreateUser(ctx, userAnna))
+
+	suite.Run("same nickname in different country", func() {
+		userBeta := model.User{ID: uuid.New(), FirstName: "beta", LastName: "brumkaa", Nickname: "same", Password: "bpwd", Email: "bet@gmail.com", Country: "Egypttt", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+
+		err := storage.CreateUser(ctx, userBeta)
+
+		suite.Assert().NoError(err)
+	})
+
+	suite.Run("same nickname in same country collides on create", func() {
+		userDenn := model.User{ID: uuid.New(), FirstName: "denn", LastName: "dobrare", Nickname: "same", Password: "cpwd", Email: "den@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+
+		err := storage.CreateUser(ctx, userDenn)
+
+		var conflictErr *custom_err.ConflictError
+		suite.Require().ErrorAs(err, &conflictErr)
+		suite.Assert().Equal("nickname is already taken in the country", conflictErr.Error())
+	})
+
+	suite.Run("same nickname in same country collides on update", func() {
+		userEmel := model.User{ID: uuid.New(), FirstName: "emel", LastName: "estaril", Nickname: "other", Password: "dpwd", Email: "eme@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+		suite.Require().NoError(storage.CreateUser(ctx, userEmel))
+
+		userEmel.Nickname = "same"
+		_, err := storage.UpdateUser(ctx, userEmel, nil)
+
+		var conflictErr *custom_err.ConflictError
+		suite.Assert().ErrorAs(err, &conflictErr)
+	})
+}
+
+func (suite *MongoTestSuite) Test_GetUsersByEmailDomain() {
+	storage := NewMongoUsersStorage(suite.db)
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@company.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userBeta := model.User{ID: uuid.New(), FirstName: "beta", LastName: "brumkaa", Nickname: "beta", Password: "bpwd", Email: "bet@Company.COM", Country: "Egypttt", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userDenn := model.User{ID: uuid.New(), FirstName: "denn", LastName: "dobrare", Nickname: "denn", Password: "cpwd", Email: "den@sub.company.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userEmel := model.User{ID: uuid.New(), FirstName: "emel", LastName: "estaril", Nickname: "emel", Password: "dpwd", Email: "eme@companyxcom.org", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna, userBeta, userDenn, userEmel)
+
+	tests := []struct {
+		name         string
+		filterFields model.FilterFields
+		want         []model.User
+	}{
+		{
+			name:         "domain matched case-insensitively, subdomains not matched",
+			filterFields: model.FilterFields{EmailDomain: model.Ptr("company.com")},
+			want:         []model.User{userAnna, userBeta},
+		},
+		{
+			name:         "subdomain",
+			filterFields: model.FilterFields{EmailDomain: model.Ptr("sub.company.com")},
+			want:         []model.User{userDenn},
+		},
+		{
+			name:         "combined with other filter",
+			filterFields: model.FilterFields{EmailDomain: model.Ptr("company.com"), Country: model.Ptr("Austria")},
+			want:         []model.User{userAnna},
+		},
+		{
+			name:         "unknown domain",
+			filterFields: model.FilterFields{EmailDomain: model.Ptr("gmail.com")},
+		},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			params := model.GetUsersParams{
+				Sort:         model.Sort{Field: "first_name", Type: "asc"},
+				FilterFields: tt.filterFields,
+			}
+			got, err := storage.GetUsers(ctx, params)
+
+			suite.Require().NoError(err)
+			suite.Assert().Equal(withoutPasswords(tt.want), got)
+		})
+	}
+}
+
+func (suite *MongoTestSuite) Test_GetUsersCaseInsensitive() {
+	storage := NewMongoUsersStorage(suite.db, WithCaseInsensitiveIndexes("nickname"))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	suite.Require().NoError(storage.EnsureIndexes(ctx))
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userBeta := model.User{ID: uuid.New(), FirstName: "beta", LastName: "brumkaa", Nickname: "Anna", Password: "bpwd", Email: "bet@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userDenn := model.User{ID: uuid.New(), FirstName: "denn", LastName: "dobrare", Nickname: "annabel", Password: "cpwd", Email: "den@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna, userBeta, userDenn)
+
+	tests := []struct {
+		name            string
+		nickname        string
+		caseInsensitive bool
+		want            []model.User
+	}{
+		{
+			name:     "case-sensitive exact match",
+			nickname: "ANNA",
+		},
+		{
+			name:     "case-sensitive exact match of the same case",
+			nickname: "anna",
+			want:     []model.User{userAnna},
+		},
+		{
+			name:            "case-insensitive exact match",
+			nickname:        "ANNA",
+			caseInsensitive: true,
+			want:            []model.User{userAnna, userBeta},
+		},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			params := model.GetUsersParams{
+				Sort:            model.Sort{Field: "first_name", Type: "asc"},
+				FilterFields:    model.FilterFields{Nickname: model.Ptr(tt.nickname)},
+				CaseInsensitive: tt.caseInsensitive,
+			}
+			got, err := storage.GetUsers(ctx, params)
+
+			suite.Require().NoError(err)
+			suite.Assert().Equal(withoutPasswords(tt.want), got)
+		})
+	}
+}
+
+func Test_exportFromCursor(t *testing.T) {
+	users := []model.User{
+		{ID: uuid.New(), FirstName: "anna"},
+		{ID: uuid.New(), FirstName: "beta"},
+		{ID: uuid.New(), FirstName: "denn"},
+	}
+
+	tests := []struct {
+		name          string
+		maxUsers      int
+		want          []model.User
+		wantTruncated bool
+	}{
+		{
+			name:     "under the cap",
+			maxUsers: 4,
+			want:     users,
+		},
+		{
+			name:     "exactly the cap",
+			maxUsers: 3,
+			want:     users,
+		},
+		{
+			name:          "over the cap",
+			maxUsers:      2,
+			want:          users[:2],
+			wantTruncated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var docs []interface{}
+			for _, u := range users {
+				docs = append(docs, u)
+			}
+			cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+			assert.Equal(t, nil, err)
+
+			var got []model.User
+			truncated, err := MongoUsersStorage{}.exportFromCursor(context.Background(), cursor, tt.maxUsers, func(user model.User) error {
+				got = append(got, user)
+				return nil
+			})
+
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.wantTruncated, truncated)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_decodeUsers(t *testing.T) {
+	users := []model.User{
+		{ID: uuid.New(), FirstName: "anna"},
+		{ID: uuid.New(), FirstName: "beta"},
+		{ID: uuid.New(), FirstName: "denn"},
+	}
+
+	tests := []struct {
+		name  string
+		users []model.User
+		want  []model.User
+	}{
+		{
+			name: "no user",
+		},
+		{
+			name:  "single user",
+			users: users[:1],
+			want:  users[:1],
+		},
+		{
+			name:  "multiple users",
+			users: users,
+			want:  users,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all, err := decodeAll(context.Background(), newUsersCursor(t, tt.users))
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.want, all)
+
+			// expecting more users than read
+			incremental, err := MongoUsersStorage{}.decodeIncrementally(context.Background(), newUsersCursor(t, tt.users), 10)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.want, incremental)
+		})
+	}
+}
+
+func BenchmarkDecodeUsers(b *testing.B) {
+	for _, pageSize := range []int{10, 100, 1000} {
+		users := make([]model.User, pageSize)
+		for i := range users {
+			users[i] = model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Email: "ann@gmail.com", Country: "Austria"}
+		}
+
+		b.Run(fmt.Sprintf("all %d", pageSize), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				cursor := newUsersCursor(b, users)
+				b.StartTimer()
+				if _, err := decodeAll(context.Background(), cursor); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("incremental %d", pageSize), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				cursor := newUsersCursor(b, users)
+				b.StartTimer()
+				if _, err := (MongoUsersStorage{}).decodeIncrementally(context.Background(), cursor, pageSize); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newUsersCursor returns a cursor over the given users as if they were read from the DB.
+func newUsersCursor(tb testing.TB, users []model.User) *mongo.Cursor {
+	docs := make([]interface{}, 0, len(users))
+	for _, u := range users {
+		docs = append(docs, u)
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return cursor
+}
+
+func (suite *MongoTestSuite) Test_Exists() {
+	storage := NewMongoUsersStorage(suite.db)
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna)
+
+	tests := []struct {
+		name string
+		id   uuid.UUID
+		want bool
+	}{
+		{
+			name: "existing user",
+			id:   userAnna.ID,
+			want: true,
+		},
+		{
+			name: "non existing user",
+			id:   uuid.New(),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			got, err := storage.Exists(ctx, tt.id)
+
+			suite.Require().NoError(err)
+			suite.Assert().Equal(tt.want, got)
+		})
+	}
+}
+
+func (suite *MongoTestSuite) Test_EmailHashing() {
+	storage := NewMongoUsersStorage(suite.db, WithEmailHashing("secret"))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.Require().NoError(storage.CreateUser(ctx, userAnna))
+
+	var stored model.User
+	err := suite.db.Collection("users").FindOne(ctx, bson.M{"_id": userAnna.ID}).Decode(&stored)
+	suite.Require().NoError(err)
+	suite.Assert().NotEqual(userAnna.Email, stored.Email, "email has to be stored hashed")
+
+	// the lookup doesn't depend on the email case
+	for _, email := range []string{userAnna.Email, "Ann@Gmail.com"} {
+		users, err := storage.GetUsers(ctx, model.GetUsersParams{
+			Sort:         model.Sort{Field: "first_name", Type: "asc"},
+			FilterFields: model.FilterFields{Email: model.Ptr(email)},
+		})
+		suite.Require().NoError(err)
+		suite.Require().Len(users, 1)
+		suite.Assert().Equal(userAnna.ID, users[0].ID)
+	}
+
+	users, err := storage.GetUsers(ctx, model.GetUsersParams{
+		Sort:         model.Sort{Field: "first_name", Type: "asc"},
+		FilterFields: model.FilterFields{Email: model.Ptr("bet@gmail.com")},
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(users)
+
+	_, err = storage.GetUsers(ctx, model.GetUsersParams{
+		Sort:         model.Sort{Field: "first_name", Type: "asc"},
+		FilterFields: model.FilterFields{EmailDomain: model.Ptr("gmail.com")},
+	})
+	suite.Assert().Error(err, "email domain filter can't work with hashes")
+}
+
+func (suite *MongoTestSuite) Test_EmailHashingWithImmutableEmail() {
+	storage := NewMongoUsersStorage(suite.db, WithEmailHashing("secret"))
+	svc := service.New(storage, noopEventsProducer{}, service.WithImmutableFields("email"))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.Require().NoError(storage.CreateUser(ctx, userAnna))
+
+	// the unchanged email matches its stored hash, also when expected by the client
+	update := userAnna
+	update.Country = "UK"
+	suite.Require().NoError(svc.UpdateUser(ctx, update, model.ExpectedFields{"email": "ann@gmail.com"}))
+	got, err := storage.GetUserByID(ctx, userAnna.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("UK", got.Country)
+
+	update.Email = "anna@gmail.com"
+	err = svc.UpdateUser(ctx, update, nil)
+	var conflictErr *custom_err.ConflictError
+	suite.Assert().ErrorAs(err, &conflictErr)
+
+	// the read hash can't be sent back, the omitted email keeps the stored one
+	update.Email = ""
+	update.Country = "GB"
+	suite.Require().NoError(svc.UpdateUser(ctx, update, nil))
+	got, err = storage.GetUserByID(ctx, userAnna.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("GB", got.Country)
+	suite.Assert().Equal(hashEmail([]byte("secret"), "ann@gmail.com"), got.Email)
+}
+
+type noopEventsProducer struct{}
+
+func (noopEventsProducer) Produce(any) error {
+	return nil
+}
+
+func (suite *MongoTestSuite) Test_Phone() {
+	storage := NewMongoUsersStorage(suite.db)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", Phone: "+442071838750", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userBob := model.User{ID: uuid.New(), FirstName: "bob", LastName: "bobek", Nickname: "bob", Password: "bpwd", Email: "bob@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna, userBob)
+
+	// persisted and filterable
+	got, err := storage.GetUsers(ctx, model.GetUsersParams{PageSize: 10, Sort: model.Sort{Field: "last_name", Type: "asc"}, FilterFields: model.FilterFields{Phone: model.Ptr("+442071838750")}})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(withoutPasswords([]model.User{userAnna}), got)
+
+	// absent phone is not stored
+	gotBob, err := storage.GetUserByID(ctx, userBob.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("", gotBob.Phone)
+
+	// update without phone removes it
+	userAnna.Phone = ""
+	updated, err := storage.UpdateUser(ctx, userAnna, nil)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("", updated.Phone)
+	count, err := suite.db.Collection("users").CountDocuments(ctx, bson.M{"phone": bson.M{"$exists": true}})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(0), count)
+}
+
+func (suite *MongoTestSuite) Test_SchemaDriftWarnings() {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	storage := NewMongoUsersStorage(suite.db, WithSchemaDriftWarnings())
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna)
+	_, err := suite.db.Collection("users").UpdateOne(ctx, bson.M{"_id": userAnna.ID}, bson.M{"$set": bson.M{"legacy_field": "x"}})
+	suite.Require().NoError(err)
+
+	got, err := storage.GetUserByID(ctx, userAnna.ID)
+
+	suite.Require().NoError(err)
+	suite.Assert().Equal(userAnna.ID, got.ID)
+	suite.Require().NotNil(hook.LastEntry())
+	suite.Assert().Equal(logrus.WarnLevel, hook.LastEntry().Level)
+	suite.Assert().Equal([]string{"legacy_field"}, hook.LastEntry().Data["unexpected_fields"])
+}
+
+func (suite *MongoTestSuite) Test_UpdateMany() {
+	storage := NewMongoUsersStorage(suite.db)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userBob := model.User{ID: uuid.New(), FirstName: "bob", LastName: "bobek", Nickname: "bob", Password: "bpwd", Email: "bob@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	userCyril := model.User{ID: uuid.New(), FirstName: "cyril", LastName: "cyrilek", Nickname: "cyril", Password: "cpwd", Email: "cyril@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna, userBob, userCyril)
+
+	updatedAt := suite.testStart.Add(time.Minute)
+	modified, err := storage.UpdateMany(ctx, model.FilterFields{Country: model.Ptr("UK")}, map[string]any{"country": "GB", "updated_at": updatedAt})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(2), modified)
+
+	got, err := storage.GetUsers(ctx, model.GetUsersParams{PageSize: 10, Sort: model.Sort{Field: "last_name", Type: "asc"}, FilterFields: model.FilterFields{Country: model.Ptr("GB")}})
+	suite.Require().NoError(err)
+	userAnna.Country, userAnna.UpdatedAt = "GB", updatedAt
+	userBob.Country, userBob.UpdatedAt = "GB", updatedAt
+	suite.Assert().Equal(withoutPasswords([]model.User{userAnna, userBob}), got)
+
+	gotCyril, err := storage.GetUserByID(ctx, userCyril.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("Austria", gotCyril.Country)
+}
+
+func Test_UpdateMany_EmptyFilter(t *testing.T) {
+	// the guard fails before touching the DB, so no collection is needed
+	storage := MongoUsersStorage{}
+
+	modified, err := storage.UpdateMany(context.Background(), model.FilterFields{}, map[string]any{"country": "GB"})
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, int64(0), modified)
+}
+
+func Test_NewMongoUsersStorage_NonPositiveTimeout(t *testing.T) {
+	// the client connects lazily, so no server is needed to construct the storage
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	assert.Equal(t, nil, err)
+	defer client.Disconnect(context.Background())
+
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		storage := NewMongoUsersStorage(client.Database("test"), WithTimeout(timeout))
+
+		assert.Equal(t, defaultDBTimeout, storage.dbTimeout)
+	}
+	assert.Equal(t, time.Second, NewMongoUsersStorage(client.Database("test"), WithTimeout(time.Second)).dbTimeout)
+}
+
+func (suite *MongoTestSuite) Test_UpdateUserExpectedFields() {
+	storage := NewMongoUsersStorage(suite.db)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna)
+
+	update := userAnna
+	update.Country = "GB"
+
+	// non-matching expectation
+	_, err := storage.UpdateUser(ctx, update, model.ExpectedFields{"country": "DE"})
+	suite.Assert().ErrorIs(err, custom_err.PreconditionFailedError)
+	got, err := storage.GetUserByID(ctx, userAnna.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("UK", got.Country)
+
+	// matching expectation
+	updated, err := storage.UpdateUser(ctx, update, model.ExpectedFields{"country": "UK", "email": "ann@gmail.com"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal("GB", updated.Country)
+
+	// missing user is not found regardless of the expectation
+	missing := update
+	missing.ID = uuid.New()
+	_, err = storage.UpdateUser(ctx, missing, model.ExpectedFields{"country": "GB"})
+	suite.Assert().ErrorIs(err, custom_err.NotFoundError)
+}
+
+func Test_UpdateUser_UnexpectableField(t *testing.T) {
+	// the validation fails before touching the DB, so no collection is needed
+	storage := MongoUsersStorage{}
+
+	_, err := storage.UpdateUser(context.Background(), model.User{}, model.ExpectedFields{"$where": "true"})
+
+	assert.NotEqual(t, nil, err)
+}
+
+func (suite *MongoTestSuite) Test_Stats() {
+	storage := NewMongoUsersStorage(suite.db)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	suite.createTestUsers(
+		model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart},
+		model.User{ID: uuid.New(), FirstName: "bob", LastName: "bobek", Nickname: "bob", Password: "bpwd", Email: "bob@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart},
+		model.User{ID: uuid.New(), FirstName: "cyril", LastName: "cyrilek", Nickname: "cyril", Password: "cpwd", Email: "cyril@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart},
+	)
+
+	stats, err := storage.Stats(ctx)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(3), stats.Users)
+}
+
+func Test_mapWriteError_ValidationFailure(t *testing.T) {
+	details, err := bson.Marshal(bson.M{
+		"failingDocumentId": "10e4feb6-40f9-11ef-a3eb-0242ac170004",
+		"details":           bson.M{"operatorName": "$jsonSchema"},
+	})
+	assert.Equal(t, nil, err)
+	cmdResponse, err := bson.Marshal(bson.M{"ok": 0, "code": 121, "errInfo": bson.Raw(details)})
+	assert.Equal(t, nil, err)
+	wantDetails := map[string]any{
+		"failingDocumentId": "10e4feb6-40f9-11ef-a3eb-0242ac170004",
+		"details":           map[string]any{"operatorName": "$jsonSchema"},
+	}
+
+	tests := []struct {
+		name        string
+		err         error
+		wantDetails map[string]any
+	}{
+		{
+			name: "insert write error",
+			err: mongo.WriteException{WriteErrors: []mongo.WriteError{
+				{Code: 121, Message: "Document failed validation", Details: details},
+			}},
+			wantDetails: wantDetails,
+		},
+		{
+			name:        "find and modify command error",
+			err:         mongo.CommandError{Code: 121, Message: "Document failed validation", Raw: cmdResponse},
+			wantDetails: wantDetails,
+		},
+		{
+			name: "without details",
+			err: mongo.WriteException{WriteErrors: []mongo.WriteError{
+				{Code: 121, Message: "Document failed validation"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapWriteError(tt.err)
+
+			var validationErr *custom_err.ValidationError
+			assert.Equal(t, true, errors.As(got, &validationErr))
+			assert.Equal(t, "user failed the DB validation", validationErr.Error())
+			assert.Equal(t, tt.wantDetails, validationErr.Details())
+		})
+	}
+
+	// other errors are kept
+	otherErr := mongo.CommandError{Code: 11600, Message: "interrupted"}
+	assert.Equal(t, error(otherErr), mapWriteError(otherErr))
+}
+
+func (suite *MongoTestSuite) Test_Attribution() {
+	storage := NewMongoUsersStorage(suite.db)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "UK", CreatedBy: "admin", UpdatedBy: "admin", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.Require().NoError(storage.CreateUser(ctx, userAnna))
+
+	got, err := storage.GetUserByID(ctx, userAnna.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("admin", got.CreatedBy)
+	suite.Assert().Equal("admin", got.UpdatedBy)
+
+	// the creator is kept on update
+	update := userAnna
+	update.CreatedBy = ""
+	update.UpdatedBy = "operator"
+	updated, err := storage.UpdateUser(ctx, update, nil)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("admin", updated.CreatedBy)
+	suite.Assert().Equal("operator", updated.UpdatedBy)
+}
+
+func (suite *MongoTestSuite) Test_CreateUsers() {
+	storage := NewMongoUsersStorage(suite.db)
+
+	tests := []struct {
+		name         string
+		ordered      bool
+		wantFailures []custom_err.BatchItemError
+		wantInserted func(anna, bob model.User) []model.User
+	}{
+		{
+			name:    "ordered - stops at the duplicate",
+			ordered: true,
+			wantFailures: []custom_err.BatchItemError{
+				{Index: 1, Err: custom_err.NewConflictError("user already exists")},
+				{Index: 2, Err: custom_err.NotAttemptedError},
+			},
+			wantInserted: func(anna, _ model.User) []model.User { return []model.User{anna} },
+		},
+		{
+			name:    "unordered - skips the duplicate",
+			ordered: false,
+			wantFailures: []custom_err.BatchItemError{
+				{Index: 1, Err: custom_err.NewConflictError("user already exists")},
+			},
+			wantInserted: func(anna, bob model.User) []model.User { return []model.User{anna, bob} },
+		},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			suite.BeforeTest("", "")
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+			duplicate := userAnna
+			duplicate.Nickname = "duplicate"
+			userBob := model.User{ID: uuid.New(), FirstName: "bob", LastName: "bobek", Nickname: "bob", Password: "bpwd", Email: "bob@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+
+			failures, err := storage.CreateUsers(ctx, []model.User{userAnna, duplicate, userBob}, tt.ordered)
+
+			suite.Require().NoError(err)
+			suite.Assert().Equal(tt.wantFailures, failures)
+			got, err := storage.GetUsers(ctx, model.GetUsersParams{PageSize: 10, Sort: model.Sort{Field: "first_name", Type: "asc"}})
+			suite.Require().NoError(err)
+			suite.Assert().Equal(withoutPasswords(tt.wantInserted(userAnna, userBob)), got)
+		})
+	}
+}
+
+func Test_mapBatchWriteError(t *testing.T) {
+	bulkErr := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 3, Code: 11000, Message: "E11000 duplicate key error"}},
+		{WriteError: mongo.WriteError{Index: 1, Code: documentValidationFailureCode, Message: "Document failed validation"}},
+	}}
+
+	t.Run("unordered", func(t *testing.T) {
+		failures, err := mapBatchWriteError(bulkErr, 5, false)
+
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []custom_err.BatchItemError{
+			{Index: 1, Err: custom_err.NewValidationError("user failed the DB validation", nil)},
+			{Index: 3, Err: custom_err.NewConflictError("user already exists")},
+		}, failures)
+	})
+
+	t.Run("ordered", func(t *testing.T) {
+		failures, err := mapBatchWriteError(mongo.BulkWriteException{WriteErrors: bulkErr.WriteErrors[:1]}, 5, true)
+
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []custom_err.BatchItemError{
+			{Index: 3, Err: custom_err.NewConflictError("user already exists")},
+			{Index: 4, Err: custom_err.NotAttemptedError},
+		}, failures)
+	})
+
+	t.Run("not a write error", func(t *testing.T) {
+		dbErr := errors.New("connection reset")
+
+		failures, err := mapBatchWriteError(dbErr, 5, true)
+
+		assert.Equal(t, dbErr, err)
+		assert.Equal(t, 0, len(failures))
+	})
+}
+
+func (suite *MongoTestSuite) Test_EnsureIndexes() {
+	storage := NewMongoUsersStorage(suite.db, WithNicknameUniquePerCountry(), WithCaseInsensitiveIndexes("email"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	suite.createTestUsers(model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "UK", CreatedAt: suite.testStart, UpdatedAt: suite.testStart})
+
+	want := []model.Index{
+		{Name: "_id_", Keys: []string{"_id"}},
+		{Name: nicknamePerCountryIndexName, Keys: []string{"country", "nickname"}, Unique: true},
+		{Name: "email_case_insensitive", Keys: []string{"email"}, CaseInsensitive: true},
+	}
+	// repeated reindex keeps the same indexes
+	for i := 0; i < 2; i++ {
+		suite.Require().NoError(storage.EnsureIndexes(ctx))
+
+		got, err := storage.Indexes(ctx)
+		suite.Require().NoError(err)
+		suite.Assert().ElementsMatch(want, got)
+	}
+}
+
+func (suite *MongoTestSuite) Test_TouchUser() {
+	storage := NewMongoUsersStorage(suite.db)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna)
+
+	touchedAt := suite.testStart.Add(time.Minute)
+	got, err := storage.TouchUser(ctx, userAnna.ID, touchedAt, "admin")
+	suite.Require().NoError(err)
+
+	want := withoutPasswords([]model.User{userAnna})[0]
+	want.UpdatedAt = touchedAt
+	want.UpdatedBy = "admin"
+	suite.Assert().Equal(&want, got)
+
+	stored, err := storage.GetUserByID(ctx, userAnna.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(&want, stored, "only the update time and author have to change")
+
+	_, err = storage.TouchUser(ctx, uuid.New(), touchedAt, "admin")
+	suite.Assert().ErrorIs(err, custom_err.NotFoundError)
+}
+
+func (suite *MongoTestSuite) Test_GetUserProfile() {
+	storage := NewMongoUsersStorage(suite.db)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna)
+
+	got, err := storage.GetUserProfile(ctx, userAnna.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(&withoutPasswords([]model.User{userAnna})[0], got, "password is never read for the profile")
+
+	_, err = storage.GetUserProfile(ctx, uuid.New())
+	suite.Assert().ErrorIs(err, custom_err.NotFoundError)
+}
+
+func (suite *MongoTestSuite) Test_HiddenUsers() {
+	storage := NewMongoUsersStorage(suite.db, WithHiddenUsers("role", "service"))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	userAnna := model.User{ID: uuid.New(), FirstName: "anna", LastName: "alakava", Nickname: "anna", Password: "apwd", Email: "ann@gmail.com", Country: "Austria", CreatedAt: suite.testStart, UpdatedAt: suite.testStart}
+	suite.createTestUsers(userAnna)
+	// the service account is stored by other writer with the role field unknown to the model
+	serviceAccountID := uuid.New()
+	_, err := suite.db.Collection("users").InsertOne(ctx, bson.M{"_id": serviceAccountID, "first_name": "sync", "last_name": "bot", "nickname": "sync-bot", "role": "service"})
+	suite.Require().NoError(err)
+
+	params := model.GetUsersParams{PageSize: 10, Sort: model.Sort{Field: "last_name", Type: "asc"}}
+	got, err := storage.GetUsers(ctx, params)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(withoutPasswords([]model.User{userAnna}), got, "service accounts are hidden by default")
+
+	params.IncludeHidden = true
+	got, err = storage.GetUsers(ctx, params)
+	suite.Require().NoError(err)
+	suite.Require().Len(got, 2)
+	suite.Assert().Equal(serviceAccountID, got[1].ID)
+
+	var exported []uuid.UUID
+	export := func(user model.User) error {
+		exported = append(exported, user.ID)
+		return nil
+	}
+	_, err = storage.ExportUsers(ctx, 10, false, export)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]uuid.UUID{userAnna.ID}, exported, "service accounts are not exported by default")
+
+	exported = nil
+	_, err = storage.ExportUsers(ctx, 10, true, export)
+	suite.Require().NoError(err)
+	suite.Assert().ElementsMatch([]uuid.UUID{userAnna.ID, serviceAccountID}, exported)
+}
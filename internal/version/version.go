@@ -0,0 +1,14 @@
+package version
+
+const defaultVersion = "dev"
+
+// version is injected at build time via -ldflags "-X user-service/internal/version.version=<version>".
+var version string
+
+// Get returns the build version of the service or "dev" if it wasn't injected at build time.
+func Get() string {
+	if version == "" {
+		return defaultVersion
+	}
+	return version
+}
@@ -0,0 +1,34 @@
+package version
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Get(t *testing.T) {
+	tests := []struct {
+		name     string
+		injected string
+		want     string
+	}{
+		{
+			name:     "not injected - default",
+			injected: "",
+			want:     "dev",
+		},
+		{
+			name:     "injected",
+			injected: "v1.2.3",
+			want:     "v1.2.3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := version
+			defer func() { version = orig }()
+			version = tt.injected
+
+			assert.Equal(t, tt.want, Get())
+		})
+	}
+}
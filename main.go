@@ -4,24 +4,37 @@ import (
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/hellofresh/health-go/v5"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
+	"user-service/internal/auth"
 	cfg "user-service/internal/configuration"
 	"user-service/internal/controller"
 	"user-service/internal/events"
+	"user-service/internal/grpcapi"
 	"user-service/internal/metrics"
+	"user-service/internal/security"
 	"user-service/internal/service"
 	"user-service/internal/storage"
+	"user-service/internal/version"
+)
+
+const (
+	userEventsStreamBufferSize = 100
+	adminAPIKeyHeader          = "X-Admin-Api-Key"
 )
 
 func main() {
@@ -34,82 +47,424 @@ func main() {
 		logrus.WithError(err).Fatal("Failed to load service config from environment")
 	}
 	metrics.RegisterHTTPMetrics()
+	metrics.RegisterValidationMetrics()
+	metrics.RegisterEventsMetrics()
+	metrics.RegisterUsersMetrics()
 
-	kafkaProducer, err := events.NewKafkaProducer(cfg.KafkaServer,
+	kafkaOpts := []events.KafkaConfigOption{
 		events.WithAcks("all"),
-		events.WithClientID(cfg.ServiceName),
-		events.WithSecurityProtocol("plaintext"))
+		events.WithClientID(cfg.KafkaClientID()),
+		events.WithSecurityProtocol("plaintext"),
+	}
+	if events.PartitionStrategy(cfg.KafkaPartitionStrategy) == events.PartitionKeyHash {
+		// the partitioner of the Java clients, so the topics keyed the same way by them are co-partitioned
+		kafkaOpts = append(kafkaOpts, events.WithOption("partitioner", "murmur2_random"))
+	}
+	kafkaProducer, err := events.NewKafkaProducer(cfg.KafkaServer, kafkaOpts...)
 	if err != nil {
 		logrus.WithError(err).Fatal("Failed to create kafka producer")
 	}
-	userEventsKafkaProducer := events.NewKafkaTopicProducer(kafkaProducer, cfg.KafkaEventsTopicName)
+	topicOpts := []events.TopicOpt{
+		events.WithPartitionStrategy(events.PartitionStrategy(cfg.KafkaPartitionStrategy), cfg.KafkaPartitionCount),
+	}
+	if cfg.KafkaEventTimestamps {
+		topicOpts = append(topicOpts, events.WithEventTimestamps())
+	}
+	var topicProducer events.Producer = events.NewKafkaTopicProducer(kafkaProducer, cfg.KafkaEventsTopicName, topicOpts...)
+	if cfg.EventsMaxProduceRate > 0 {
+		// below the retries, so the retried attempts are limited too
+		topicProducer = events.NewRateLimitedProducer(topicProducer, cfg.EventsMaxProduceRate,
+			events.WithThrottledCounter(metrics.EventsThrottledCounter()))
+	}
+	// the retries are configurable only with the async production, so their backoff never sleeps in the request path
+	var userEventsKafkaProducer events.Producer = events.NewRetryingProducer(topicProducer,
+		cfg.EventsProduceMaxAttempts, cfg.EventsProduceInitialBackoff, cfg.EventsProduceMaxBackoff,
+		events.WithOutcomeCounter(func(outcome events.ProduceOutcome) events.Counter {
+			return metrics.EventsProducedCounter(string(outcome))
+		}),
+		events.WithAttemptsObserver(metrics.EventProduceAttemptsHistogram()))
+	var asyncProducer *events.AsyncProducer
+	if cfg.EventsAsyncProduce {
+		// moves the production incl. retries out of the request path
+		asyncProducer = events.NewAsyncProducer(userEventsKafkaProducer, cfg.EventsAsyncBufferSize,
+			events.WithQueueDepthGauge(metrics.EventQueueDepthGauge()),
+			events.WithFullBufferPolicy(events.FullBufferPolicy(cfg.EventsAsyncFullPolicy)),
+			events.WithDroppedCounter(metrics.EventsDroppedCounter()))
+		userEventsKafkaProducer = asyncProducer
+	}
+	var debouncingProducer *events.DebouncingProducer
+	if cfg.EventsDebounceWindow > 0 {
+		// collapses the rapid updates of a user to a single event
+		debouncingProducer = events.NewDebouncingProducer(userEventsKafkaProducer, cfg.EventsDebounceWindow)
+		userEventsKafkaProducer = debouncingProducer
+	}
+	// feeds the user events stream endpoint with the changes done by this instance
+	userEventsBroadcaster := events.NewBroadcaster(userEventsStreamBufferSize)
 
-	mongoOpts := options.Client().ApplyURI(cfg.MongoURL).SetAppName(cfg.ServiceName)
-	mongoClient, err := mongo.Connect(context.Background(), mongoOpts)
+	mongoOpts := cfg.MongoClientOptions()
+	if cfg.MongoPoolMetrics {
+		mongoOpts.SetPoolMonitor(metrics.NewMongoPoolMonitor())
+	}
+	mongoStartupRetry := startupRetry{
+		attempts: cfg.MongoStartupAttempts,
+		interval: cfg.MongoStartupRetryInterval,
+		sleep:    time.Sleep,
+	}
+	var mongoClient *mongo.Client
+	err = mongoStartupRetry.do("mongodb connect", func() error {
+		var connectErr error
+		mongoClient, connectErr = mongo.Connect(context.Background(), mongoOpts)
+		return connectErr
+	})
 	if err != nil {
 		logrus.WithError(err).Fatal("Failed to connect to mongodb")
 	}
+	if err := checkMongoOnStartup(mongoClient, cfg.MongoStartupPingTimeout, cfg.MongoStartupFailFast, mongoStartupRetry); err != nil {
+		logrus.WithError(err).Fatal("Failed to ping mongodb")
+	}
 	database := mongoClient.Database(cfg.MongoDBName)
-	usersStore := storage.NewMongoUsersStorage(database, storage.WithTimeout(cfg.MongoOperationTimeout))
+	storageOpts := []storage.Opt{
+		storage.WithTimeout(cfg.MongoOperationTimeout),
+		storage.WithMaxPageSize(cfg.MaxPageSize),
+		storage.WithIncrementalDecodePageSize(cfg.MongoIncrementalDecodeSize),
+	}
+	if cfg.MongoStrictSortType {
+		storageOpts = append(storageOpts, storage.WithStrictSortType())
+	}
+	if cfg.EmailHashSecret != "" {
+		storageOpts = append(storageOpts, storage.WithEmailHashing(cfg.EmailHashSecret))
+	}
+	if cfg.MongoSchemaDriftWarnings {
+		storageOpts = append(storageOpts, storage.WithSchemaDriftWarnings())
+	}
+	if cfg.NicknameUniquePerCountry {
+		storageOpts = append(storageOpts, storage.WithNicknameUniquePerCountry())
+	}
+	if cfg.HiddenUsersField != "" {
+		storageOpts = append(storageOpts, storage.WithHiddenUsers(cfg.HiddenUsersField, cfg.HiddenUsersValue))
+	}
+	if cfg.MongoCaseInsensitiveIndexes {
+		storageOpts = append(storageOpts, storage.WithCaseInsensitiveIndexes(cfg.CaseInsensitiveIndexFields()...))
+	}
+	usersStore := storage.NewMongoUsersStorage(database, storageOpts...)
+	if err := usersStore.EnsureIndexes(context.Background()); err != nil {
+		if cfg.MongoStartupFailFast {
+			logrus.WithError(err).Fatal("Failed to create mongodb indexes")
+		}
+		logrus.WithError(err).Warn("Failed to create mongodb indexes, starting in not-ready mode")
+	}
 
-	healthHandler, err := createHealthHandler(cfg.ServiceName, mongoClient, kafkaProducer)
+	ready := &readiness{}
+	healthHandler, err := createHealthHandler(cfg.ServiceName, version.Get(),
+		mongoHealthCheck(usersStore),
+		health.Config{Name: "kafka", Check: kafkaProducer.Health},
+		ready.healthCheck())
 	if err != nil {
 		logrus.WithError(err).Fatal("Failed to create health handler")
 	}
+	// the liveness has no checks, the process is restarted only if it doesn't respond at all
+	livenessHandler, err := createHealthHandler(cfg.ServiceName, version.Get())
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to create liveness handler")
+	}
 
-	svc := service.New(usersStore, userEventsKafkaProducer)
-	httpServer := setupHTTPServer(cfg.HTTPServerPort, svc, healthHandler.Handler())
+	svcOpts := []service.Opt{
+		service.WithEventsOrdering(service.EventsOrdering(cfg.EventsOrdering)),
+		service.WithTimestampPrecision(cfg.TimestampPrecision),
+	}
+	if cfg.ClientTimestamps {
+		svcOpts = append(svcOpts, service.WithClientTimestamps())
+	}
+	if cfg.ReadAfterCreate {
+		svcOpts = append(svcOpts, service.WithReadAfterCreate())
+	}
+	if len(cfg.ImmutableFields) > 0 {
+		svcOpts = append(svcOpts, service.WithImmutableFields(cfg.ImmutableFields...))
+	}
+	var usersStorage service.UsersStorage = usersStore
+	if cfg.MongoCircuitBreakerFailures > 0 {
+		usersStorage = storage.NewCircuitBreakerStorage(usersStore, cfg.MongoCircuitBreakerFailures, cfg.MongoCircuitBreakerCooldown)
+	}
+	svc := service.New(usersStorage, events.NewMultiProducer(userEventsKafkaProducer, userEventsBroadcaster), svcOpts...)
+	var eventsFlusher controller.EventsFlusher
+	if asyncProducer != nil {
+		eventsFlusher = asyncProducer
+	}
+	// shared by the REST and gRPC APIs, so they accept the same users and the read-only mode applies to both
+	readOnlyMode := controller.NewReadOnlyMode(cfg.ReadOnly)
+	validationOpts := userValidationOpts(cfg)
+	httpServer := setupHTTPServer(cfg, svc, usersStore, eventsFlusher, userEventsBroadcaster, readOnlyMode, validationOpts,
+		healthHandler.Handler(), livenessHandler.Handler())
 	go func() {
 		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logrus.WithError(err).Fatal("failed to start HTTP server")
 		}
 	}()
+	var grpcServer *grpc.Server
+	if cfg.GRPCServerPort > 0 {
+		grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCServerPort))
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to listen on gRPC port")
+		}
+		grpcOpts := []grpcapi.Opt{
+			grpcapi.WithUserValidator(controller.NewUserValidator(validationOpts...)),
+			grpcapi.WithReadOnlyMode(readOnlyMode),
+			grpcapi.WithPageSizes(cfg.DefaultPageSize, cfg.MaxPageSize),
+			grpcapi.WithSortFields(cfg.SortableFields...),
+		}
+		if cfg.AuthSubjectHeader != "" {
+			grpcOpts = append(grpcOpts, grpcapi.WithAuthSubjectMetadata(cfg.AuthSubjectHeader))
+		}
+		grpcServer = grpcapi.NewServer(svc, grpcOpts...)
+		go func() {
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				logrus.WithError(err).Fatal("failed to start gRPC server")
+			}
+		}()
+	}
 
 	<-terminateChan
 	logrus.Info("Shutting down service...")
-	gracefulShutdown(cfg, httpServer, mongoClient, kafkaProducer)
+	preDrain(ready, cfg.HTTPPreShutdownDelay, time.Sleep)
+	gracefulShutdown(cfg, httpServer, grpcServer, mongoClient, kafkaProducer, asyncProducer, debouncingProducer)
 	os.Exit(0)
 }
 
-func setupHTTPServer(port int, svc *service.Service, health http.Handler) *http.Server {
+type mongoPinger interface {
+	Ping(ctx context.Context, rp *readpref.ReadPref) error
+}
+
+// startupRetry retries the startup operations failing transiently e.g. while mongo is still starting alongside the service.
+type startupRetry struct {
+	attempts int
+	// interval is the wait after the first failed attempt, it doubles with each further one
+	interval time.Duration
+	sleep    func(time.Duration)
+}
+
+// do calls the op until it succeeds, but at most the attempts times. Returns the error of the last attempt.
+func (r startupRetry) do(name string, op func() error) error {
+	wait := r.interval
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= r.attempts {
+			return err
+		}
+		logrus.WithError(err).
+			WithField("attempt", attempt).
+			Warnf("%s failed, retrying in %s", name, wait)
+		r.sleep(wait)
+		wait *= 2
+	}
+}
+
+// checkMongoOnStartup pings mongo with the given timeout, retrying the failed pings. The ping error is returned only
+// in fail fast mode, otherwise it is just logged and the service starts in not-ready mode with the health check
+// reporting mongo as down.
+func checkMongoOnStartup(mongo mongoPinger, timeout time.Duration, failFast bool, retry startupRetry) error {
+	err := retry.do("mongodb ping", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return mongo.Ping(ctx, readpref.Primary())
+	})
+	if err == nil {
+		return nil
+	}
+	if failFast {
+		return err
+	}
+
+	logrus.WithError(err).Warn("Mongodb is not reachable, starting in not-ready mode")
+	return nil
+}
+
+// userValidationOpts returns the options of the user validation shared by the REST and gRPC APIs.
+func userValidationOpts(cfg *cfg.ServiceConfig) []controller.Opt {
+	var emailMXChecker *controller.MXChecker
+	if controller.EmailValidation(cfg.EmailValidation) == controller.EmailValidationMX {
+		emailMXChecker = controller.NewMXChecker(net.DefaultResolver, cfg.EmailMXLookupTimeout, cfg.EmailMXCacheTTL)
+	}
+	return []controller.Opt{
+		controller.WithPasswordPersonalFieldsCheck(cfg.PasswordPersonalFieldsCheck),
+		controller.WithSoftValidation(cfg.SoftValidationFields...),
+		controller.WithMaxFieldLengths(cfg.FieldMaxLengths),
+		controller.WithEmailMXCheck(emailMXChecker),
+	}
+}
+
+func setupHTTPServer(cfg *cfg.ServiceConfig, svc *service.Service, indexer controller.Indexer,
+	eventsFlusher controller.EventsFlusher, broadcaster *events.Broadcaster, readOnlyMode *controller.ReadOnlyMode,
+	validationOpts []controller.Opt, health, liveness http.Handler) *http.Server {
 	router := gin.New()
+	// so the values put to the request context by middlewares are visible via the gin context passed to the service
+	router.ContextWithFallback = true
 	router.Use(gin.Recovery())
 	router.Use(metrics.HTTPRequestDurationMetricsMiddleware())
-	router.Use(gin.LoggerWithWriter(logrus.StandardLogger().Out))
+	if cfg.SecurityHeaders {
+		router.Use(security.HeadersMiddleware(security.Headers{
+			FrameOptions:          cfg.SecurityFrameOptions,
+			ReferrerPolicy:        cfg.SecurityReferrerPolicy,
+			ContentSecurityPolicy: cfg.SecurityContentPolicy,
+			HSTSMaxAge:            cfg.SecurityHSTSMaxAge,
+		}))
+	}
+	if cfg.AuthSubjectHeader != "" {
+		router.Use(auth.TrustedHeaderSubjectMiddleware(cfg.AuthSubjectHeader))
+	}
+	if cfg.AdminAPIKey != "" {
+		router.Use(auth.AdminAPIKeyMiddleware(adminAPIKeyHeader, cfg.AdminAPIKey))
+	}
+	router.Use(metrics.RequestLogMiddleware(logrus.StandardLogger().Out, cfg.HTTPSlowRequestThreshold,
+		"/v1/users/stream", "/v1/users/export"))
+
+	var idCodec controller.IDCodec = controller.UUIDCodec{}
+	if cfg.UserIDEncoding == "base62" {
+		idCodec = controller.Base62Codec{}
+	}
 
 	v1Group := router.Group("v1")
-	controller.CreateUsersHandlers(v1Group, svc)
+	controller.CreateUsersHandlers(v1Group, svc, append(validationOpts,
+		controller.WithMaxPageSize(cfg.MaxPageSize),
+		controller.WithDefaultPageSize(cfg.DefaultPageSize),
+		controller.WithResultTruncated(cfg.ListResultTruncated),
+		controller.WithListStreaming(cfg.ListStreaming),
+		controller.WithEmptyListNoContent(cfg.EmptyListNoContent),
+		controller.WithTimeFormat(controller.TimeFormat(cfg.JSONTimeFormat)),
+		controller.WithExportMaxUsers(cfg.ExportMaxUsers),
+		controller.WithExportFormat(controller.ExportFormat(cfg.ExportFormat)),
+		controller.WithExportTimeout(cfg.ExportTimeout),
+		controller.WithBatchStreaming(cfg.BatchStreamChunkSize, int64(cfg.BatchMaxBodySize)),
+		controller.WithBatchLimits(cfg.BatchMaxItems, cfg.BatchMaxConcurrency),
+		controller.WithMaxJSONDepth(cfg.JSONMaxDepth),
+		controller.WithStrictPayloadFields(cfg.StrictPayloadFields),
+		controller.WithStrictQueryParams(cfg.StrictQueryParams),
+		controller.WithHashedEmails(cfg.EmailHashSecret != ""),
+		controller.WithRejectMismatchedBodyID(cfg.RejectMismatchedBodyID),
+		controller.WithClientTimestamps(cfg.ClientTimestamps),
+		controller.WithUserIDVersion(uuid.Version(cfg.UserIDVersion)),
+		controller.WithIDCodec(idCodec),
+		controller.WithReadOnlyMode(readOnlyMode),
+		controller.WithValidationErrorDetails(cfg.ValidationErrorDetails),
+		controller.WithProblemDetails(cfg.ProblemJSONErrors),
+		controller.WithPrettyJSON(cfg.PrettyJSON),
+		controller.WithEchoEvent(cfg.DebugEchoEvent),
+		controller.WithSortFields(cfg.SortableFields...),
+		controller.WithFilterFields(cfg.FilterableFields...),
+		controller.WithEventsStream(broadcaster))...)
+	if cfg.AdminAPIKey != "" {
+		adminGroup := v1Group.Group("admin", auth.APIKeyMiddleware(adminAPIKeyHeader, cfg.AdminAPIKey))
+		controller.CreateAdminHandlers(adminGroup, svc,
+			controller.WithReadOnlyMode(readOnlyMode),
+			controller.WithIndexer(indexer),
+			controller.WithEventsFlusher(eventsFlusher, cfg.KafkaGracefulShutdownTimeout),
+			controller.WithValidationErrorDetails(cfg.ValidationErrorDetails),
+			controller.WithProblemDetails(cfg.ProblemJSONErrors),
+			controller.WithMaxJSONDepth(cfg.JSONMaxDepth))
+	}
 
 	router.GET("/health", gin.WrapH(health))
+	router.GET("/health/ready", gin.WrapH(health))
+	router.GET("/health/live", gin.WrapH(liveness))
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-	return &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.HTTPServerPort),
 		Handler: router.Handler(),
+		// bigger request headers are rejected with 431 Request Header Fields Too Large
+		MaxHeaderBytes: cfg.HTTPMaxHeaderBytes,
 	}
+	// end the long-lived event streams, so they don't block the graceful shutdown
+	server.RegisterOnShutdown(broadcaster.Close)
+	return server
 }
 
-func createHealthHandler(serviceName string, mongo *mongo.Client, producer *events.KafkaProducer) (*health.Health, error) {
+func createHealthHandler(serviceName, version string, checks ...health.Config) (*health.Health, error) {
 	return health.New(health.WithComponent(health.Component{
 		Name:    serviceName,
-		Version: "v1.0",
-	}), health.WithChecks(health.Config{
+		Version: version,
+	}), health.WithChecks(checks...))
+}
+
+type statsProvider interface {
+	Stats(ctx context.Context) (storage.Stats, error)
+}
+
+// mongoHealthCheck checks the users collection and updates the users metric by the same DB call.
+func mongoHealthCheck(users statsProvider) health.Config {
+	return health.Config{
 		Name: "mongodb",
 		Check: func(ctx context.Context) error {
-			if err := mongo.Ping(ctx, readpref.Primary()); err != nil {
-				return errors.Wrap(err, "mongoDB health check failed on ping")
+			stats, err := users.Stats(ctx)
+			if err != nil {
+				return errors.Wrap(err, "mongoDB health check failed on users stats")
 			}
+			metrics.SetUsersTotal(stats.Users)
 			return nil
 		},
-	},
-		health.Config{
-			Name:  "kafka",
-			Check: producer.Health,
-		}))
+	}
+}
+
+// readiness tells whether the service accepts new requests. It stays ready until the shutdown starts.
+type readiness struct {
+	draining atomic.Bool
+}
+
+// drain marks the service not ready as it is shutting down.
+func (r *readiness) drain() {
+	r.draining.Store(true)
+}
+
+// healthCheck fails once the service is shutting down, so the readiness probe fails.
+func (r *readiness) healthCheck() health.Config {
+	return health.Config{
+		Name: "shutdown",
+		Check: func(context.Context) error {
+			if r.draining.Load() {
+				return errors.New("service is shutting down")
+			}
+			return nil
+		},
+	}
+}
+
+// preDrain marks the service not ready and waits for the delay before the HTTP server is shut down. The requests
+// routed to the instance until the load balancer deregisters it are still served instead of being refused.
+func preDrain(ready *readiness, delay time.Duration, sleep func(time.Duration)) {
+	ready.drain()
+	if delay <= 0 {
+		return
+	}
+	logrus.WithField("delay", delay).Info("Waiting for load balancer deregistration")
+	sleep(delay)
+}
+
+type grpcStopper interface {
+	GracefulStop()
+	Stop()
 }
 
-// gracefulShutdown at first shuts down the HTTP server, then mongo and kafka connections in parallel
-func gracefulShutdown(cfg *cfg.ServiceConfig, server *http.Server, mongoClient *mongo.Client, kafkaProducer *events.KafkaProducer) {
+// shutdownGRPCServer stops the gRPC server waiting for the running calls at most the timeout,
+// the calls still running afterward are cancelled.
+func shutdownGRPCServer(server grpcStopper, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		logrus.Warn("gRPC server graceful shutdown timed out, cancelling the running calls")
+		server.Stop()
+		<-stopped
+	}
+}
+
+// gracefulShutdown shuts down the HTTP and gRPC servers first, so no new events are produced, then mongo and kafka
+// connections in parallel. The gRPC server, async and debouncing producers are nil when disabled.
+func gracefulShutdown(cfg *cfg.ServiceConfig, server *http.Server, grpcServer *grpc.Server, mongoClient *mongo.Client,
+	kafkaProducer *events.KafkaProducer, asyncProducer *events.AsyncProducer, debouncingProducer *events.DebouncingProducer) {
 	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), cfg.HTTPGracefulShutdownTimeout)
 	defer cancelHTTP()
 
@@ -117,6 +472,10 @@ func gracefulShutdown(cfg *cfg.ServiceConfig, server *http.Server, mongoClient *
 	if err := server.Shutdown(httpCtx); err != nil {
 		logrus.WithError(err).Fatal("Error while shutting down HTTP Server. Shutting down forcefully...")
 	}
+	if grpcServer != nil {
+		logrus.Info("Shutting down gRPC server")
+		shutdownGRPCServer(grpcServer, cfg.GRPCGracefulShutdownTimeout)
+	}
 
 	mongoCtx, cancelMongo := context.WithTimeout(context.Background(), cfg.MongoGracefulShutdownTimeout)
 	defer cancelMongo()
@@ -134,6 +493,14 @@ func gracefulShutdown(cfg *cfg.ServiceConfig, server *http.Server, mongoClient *
 	go func() {
 		logrus.Info("Shutting down Kafka producer")
 		defer shutdownWG.Done()
+		if debouncingProducer != nil {
+			debouncingProducer.Close()
+		}
+		if asyncProducer != nil {
+			if err := asyncProducer.Close(cfg.KafkaGracefulShutdownTimeout); err != nil {
+				logrus.WithError(err).Error("Buffered events were not produced")
+			}
+		}
 		kafkaProducer.Close(cfg.KafkaGracefulShutdownTimeout)
 	}()
 
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	cfg "user-service/internal/configuration"
+	"user-service/internal/controller"
+	"user-service/internal/events"
+	"user-service/internal/service"
+	"user-service/internal/storage"
+)
+
+func Test_createHealthHandler_Version(t *testing.T) {
+	healthHandler, err := createHealthHandler("user-service", "v1.2.3")
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	healthHandler.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var got struct {
+		Component struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"component"`
+	}
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "user-service", got.Component.Name)
+	assert.Equal(t, "v1.2.3", got.Component.Version)
+}
+
+type pingerStub struct {
+	err         error
+	gotDeadline bool
+	// failures is the number of the first pings failing with the err, all of them fail if zero
+	failures int
+	pings    int
+}
+
+func (p *pingerStub) Ping(ctx context.Context, _ *readpref.ReadPref) error {
+	_, p.gotDeadline = ctx.Deadline()
+	p.pings++
+	if p.failures > 0 && p.pings > p.failures {
+		return nil
+	}
+	return p.err
+}
+
+func Test_checkMongoOnStartup(t *testing.T) {
+	tests := []struct {
+		name     string
+		pingErr  error
+		failFast bool
+		wantErr  bool
+	}{
+		{
+			name:     "reachable - fail fast",
+			failFast: true,
+		},
+		{
+			name:     "unreachable - fail fast",
+			pingErr:  errors.New("server selection timeout"),
+			failFast: true,
+			wantErr:  true,
+		},
+		{
+			name:    "reachable - degraded mode",
+			pingErr: nil,
+		},
+		{
+			name:    "unreachable - degraded mode starts anyway",
+			pingErr: errors.New("server selection timeout"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinger := &pingerStub{err: tt.pingErr}
+
+			err := checkMongoOnStartup(pinger, time.Second, tt.failFast, startupRetry{attempts: 1})
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.True(t, pinger.gotDeadline, "ping has to be bounded by timeout")
+		})
+	}
+}
+
+func Test_checkMongoOnStartup_Retry(t *testing.T) {
+	var waits []time.Duration
+	retry := startupRetry{
+		attempts: 4,
+		interval: 100 * time.Millisecond,
+		sleep:    func(d time.Duration) { waits = append(waits, d) },
+	}
+
+	t.Run("transient failures are retried with backoff", func(t *testing.T) {
+		waits = nil
+		pinger := &pingerStub{err: errors.New("server selection timeout"), failures: 2}
+
+		err := checkMongoOnStartup(pinger, time.Second, true, retry)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, pinger.pings)
+		assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, waits)
+	})
+
+	t.Run("attempts are bounded", func(t *testing.T) {
+		waits = nil
+		pinger := &pingerStub{err: errors.New("server selection timeout")}
+
+		err := checkMongoOnStartup(pinger, time.Second, true, retry)
+
+		assert.Error(t, err)
+		assert.Equal(t, 4, pinger.pings)
+		assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, waits)
+	})
+}
+
+func Test_setupHTTPServer_MaxHeaderBytes(t *testing.T) {
+	config := &cfg.ServiceConfig{
+		MaxPageSize:        100,
+		DefaultPageSize:    20,
+		ExportMaxUsers:     100,
+		HTTPMaxHeaderBytes: 1024,
+	}
+	server := setupHTTPServer(config, service.New(nil, nil), nil, nil, events.NewBroadcaster(1), controller.NewReadOnlyMode(false), nil, http.NotFoundHandler(), http.NotFoundHandler())
+	require.Equal(t, 1024, server.MaxHeaderBytes)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	// the server tolerates some bytes over the limit, so go well over it
+	req, err := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/health", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Big", strings.Repeat("a", 10*1024))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+}
+
+func Test_setupHTTPServer_SecurityHeaders(t *testing.T) {
+	config := &cfg.ServiceConfig{
+		MaxPageSize:          100,
+		DefaultPageSize:      20,
+		ExportMaxUsers:       100,
+		SecurityHeaders:      true,
+		SecurityFrameOptions: "DENY",
+		SecurityHSTSMaxAge:   time.Hour,
+	}
+	server := setupHTTPServer(config, service.New(nil, nil), nil, nil, events.NewBroadcaster(1), controller.NewReadOnlyMode(false), nil, http.NotFoundHandler(), http.NotFoundHandler())
+	w := httptest.NewRecorder()
+
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "max-age=3600", w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, w.Header().Get("Referrer-Policy"))
+}
+
+type statsProviderStub struct {
+	stats storage.Stats
+	err   error
+}
+
+func (s statsProviderStub) Stats(context.Context) (storage.Stats, error) {
+	return s.stats, s.err
+}
+
+func Test_preDrain(t *testing.T) {
+	ready := &readiness{}
+	healthHandler, err := createHealthHandler("user-service", "v1.2.3", ready.healthCheck())
+	require.NoError(t, err)
+	livenessHandler, err := createHealthHandler("user-service", "v1.2.3")
+	require.NoError(t, err)
+	config := &cfg.ServiceConfig{
+		MaxPageSize:     100,
+		DefaultPageSize: 20,
+		ExportMaxUsers:  100,
+	}
+	server := setupHTTPServer(config, service.New(nil, nil), nil, nil, events.NewBroadcaster(1), controller.NewReadOnlyMode(false), nil,
+		healthHandler.Handler(), livenessHandler.Handler())
+	probe := func(path string) int {
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, probe("/health/ready"))
+	assert.Equal(t, http.StatusOK, probe("/health/live"))
+
+	var waited time.Duration
+	var readyDuring, liveDuring int
+	preDrain(ready, 5*time.Second, func(d time.Duration) {
+		waited = d
+		readyDuring, liveDuring = probe("/health/ready"), probe("/health/live")
+	})
+
+	assert.Equal(t, 5*time.Second, waited)
+	assert.Equal(t, http.StatusServiceUnavailable, readyDuring)
+	assert.Equal(t, http.StatusOK, liveDuring)
+}
+
+func Test_mongoHealthCheck(t *testing.T) {
+	check := mongoHealthCheck(statsProviderStub{stats: storage.Stats{Users: 42}})
+	assert.NoError(t, check.Check(context.Background()))
+
+	check = mongoHealthCheck(statsProviderStub{err: errors.New("connection refused")})
+	assert.ErrorContains(t, check.Check(context.Background()), "connection refused")
+}
+
+// grpcStopperStub blocks the graceful stop until the running calls are cancelled by the stop, if the calls are running.
+type grpcStopperStub struct {
+	runningCalls bool
+	cancelled    chan struct{}
+	stopped      bool
+}
+
+func (s *grpcStopperStub) GracefulStop() {
+	if s.runningCalls {
+		<-s.cancelled
+	}
+}
+
+func (s *grpcStopperStub) Stop() {
+	s.stopped = true
+	close(s.cancelled)
+}
+
+func Test_shutdownGRPCServer(t *testing.T) {
+	t.Run("no running calls", func(t *testing.T) {
+		server := &grpcStopperStub{cancelled: make(chan struct{})}
+
+		shutdownGRPCServer(server, time.Second)
+
+		assert.False(t, server.stopped)
+	})
+
+	t.Run("running calls are cancelled after the timeout", func(t *testing.T) {
+		server := &grpcStopperStub{runningCalls: true, cancelled: make(chan struct{})}
+
+		shutdownGRPCServer(server, 10*time.Millisecond)
+
+		assert.True(t, server.stopped)
+	})
+}